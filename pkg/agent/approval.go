@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+)
+
+// DefaultApprovalTimeout is how long a mutating tool call waits for the user's decision
+const DefaultApprovalTimeout = 10 * time.Minute
+
+// ErrApprovalNotFound is returned when an approval does not exist or was already resolved
+var ErrApprovalNotFound = errors.New("approval not found or already resolved")
+
+// ErrApprovalForbidden is returned when a user resolves an approval requested in another user's chat
+var ErrApprovalForbidden = errors.New("approval belongs to another user")
+
+// ToolAccess classifies what a tool does to the systems it talks to
+type ToolAccess string
+
+// Tool access classes
+const (
+	ToolAccessReadOnly ToolAccess = "read_only" // Safe to run without asking
+	ToolAccessMutating ToolAccess = "mutating"  // Changes state; needs the user's approval
+)
+
+// mutatingVerbs are tool name prefixes that indicate a tool changes state
+var mutatingVerbs = map[string]bool{
+	"ack": true, "acknowledge": true, "add": true, "assign": true, "cancel": true,
+	"close": true, "create": true, "delete": true, "disable": true, "edit": true,
+	"enable": true, "expire": true, "import": true, "modify": true, "mute": true,
+	"patch": true, "post": true, "publish": true, "put": true, "remove": true,
+	"resolve": true, "restart": true, "send": true, "set": true, "silence": true,
+	"trigger": true, "unmute": true, "update": true, "upload": true, "write": true,
+}
+
+// classifyTool decides whether a tool is read-only or mutating.
+// An explicit override wins, then the server's annotations, then the tool name.
+func classifyTool(tool mcp.Tool, overrides map[string]ToolAccess) ToolAccess {
+	if access, ok := overrides[tool.Name]; ok {
+		return access
+	}
+
+	if a := tool.Annotations; a != nil {
+		if a.DestructiveHint != nil && *a.DestructiveHint {
+			return ToolAccessMutating
+		}
+		if a.ReadOnlyHint != nil {
+			if *a.ReadOnlyHint {
+				return ToolAccessReadOnly
+			}
+			return ToolAccessMutating
+		}
+	}
+
+	// Name heuristic on the unprefixed name, e.g. alertmanager__post_silence -> post
+	name := tool.Name
+	if i := strings.LastIndex(name, "__"); i >= 0 {
+		name = name[i+2:]
+	}
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' })
+	if len(words) > 0 && mutatingVerbs[strings.ToLower(words[0])] {
+		return ToolAccessMutating
+	}
+
+	return ToolAccessReadOnly
+}
+
+// classifyMCPTools returns the names of the mutating tools offered by the MCP servers
+func classifyMCPTools(toolsByServer map[string][]mcp.Tool, routes map[string]ToolRoute, overrides map[string]ToolAccess) map[string]bool {
+	mutating := make(map[string]bool)
+
+	for _, mcpTools := range toolsByServer {
+		for _, tool := range mcpTools {
+			access, ok := overrides[tool.Name]
+			if !ok {
+				// The name heuristic reads the server's own name, whatever the exposed prefix
+				own := tool
+				own.Name = routes[tool.Name].Tool
+				access = classifyTool(own, nil)
+			}
+			if access == ToolAccessMutating {
+				mutating[tool.Name] = true
+			}
+		}
+	}
+
+	return mutating
+}
+
+// approvalDecision is the outcome of waiting for the user to approve a tool call
+type approvalDecision int
+
+const (
+	approvalGranted   approvalDecision = iota
+	approvalRejected                   // The user declined
+	approvalExpired                    // No decision before the timeout
+	approvalAbandoned                  // The chat stream went away
+)
+
+// pendingApproval is a mutating tool call waiting for its user's decision
+type pendingApproval struct {
+	sessionID string
+	owner     string
+	decision  chan bool
+}
+
+// requiresApproval reports whether a tool changes state and must be approved before it runs
+func (m *Manager) requiresApproval(toolName string) bool {
+	return m.currentTools().mutating[toolName]
+}
+
+// awaitApproval announces a mutating tool call with an approval_required event and
+// blocks until the user approves or rejects it, the approval times out or ctx ends
+func (m *Manager) awaitApproval(ctx context.Context, sessionID string, user User, call ToolInvocation, send func(llm.StreamChunk) bool) approvalDecision {
+	approvalID, err := newApprovalID()
+	if err != nil {
+		log.DefaultLogger.Error("Failed to create approval", "error", err)
+		return approvalRejected
+	}
+
+	pending := &pendingApproval{
+		sessionID: sessionID,
+		owner:     user.Login,
+		decision:  make(chan bool, 1),
+	}
+
+	m.mu.Lock()
+	m.approvals[approvalID] = pending
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.approvals, approvalID)
+		m.mu.Unlock()
+	}()
+
+	if !send(llm.StreamChunk{
+		Type:       "approval_required",
+		ApprovalID: approvalID,
+		Tool:       call.Tool,
+		ToolCallID: call.ID,
+		Arguments:  call.Arguments,
+	}) {
+		return approvalAbandoned
+	}
+
+	log.DefaultLogger.Info("Waiting for tool approval", "session", sessionID, "tool", call.Tool, "approval", approvalID)
+
+	timer := time.NewTimer(m.approvalTimeout)
+	defer timer.Stop()
+
+	select {
+	case approved := <-pending.decision:
+		if approved {
+			return approvalGranted
+		}
+		return approvalRejected
+	case <-timer.C:
+		log.DefaultLogger.Info("Tool approval timed out", "session", sessionID, "tool", call.Tool, "approval", approvalID)
+		return approvalExpired
+	case <-ctx.Done():
+		return approvalAbandoned
+	}
+}
+
+// ResolveApproval records the user's decision on a pending tool call.
+// Only the user whose chat requested the approval may resolve it.
+func (m *Manager) ResolveApproval(approvalID string, user User, approved bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending, ok := m.approvals[approvalID]
+	if !ok {
+		return ErrApprovalNotFound
+	}
+	if pending.owner != user.Login {
+		return ErrApprovalForbidden
+	}
+
+	delete(m.approvals, approvalID)
+	pending.decision <- approved
+
+	log.DefaultLogger.Info("Tool approval resolved", "session", pending.sessionID, "approval", approvalID, "approved", approved)
+	return nil
+}
+
+// declinedResult is the tool result the model sees for a mutating call that did not run
+func declinedResult(call ToolInvocation, decision approvalDecision) string {
+	switch decision {
+	case approvalExpired:
+		return fmt.Sprintf("Error: %s was not run because the user did not approve it in time", call.Tool)
+	default:
+		return fmt.Sprintf("Error: the user rejected running %s with these arguments", call.Tool)
+	}
+}
+
+// newApprovalID returns a random, unguessable approval identifier
+func newApprovalID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate approval ID: %w", err)
+	}
+	return "approval-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,197 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestClassifyTool(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name      string
+		tool      mcp.Tool
+		overrides map[string]ToolAccess
+		want      ToolAccess
+	}{
+		{"read verb", mcp.Tool{Name: "alertmanager__list_silences"}, nil, ToolAccessReadOnly},
+		{"post verb", mcp.Tool{Name: "alertmanager__post_silence"}, nil, ToolAccessMutating},
+		{"delete verb", mcp.Tool{Name: "alertmanager__delete_silence"}, nil, ToolAccessMutating},
+		{"post alerts", mcp.Tool{Name: "alertmanager__post_alerts"}, nil, ToolAccessMutating},
+		{"unprefixed grafana tool", mcp.Tool{Name: "update_dashboard"}, nil, ToolAccessMutating},
+		{"query", mcp.Tool{Name: "query_prometheus"}, nil, ToolAccessReadOnly},
+		{"read-only hint wins over name", mcp.Tool{Name: "create_report_preview", Annotations: &mcp.ToolAnnotations{ReadOnlyHint: &yes}}, nil, ToolAccessReadOnly},
+		{"not read-only hint", mcp.Tool{Name: "get_or_create_folder", Annotations: &mcp.ToolAnnotations{ReadOnlyHint: &no}}, nil, ToolAccessMutating},
+		{"destructive hint", mcp.Tool{Name: "purge", Annotations: &mcp.ToolAnnotations{DestructiveHint: &yes}}, nil, ToolAccessMutating},
+		{"override wins", mcp.Tool{Name: "alertmanager__post_silence"}, map[string]ToolAccess{"alertmanager__post_silence": ToolAccessReadOnly}, ToolAccessReadOnly},
+		{"empty name", mcp.Tool{Name: "__"}, nil, ToolAccessReadOnly},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyTool(tt.tool, tt.overrides); got != tt.want {
+				t.Errorf("classifyTool(%s) = %s, want %s", tt.tool.Name, got, tt.want)
+			}
+		})
+	}
+}
+
+// newApprovalTestManager returns a manager whose model asks for one silence and then answers
+func newApprovalTestManager(t *testing.T) (*Manager, *fakeLLMServer) {
+	server := newFakeLLMServer(t,
+		fakeStep{toolCalls: []openai.ToolCall{toolCall("call_1", "alertmanager__post_silence", `{"matcher":"job=api"}`)}},
+		fakeStep{content: "Done."},
+	)
+	manager := newTestManager(t, server, ManagerConfig{})
+	manager.currentTools().mutating = map[string]bool{"alertmanager__post_silence": true}
+	return manager, server
+}
+
+// approveWhenAsked resolves the first approval_required event with the given decision
+func approveWhenAsked(t *testing.T, manager *Manager, user User, approved bool, chunks <-chan llm.StreamChunk) []llm.StreamChunk {
+	var collected []llm.StreamChunk
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return collected
+			}
+			collected = append(collected, chunk)
+			if chunk.Type == "approval_required" {
+				if err := manager.ResolveApproval(chunk.ApprovalID, user, approved); err != nil {
+					t.Fatalf("ResolveApproval() error = %v", err)
+				}
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for stream to finish")
+		}
+	}
+}
+
+func TestMutatingToolRunsAfterApproval(t *testing.T) {
+	manager, _ := newApprovalTestManager(t)
+
+	var executed []string
+	execute := func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		executed = append(executed, name)
+		return mcp.NewTextResult("silence created"), nil
+	}
+
+	chunks, err := manager.RunChatStream(context.Background(), "Silence the api alerts", "s1", testUser, execute)
+	if err != nil {
+		t.Fatalf("RunChatStream() error = %v", err)
+	}
+	collected := approveWhenAsked(t, manager, testUser, true, chunks)
+
+	wantTypes := []string{"start", "approval_required", "tool_start", "tool_result", "token", "complete", "done"}
+	if got := chunkTypes(collected); fmt.Sprint(got) != fmt.Sprint(wantTypes) {
+		t.Fatalf("chunk types = %v, want %v", got, wantTypes)
+	}
+
+	approval := collected[1]
+	if approval.Tool != "alertmanager__post_silence" || approval.ToolCallID != "call_1" || approval.Arguments["matcher"] != "job=api" || approval.ApprovalID == "" {
+		t.Errorf("approval_required chunk = %+v", approval)
+	}
+	if len(executed) != 1 {
+		t.Errorf("executed = %v, want the approved call", executed)
+	}
+	if collected[3].Result != "silence created" {
+		t.Errorf("tool_result = %v, want the tool output", collected[3].Result)
+	}
+
+	// An approval can only be used once
+	if err := manager.ResolveApproval(approval.ApprovalID, testUser, true); err != ErrApprovalNotFound {
+		t.Errorf("second ResolveApproval() error = %v, want ErrApprovalNotFound", err)
+	}
+}
+
+func TestMutatingToolRejected(t *testing.T) {
+	manager, server := newApprovalTestManager(t)
+
+	execute := func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		t.Errorf("rejected tool %s was executed", name)
+		return mcp.NewTextResult(""), nil
+	}
+
+	chunks, err := manager.RunChatStream(context.Background(), "Silence the api alerts", "s1", testUser, execute)
+	if err != nil {
+		t.Fatalf("RunChatStream() error = %v", err)
+	}
+	collected := approveWhenAsked(t, manager, testUser, false, chunks)
+
+	result := fmt.Sprint(collected[3].Result)
+	if collected[3].Type != "tool_result" || !strings.Contains(result, "rejected") {
+		t.Errorf("tool_result chunk = %+v, want a rejection", collected[3])
+	}
+
+	// The model is told the call was rejected
+	followUp := server.recorded()[1].Messages
+	if tool := followUp[len(followUp)-1]; !strings.Contains(tool.Content, "rejected") {
+		t.Errorf("tool message = %q, want a rejection", tool.Content)
+	}
+}
+
+func TestMutatingToolApprovalTimesOut(t *testing.T) {
+	manager, _ := newApprovalTestManager(t)
+	manager.approvalTimeout = 10 * time.Millisecond
+
+	chunks, err := manager.RunChatStream(context.Background(), "Silence the api alerts", "s1", testUser, nil)
+	if err != nil {
+		t.Fatalf("RunChatStream() error = %v", err)
+	}
+	collected := collectChunks(t, chunks)
+
+	if len(collected) < 4 || !strings.Contains(fmt.Sprint(collected[3].Result), "did not approve it in time") {
+		t.Errorf("chunks = %+v, want a timed-out tool_result", collected)
+	}
+}
+
+func TestOnlyTheRequestingUserCanApprove(t *testing.T) {
+	manager, _ := newApprovalTestManager(t)
+
+	chunks, err := manager.RunChatStream(context.Background(), "Silence the api alerts", "s1", testUser, nil)
+	if err != nil {
+		t.Fatalf("RunChatStream() error = %v", err)
+	}
+
+	var approvalID string
+	for chunk := range chunks {
+		if chunk.Type == "approval_required" {
+			approvalID = chunk.ApprovalID
+			break
+		}
+	}
+
+	if err := manager.ResolveApproval(approvalID, User{Login: "mallory", IsAdmin: true}, true); err != ErrApprovalForbidden {
+		t.Errorf("ResolveApproval() by another user error = %v, want ErrApprovalForbidden", err)
+	}
+	if err := manager.ResolveApproval(approvalID, testUser, false); err != nil {
+		t.Errorf("ResolveApproval() by the owner error = %v", err)
+	}
+	collectChunks(t, chunks)
+}
+
+func TestRunChatDoesNotRunMutatingTools(t *testing.T) {
+	manager, _ := newApprovalTestManager(t)
+
+	execute := func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		t.Errorf("mutating tool %s was executed without approval", name)
+		return mcp.NewTextResult(""), nil
+	}
+
+	result, err := manager.RunChat(context.Background(), "Silence the api alerts", "s1", testUser, execute)
+	if err != nil {
+		t.Fatalf("RunChat() error = %v", err)
+	}
+	if len(result.ToolCalls) != 1 || !strings.Contains(result.ToolCalls[0].Result, "approval") {
+		t.Errorf("tool calls = %+v, want the call refused", result.ToolCalls)
+	}
+}
@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// contextBudget returns the most tokens a request to model may use and the
+// counter for the model's encoding. Turns may switch models, so each LLM step
+// is measured against the model it is sent to.
+func (m *Manager) contextBudget(model string) (int, *llm.TokenCounter) {
+	window := m.contextWindow
+	if window <= 0 {
+		window = llm.ContextWindow(model)
+	}
+	return int(float64(window) * m.contextShare), m.tokenCounter(model)
+}
+
+// tokenCounter returns the token counter for a model's encoding
+func (m *Manager) tokenCounter(model string) *llm.TokenCounter {
+	m.tokenCountersMu.Lock()
+	defer m.tokenCountersMu.Unlock()
+
+	if counter, ok := m.tokenCounters[model]; ok {
+		return counter
+	}
+
+	counter, err := llm.NewTokenCounter(model)
+	if err != nil {
+		// Measure with the default model's encoding, loaded when the manager was created
+		log.DefaultLogger.Warn("Failed to load token encoding", "model", model, "error", err)
+		counter = m.tokenCounters[m.llmClient.Model()]
+	}
+	m.tokenCounters[model] = counter
+	return counter
+}
+
+// fitToContext drops the oldest history from a request until the system prompt,
+// tool definitions and messages together fit the context budget of the model the
+// request goes to (set with llm.WithModel on ctx).
+// The system prompt, the conversation summary and the current turn (the latest
+// user message and everything after it) are always kept.
+func (m *Manager) fitToContext(ctx context.Context, messages []openai.ChatCompletionMessage, tools []openai.Tool) []openai.ChatCompletionMessage {
+	budget, counter := m.contextBudget(m.llmClient.ModelFor(ctx))
+
+	used := counter.CountTools(tools) + counter.CountMessages(messages)
+	if used <= budget {
+		return messages
+	}
+
+	// Leading system messages (prompt and summary) are never dropped
+	head := 1
+	for head < len(messages) && messages[head].Role == openai.ChatMessageRoleSystem {
+		head++
+	}
+
+	keepFrom := len(messages) - 1
+	for i := len(messages) - 1; i >= head; i-- {
+		if messages[i].Role == openai.ChatMessageRoleUser {
+			keepFrom = i
+			break
+		}
+	}
+
+	start := head
+	for used > budget && start < keepFrom {
+		used -= counter.CountMessage(messages[start])
+		start++
+
+		// Tool results are dropped together with the call that requested them
+		for start < keepFrom && messages[start].Role == openai.ChatMessageRoleTool {
+			used -= counter.CountMessage(messages[start])
+			start++
+		}
+	}
+
+	if used > budget {
+		log.DefaultLogger.Warn("Request exceeds the context budget after trimming history", "tokens", used, "budget", budget)
+	} else {
+		log.DefaultLogger.Debug("Trimmed history to fit the context budget", "dropped", start-head, "tokens", used, "budget", budget)
+	}
+
+	trimmed := make([]openai.ChatCompletionMessage, 0, head+len(messages)-start)
+	trimmed = append(trimmed, messages[:head]...)
+	return append(trimmed, messages[start:]...)
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestFitToContextKeepsRequestsUnderBudget(t *testing.T) {
+	server := newFakeLLMServer(t, fakeStep{content: "Still healthy."})
+	manager := newTestManager(t, server, ManagerConfig{ContextWindow: 10000, ContextBudget: 0.5})
+
+	memory, err := manager.getOrCreateMemory("s1", testUser)
+	if err != nil {
+		t.Fatalf("getOrCreateMemory() error = %v", err)
+	}
+
+	// Early history far larger than the budget, including a tool exchange
+	filler := strings.Repeat("lorem ipsum ", 1000)
+	memory.AddMessage("user", "First question "+filler)
+	memory.AddToolExchange("", []ToolInvocation{{ID: "call_1", Tool: "query_prometheus", Arguments: map[string]interface{}{"query": "up"}, Result: filler}})
+	memory.AddMessage("assistant", "First answer "+filler)
+
+	if _, err := manager.RunChat(context.Background(), "Is it still healthy?", "s1", testUser, nil); err != nil {
+		t.Fatalf("RunChat() error = %v", err)
+	}
+
+	req := server.recorded()[0]
+	_, counter := manager.contextBudget(llm.ModelLarge)
+	if used := counter.CountTools(req.Tools) + counter.CountMessages(req.Messages); used > 5000 {
+		t.Errorf("request uses %d tokens, want at most 5000", used)
+	}
+	if len(req.Messages) >= 6 {
+		t.Errorf("request has %d messages, want early history dropped", len(req.Messages))
+	}
+	if req.Messages[0].Role != openai.ChatMessageRoleSystem {
+		t.Errorf("first message role = %q, want system", req.Messages[0].Role)
+	}
+	if last := req.Messages[len(req.Messages)-1]; last.Content != "Is it still healthy?" {
+		t.Errorf("last message = %q, want the current question", last.Content)
+	}
+	for _, msg := range req.Messages[1:] {
+		if msg.Role == openai.ChatMessageRoleTool {
+			t.Errorf("request kept tool result %q without its call", msg.ToolCallID)
+		}
+	}
+
+	// Memory itself is untouched; only the request is trimmed
+	if got := len(memory.GetMessages()); got != 6 {
+		t.Errorf("memory has %d messages, want 6", got)
+	}
+}
+
+func TestFitToContextLeavesSmallRequestsAlone(t *testing.T) {
+	manager := newTestManager(t, newFakeLLMServer(t), ManagerConfig{})
+
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "You are helpful."},
+		{Role: openai.ChatMessageRoleUser, Content: "Hi"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "Hello"},
+		{Role: openai.ChatMessageRoleUser, Content: "How are things?"},
+	}
+
+	if got := manager.fitToContext(context.Background(), messages, manager.currentTools().tools); len(got) != len(messages) {
+		t.Errorf("fitToContext() kept %d messages, want %d", len(got), len(messages))
+	}
+	if budget, _ := manager.contextBudget(llm.ModelLarge); budget != int(128000*DefaultContextBudget) {
+		t.Errorf("contextBudget() = %d, want %d", budget, int(128000*DefaultContextBudget))
+	}
+}
+
+func TestFitToContextUsesTheTurnModel(t *testing.T) {
+	server := newFakeLLMServer(t, fakeStep{content: "Fine."}, fakeStep{content: "Fine."})
+	manager := newTestManager(t, server, ManagerConfig{})
+
+	if budget, _ := manager.contextBudget("gpt-4"); budget != 6553 {
+		t.Errorf("contextBudget(gpt-4) = %d, want 6553 (80%% of 8192)", budget)
+	}
+
+	memory, err := manager.getOrCreateMemory("s1", testUser)
+	if err != nil {
+		t.Fatalf("getOrCreateMemory() error = %v", err)
+	}
+	// About 10000 tokens: within the large model's window, beyond gpt-4's
+	memory.AddMessage("user", "First question "+strings.Repeat("lorem ipsum ", 5000))
+	memory.AddMessage("assistant", "First answer")
+
+	if _, err := manager.RunChat(context.Background(), "Still fine?", "s1", testUser, nil); err != nil {
+		t.Fatalf("RunChat() error = %v", err)
+	}
+	if _, err := manager.RunChat(llm.WithModel(context.Background(), "gpt-4"), "Still fine?", "s1", testUser, nil); err != nil {
+		t.Fatalf("RunChat() error = %v", err)
+	}
+
+	requests := server.recorded()
+	if len(requests) != 2 {
+		t.Fatalf("LLM received %d requests, want 2", len(requests))
+	}
+	if !strings.HasPrefix(requests[0].Messages[1].Content, "First question") {
+		t.Error("request to the large model dropped history that fits its window")
+	}
+	for _, msg := range requests[1].Messages {
+		if strings.HasPrefix(msg.Content, "First question") {
+			t.Error("request to gpt-4 kept history beyond its window")
+		}
+	}
+}
@@ -2,87 +2,508 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
 	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
 	"github.com/sashabaranov/go-openai"
 )
 
+// DefaultMaxToolIterations is the default number of tool-calling rounds per chat turn
+const DefaultMaxToolIterations = 10
+
+// toolLimitMessage answers a turn whose model still asked for tools after the
+// tool-calling rounds ran out, without saying anything itself
+const toolLimitMessage = "I reached the limit of tool calls for one question before finding an answer. Try narrowing the question, or ask me to continue."
+
+// DefaultContextBudget is the default share of the model's context window a request
+// may use; the rest is left for the model's reply
+const DefaultContextBudget = 0.8
+
+// ToolExecutor runs a tool call and returns the MCP result
+type ToolExecutor func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error)
+
+// ManagerConfig holds configuration for the agent manager
+type ManagerConfig struct {
+	MaxToolIterations int                   // Maximum tool-calling rounds per chat turn (0 = default)
+	SessionStore      SessionStore          // Where session history is persisted (nil = in-memory)
+	ContextWindow     int                   // Model context window in tokens (0 = known window of the model)
+	ContextBudget     float64               // Share of the context window a request may use (0 = default)
+	SummarizeHistory  bool                  // Summarize messages trimmed from history instead of dropping them
+	ToolAccess        map[string]ToolAccess // Per-tool overrides of the read-only/mutating classification
+	ApprovalTimeout   time.Duration         // How long a mutating tool call waits for approval (0 = default)
+	ToolPolicy        ToolPolicy            // Which tools are offered and who may run them
+	ServerPrompts     map[string]string     // MCP server -> text added to the system prompt
+}
+
 // Manager handles agent orchestration and LLM interaction
 type Manager struct {
-	llmClient       *llm.LLMClient
-	tools           []openai.Tool
-	sessionMemories map[string]*ConversationMemory
-	systemPrompt    string
-	mu              sync.RWMutex
+	llmClient         *llm.LLMClient
+	mcpClients        map[string]*mcp.Client
+	mcpTypes          []string
+	serverPrompts     map[string]string
+	toolAccess        map[string]ToolAccess
+	toolset           atomic.Pointer[toolset] // Replaced whenever the MCP tools change
+	toolsMu           sync.Mutex              // Serializes toolset rebuilds
+	sessions          map[string]*session
+	sessionStore      SessionStore
+	maxToolIterations int
+	contextWindow     int                          // Configured context window in tokens (0 = known window of each model)
+	contextShare      float64                      // Share of the context window a request may use
+	tokenCounters     map[string]*llm.TokenCounter // By model, created when first used
+	tokenCountersMu   sync.Mutex
+	summarizeHistory  bool
+	toolPolicy        ToolPolicy
+	approvals         map[string]*pendingApproval
+	approvalTimeout   time.Duration
+	mu                sync.RWMutex
 }
 
-// NewManager creates a new agent manager
+// NewManager creates a new agent manager with default configuration
 func NewManager(llmClient *llm.LLMClient, mcpClients map[string]*mcp.Client, mcpTypes []string) (*Manager, error) {
-	// Build system prompt based on available MCP types
-	systemPrompt := BuildSystemPrompt(mcpTypes)
+	return NewManagerWithConfig(llmClient, mcpClients, mcpTypes, ManagerConfig{})
+}
+
+// NewManagerWithConfig creates a new agent manager with custom configuration
+func NewManagerWithConfig(llmClient *llm.LLMClient, mcpClients map[string]*mcp.Client, mcpTypes []string, config ManagerConfig) (*Manager, error) {
+	if config.MaxToolIterations <= 0 {
+		config.MaxToolIterations = DefaultMaxToolIterations
+	}
+	if config.SessionStore == nil {
+		config.SessionStore = NewInMemorySessionStore()
+	}
+	if config.ApprovalTimeout <= 0 {
+		config.ApprovalTimeout = DefaultApprovalTimeout
+	}
+	if config.ContextBudget <= 0 || config.ContextBudget > 1 {
+		config.ContextBudget = DefaultContextBudget
+	}
+
+	// The default model's encoding is loaded up front, so a broken setup fails here
+	model := ""
+	if llmClient != nil {
+		model = llmClient.Model()
+	}
+	tokenCounter, err := llm.NewTokenCounter(model)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		llmClient:         llmClient,
+		mcpClients:        mcpClients,
+		mcpTypes:          mcpTypes,
+		serverPrompts:     config.ServerPrompts,
+		toolAccess:        config.ToolAccess,
+		sessions:          make(map[string]*session),
+		sessionStore:      config.SessionStore,
+		maxToolIterations: config.MaxToolIterations,
+		contextWindow:     config.ContextWindow,
+		contextShare:      config.ContextBudget,
+		tokenCounters:     map[string]*llm.TokenCounter{model: tokenCounter},
+		summarizeHistory:  config.SummarizeHistory,
+		toolPolicy:        config.ToolPolicy,
+		approvals:         make(map[string]*pendingApproval),
+		approvalTimeout:   config.ApprovalTimeout,
+	}
+	m.refreshTools(context.Background())
 
-	// Convert MCP tools to OpenAI format
-	tools := convertMCPToolsToOpenAI(mcpClients)
+	// Rebuild the tools as soon as a server reports a change instead of waiting for the next chat
+	for _, client := range mcpClients {
+		client.OnToolsChanged(func() { m.refreshTools(context.Background()) })
+	}
 
-	return &Manager{
-		llmClient:       llmClient,
-		tools:           tools,
-		sessionMemories: make(map[string]*ConversationMemory),
-		systemPrompt:    systemPrompt,
-	}, nil
+	return m, nil
 }
 
-// RunChat executes a chat interaction (non-streaming)
-func (m *Manager) RunChat(ctx context.Context, userMessage, sessionID string) (string, error) {
-	memory := m.getOrCreateMemory(sessionID)
+// ToolInvocation records a tool call made during a chat turn and its result.
+// Result is the text the model sees; Output is the full MCP result, when the tool ran.
+type ToolInvocation struct {
+	ID        string                 `json:"id"`
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Result    string                 `json:"result"`
+	Output    *mcp.ToolResult        `json:"output,omitempty"`
+}
+
+// ChatResult is the outcome of a non-streaming chat turn
+type ChatResult struct {
+	Response  string
+	ToolCalls []ToolInvocation
+	Model     string // Model that produced the response
+}
+
+// RunChat executes a chat interaction (non-streaming).
+// Tool calls requested by the model are run with execute and their results fed
+// back to the model until it produces a final answer. Mutating tools are not run
+// because there is no way to ask for approval without a stream.
+func (m *Manager) RunChat(ctx context.Context, userMessage, sessionID string, user User, execute ToolExecutor) (*ChatResult, error) {
+	memory, err := m.getOrCreateMemory(sessionID, user)
+	if err != nil {
+		return nil, err
+	}
+
+	model, toolsModel := m.turnModels(ctx, userMessage)
+	ctx = llm.WithModel(ctx, model)
 
 	// Add user message to memory
 	memory.AddMessage("user", userMessage)
+	m.saveSession(sessionID, memory)
+	m.summarizeEvicted(ctx, sessionID, memory)
+
+	// Pick up tools whose cache expired since the last turn
+	m.refreshTools(ctx)
 
 	// Build messages for API call
 	messages := m.buildMessages(memory)
 
-	// Call LLM via Grafana LLM App
-	response, err := m.llmClient.Chat(ctx, messages, m.tools)
-	if err != nil {
-		return "", fmt.Errorf("OpenAI chat failed: %w", err)
+	result := &ChatResult{Model: model}
+	tools := m.toolsFor(user)
+
+	for iteration := 1; ; iteration++ {
+		// Call LLM via Grafana LLM App
+		reply, err := m.llmClient.Chat(ctx, m.fitToContext(ctx, messages, tools), tools)
+		if err != nil {
+			return nil, fmt.Errorf("OpenAI chat failed: %w", err)
+		}
+
+		// Past the cap, tool calls the model still makes are not run
+		if len(reply.ToolCalls) > 0 && iteration > m.maxToolIterations {
+			log.DefaultLogger.Warn("Model requested tools after the tool-calling limit", "session", sessionID, "limit", m.maxToolIterations)
+			reply.ToolCalls = nil
+			if reply.Content == "" {
+				reply.Content = toolLimitMessage
+			}
+		}
+
+		// No tool calls means the model has produced its final answer
+		if len(reply.ToolCalls) == 0 {
+			result.Response = reply.Content
+			break
+		}
+
+		calls := make([]ToolInvocation, 0, len(reply.ToolCalls))
+		for _, tc := range reply.ToolCalls {
+			call := ToolInvocation{ID: tc.ID, Tool: tc.Function.Name}
+			if err := parseToolArguments(tc.Function.Arguments, &call.Arguments); err != nil {
+				call.Result = fmt.Sprintf("Error: invalid tool arguments: %v", err)
+			} else if err := m.CanUseTool(call.Tool, user); err != nil {
+				call.Result = fmt.Sprintf("Error: %v", err)
+			} else if m.requiresApproval(call.Tool) {
+				call.Result = fmt.Sprintf("Error: %s changes state and needs the user's approval, which is only available in the streaming chat", call.Tool)
+			} else {
+				call.Result, call.Output = runToolCall(ctx, execute, call)
+			}
+			calls = append(calls, call)
+		}
+
+		memory.AddToolExchange(reply.Content, calls)
+		m.saveSession(sessionID, memory)
+		m.summarizeEvicted(ctx, sessionID, memory)
+		messages = m.buildMessages(memory)
+		result.ToolCalls = append(result.ToolCalls, calls...)
+
+		ctx = llm.WithModel(ctx, toolsModel)
+		result.Model = toolsModel
+
+		// Once the iteration budget is spent, withhold tools so the model must answer
+		if iteration >= m.maxToolIterations {
+			tools = nil
+		}
 	}
 
 	// Add assistant response to memory
-	memory.AddMessage("assistant", response)
+	memory.AddMessage("assistant", result.Response)
+	m.saveSession(sessionID, memory)
 
-	return response, nil
+	return result, nil
 }
 
-// RunChatStream executes a streaming chat interaction
-func (m *Manager) RunChatStream(ctx context.Context, userMessage, sessionID string) (<-chan llm.StreamChunk, error) {
-	memory := m.getOrCreateMemory(sessionID)
+// RunChatStream executes a streaming chat interaction.
+// Tool calls requested by the model are run with execute and their results fed
+// back to the model until it produces a final answer. Every step is reported on
+// the returned channel as tool_start, tool_result and token events. Mutating
+// tools pause the run with an approval_required event until ResolveApproval
+// is called by the same user.
+func (m *Manager) RunChatStream(ctx context.Context, userMessage, sessionID string, user User, execute ToolExecutor) (<-chan llm.StreamChunk, error) {
+	memory, err := m.getOrCreateMemory(sessionID, user)
+	if err != nil {
+		return nil, err
+	}
+
+	model, toolsModel := m.turnModels(ctx, userMessage)
+	ctx = llm.WithModel(ctx, model)
 
 	// Add user message to memory
 	memory.AddMessage("user", userMessage)
+	m.saveSession(sessionID, memory)
+	m.summarizeEvicted(ctx, sessionID, memory)
+
+	// Pick up tools whose cache expired since the last turn
+	m.refreshTools(ctx)
 
 	// Build messages for API call
 	messages := m.buildMessages(memory)
 
-	// Start streaming
-	return m.llmClient.StreamChat(ctx, messages, m.tools)
+	// Start the first step here so startup failures reach the caller directly
+	tools := m.toolsFor(user)
+	stepChunks, err := m.llmClient.StreamChat(ctx, m.fitToContext(ctx, messages, tools), tools)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan llm.StreamChunk, 100)
+	go m.runStreamLoop(ctx, sessionID, user, memory, stepChunks, execute, toolsModel, out)
+
+	return out, nil
 }
 
-// getOrCreateMemory retrieves or creates a conversation memory for a session
-func (m *Manager) getOrCreateMemory(sessionID string) *ConversationMemory {
+// runStreamLoop drives the tool-calling loop for a streaming chat turn; steps
+// after tool calls use toolsModel
+func (m *Manager) runStreamLoop(ctx context.Context, sessionID string, user User, memory *ConversationMemory, stepChunks <-chan llm.StreamChunk, execute ToolExecutor, toolsModel string, out chan<- llm.StreamChunk) {
+	defer close(out)
+
+	send := func(chunk llm.StreamChunk) bool {
+		select {
+		case out <- chunk:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	if !send(llm.StreamChunk{Type: "start", Model: m.llmClient.ModelFor(ctx)}) {
+		return
+	}
+
+	for iteration := 1; ; iteration++ {
+		content, toolCalls, completed := forwardStep(stepChunks, send)
+		if !completed {
+			return
+		}
+
+		// Past the cap, tool calls the model still makes are not run
+		if len(toolCalls) > 0 && iteration > m.maxToolIterations {
+			log.DefaultLogger.Warn("Model requested tools after the tool-calling limit", "session", sessionID, "limit", m.maxToolIterations)
+			toolCalls = nil
+			if content == "" {
+				content = toolLimitMessage
+				if !send(llm.StreamChunk{Type: "token", Message: content}) {
+					return
+				}
+			}
+		}
+
+		// No tool calls means the model has produced its final answer
+		if len(toolCalls) == 0 {
+			memory.AddMessage("assistant", content)
+			m.saveSession(sessionID, memory)
+			if send(llm.StreamChunk{Type: "complete", Message: content, Model: m.llmClient.ModelFor(ctx)}) {
+				send(llm.StreamChunk{Type: "done"})
+			}
+			return
+		}
+
+		for i := range toolCalls {
+			call := &toolCalls[i]
+
+			// A call whose arguments could not be parsed already holds the error for the model
+			invalid := call.Result != ""
+
+			decision := approvalGranted
+			permission := m.CanUseTool(call.Tool, user)
+			if !invalid && permission == nil && m.requiresApproval(call.Tool) {
+				decision = m.awaitApproval(ctx, sessionID, user, *call, send)
+				if decision == approvalAbandoned {
+					return
+				}
+			}
+
+			if !send(llm.StreamChunk{
+				Type:       "tool_start",
+				Tool:       call.Tool,
+				ToolCallID: call.ID,
+				Arguments:  call.Arguments,
+			}) {
+				return
+			}
+
+			switch {
+			case invalid:
+			case permission != nil:
+				call.Result = fmt.Sprintf("Error: %v", permission)
+			case decision == approvalGranted:
+				call.Result, call.Output = runToolCall(ctx, execute, *call)
+			default:
+				call.Result = declinedResult(*call, decision)
+			}
+
+			resultChunk := llm.StreamChunk{
+				Type:       "tool_result",
+				Tool:       call.Tool,
+				ToolCallID: call.ID,
+				Arguments:  call.Arguments,
+				Result:     call.Result,
+			}
+			if call.Output != nil {
+				resultChunk.Output = call.Output
+			}
+			if !send(resultChunk) {
+				return
+			}
+		}
+
+		memory.AddToolExchange(content, toolCalls)
+		m.saveSession(sessionID, memory)
+		m.summarizeEvicted(ctx, sessionID, memory)
+		messages := m.buildMessages(memory)
+
+		// Once the iteration budget is spent, withhold tools so the model must answer
+		tools := m.toolsFor(user)
+		if iteration >= m.maxToolIterations {
+			tools = nil
+		}
+
+		ctx = llm.WithModel(ctx, toolsModel)
+		next, err := m.llmClient.StreamChat(ctx, m.fitToContext(ctx, messages, tools), tools)
+		if err != nil {
+			send(llm.StreamChunk{Type: "error", Message: fmt.Sprintf("LLM request failed: %v", err)})
+			return
+		}
+		stepChunks = next
+	}
+}
+
+// forwardStep relays one LLM step to the client, collecting its content and tool calls.
+// It reports false if the step ended without completing (stream error or cancellation).
+func forwardStep(stepChunks <-chan llm.StreamChunk, send func(llm.StreamChunk) bool) (string, []ToolInvocation, bool) {
+	var content string
+	var toolCalls []ToolInvocation
+	completed := false
+
+	for chunk := range stepChunks {
+		switch chunk.Type {
+		case "token":
+			content += chunk.Message
+			if !send(chunk) {
+				go drain(stepChunks)
+				return content, toolCalls, false
+			}
+		case "tool":
+			call := ToolInvocation{
+				ID:        chunk.ToolCallID,
+				Tool:      chunk.Tool,
+				Arguments: chunk.Arguments,
+			}
+			if chunk.Message != "" {
+				call.Result = "Error: " + chunk.Message // Arguments could not be parsed
+			}
+			toolCalls = append(toolCalls, call)
+		case "error":
+			if !send(chunk) {
+				go drain(stepChunks)
+				return content, toolCalls, false
+			}
+		case "complete":
+			completed = true
+		}
+	}
+
+	return content, toolCalls, completed
+}
+
+// drain discards the rest of an abandoned step so its producer can exit
+func drain(stepChunks <-chan llm.StreamChunk) {
+	for range stepChunks {
+	}
+}
+
+// runToolCall executes a single tool call and formats its result for the model,
+// turning failures into a result the model can read
+func runToolCall(ctx context.Context, execute ToolExecutor, call ToolInvocation) (string, *mcp.ToolResult) {
+	if execute == nil {
+		return "Error: tool execution is not available", nil
+	}
+
+	result, err := execute(ctx, call.Tool, call.Arguments)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
+	return mcp.FormatToolResult(result), result
+}
+
+// parseToolArguments decodes the JSON arguments of a tool call; empty means no arguments
+func parseToolArguments(raw string, args *map[string]interface{}) error {
+	*args = map[string]interface{}{}
+	if raw == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(raw), args)
+}
+
+// getOrCreateMemory retrieves or creates a conversation memory for a session,
+// loading its history from the session store the first time it is used.
+// New sessions are owned by user; existing ones return ErrSessionForbidden
+// unless user owns them or is an org admin.
+func (m *Manager) getOrCreateMemory(sessionID string, user User) (*ConversationMemory, error) {
+	sess, err := m.loadSession(sessionID, user, true)
+	if err != nil {
+		return nil, err
+	}
+	return sess.memory, nil
+}
+
+// saveSession persists a session's history. Failures are logged rather than
+// returned so a storage problem never interrupts a conversation.
+func (m *Manager) saveSession(sessionID string, memory *ConversationMemory) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	var owner, title string
+	sess, cached := m.sessions[sessionID]
+	if cached {
+		owner = sess.owner
+		title = sess.title
+		sess.lastUsed = time.Now()
+	}
+	m.mu.Unlock()
+
+	// A turn idle for long enough may see its session leave the cache; the
+	// record written at the start of the turn still has the owner and title.
+	// Without it the session was deleted mid-turn, and writing it back would
+	// revive it without an owner.
+	if !cached {
+		record, err := m.sessionStore.Load(sessionID)
+		if err != nil {
+			log.DefaultLogger.Warn("Failed to save session", "session", sessionID, "error", err)
+			return
+		}
+		if record == nil {
+			return
+		}
+		owner = record.Owner
+		title = record.Title
+	}
 
-	if mem, ok := m.sessionMemories[sessionID]; ok {
-		return mem
+	stats := memory.GetStats()
+	record := &SessionRecord{
+		ID:        sessionID,
+		Owner:     owner,
+		Title:     title,
+		CreatedAt: stats.CreatedAt,
+		UpdatedAt: stats.UpdatedAt,
+		Messages:  memory.GetMessages(),
+		Summary:   memory.GetSummary(),
+		Evicted:   memory.GetEvicted(),
 	}
 
-	mem := NewConversationMemory()
-	m.sessionMemories[sessionID] = mem
-	return mem
+	if err := m.sessionStore.Save(record); err != nil {
+		log.DefaultLogger.Warn("Failed to save session", "session", sessionID, "error", err)
+	}
 }
 
 // buildMessages constructs the message array for OpenAI API
@@ -90,33 +511,49 @@ func (m *Manager) buildMessages(memory *ConversationMemory) []openai.ChatComplet
 	messages := []openai.ChatCompletionMessage{
 		{
 			Role:    openai.ChatMessageRoleSystem,
-			Content: m.systemPrompt,
+			Content: m.currentTools().systemPrompt,
 		},
 	}
 
-	// Add conversation history
-	for _, msg := range memory.GetMessages() {
+	// Earlier history that was trimmed is replaced by its summary
+	if summary := memory.GetSummary(); summary != "" {
 		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
+			Role:    openai.ChatMessageRoleSystem,
+			Content: SUMMARY_CONTEXT_PREFIX + summary,
 		})
 	}
 
+	// Add conversation history, replaying tool calls and their results
+	for _, msg := range memory.GetMessages() {
+		message := openai.ChatCompletionMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCallID: msg.ToolCallID,
+		}
+
+		for _, call := range msg.ToolCalls {
+			message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+				ID:   call.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      call.Name,
+					Arguments: call.Arguments,
+				},
+			})
+		}
+
+		messages = append(messages, message)
+	}
+
 	return messages
 }
 
 // convertMCPToolsToOpenAI converts MCP tools to OpenAI function format
-func convertMCPToolsToOpenAI(mcpClients map[string]*mcp.Client) []openai.Tool {
+func convertMCPToolsToOpenAI(toolsByServer map[string][]mcp.Tool) []openai.Tool {
 	var tools []openai.Tool
 
-	for _, client := range mcpClients {
-		// Discover tools from each client (cached internally)
-		mcpTools, err := client.DiscoverTools(context.Background())
-		if err != nil {
-			continue
-		}
-
-		for _, mcpTool := range mcpTools {
+	for _, serverType := range sortedServers(toolsByServer) {
+		for _, mcpTool := range toolsByServer[serverType] {
 			// Convert MCP tool to OpenAI function format
 			tool := openai.Tool{
 				Type: openai.ToolTypeFunction,
@@ -132,19 +569,3 @@ func convertMCPToolsToOpenAI(mcpClients map[string]*mcp.Client) []openai.Tool {
 
 	return tools
 }
-
-// AddAssistantResponse adds an assistant response to session memory
-func (m *Manager) AddAssistantResponse(sessionID, response string) {
-	memory := m.getOrCreateMemory(sessionID)
-	memory.AddMessage("assistant", response)
-}
-
-// ClearSession clears the conversation history for a session
-func (m *Manager) ClearSession(sessionID string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if mem, ok := m.sessionMemories[sessionID]; ok {
-		mem.Clear()
-	}
-}
@@ -0,0 +1,488 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+// fakeLLMServer emulates the Grafana LLM App chat completions endpoint.
+// Each request is answered with the next scripted step; requests are recorded.
+type fakeLLMServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	steps    []fakeStep
+	requests []openai.ChatCompletionRequest
+}
+
+// fakeStep is one scripted LLM response: either content or tool calls
+type fakeStep struct {
+	content   string
+	toolCalls []openai.ToolCall
+}
+
+func newFakeLLMServer(t *testing.T, steps ...fakeStep) *fakeLLMServer {
+	f := &fakeLLMServer{steps: steps}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/plugins/grafana-llm-app/resources/llm/v1/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var req openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode LLM request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		f.mu.Lock()
+		f.requests = append(f.requests, req)
+		index := len(f.requests) - 1
+		f.mu.Unlock()
+
+		if index >= len(f.steps) {
+			t.Errorf("unexpected LLM request #%d", index+1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		step := f.steps[index]
+
+		if req.Stream {
+			writeStreamStep(w, step)
+			return
+		}
+		writeStep(w, step)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func writeStep(w http.ResponseWriter, step fakeStep) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{
+			Message: openai.ChatCompletionMessage{
+				Role:      openai.ChatMessageRoleAssistant,
+				Content:   step.content,
+				ToolCalls: step.toolCalls,
+			},
+		}},
+	})
+}
+
+func writeStreamStep(w http.ResponseWriter, step fakeStep) {
+	w.Header().Set("Content-Type", "text/event-stream")
+
+	writeDelta := func(delta openai.ChatCompletionStreamChoiceDelta) {
+		data, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			Choices: []openai.ChatCompletionStreamChoice{{Delta: delta}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+
+	if step.content != "" {
+		writeDelta(openai.ChatCompletionStreamChoiceDelta{Content: step.content})
+	}
+	for i, tc := range step.toolCalls {
+		index := i
+		tc.Index = &index
+		writeDelta(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{tc}})
+	}
+
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func (f *fakeLLMServer) recorded() []openai.ChatCompletionRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]openai.ChatCompletionRequest(nil), f.requests...)
+}
+
+// testUser is the session owner used by tests that don't exercise access control
+var testUser = User{Login: "alice", Role: RoleEditor}
+
+func newTestManager(t *testing.T, server *fakeLLMServer, config ManagerConfig) *Manager {
+	llmClient, err := llm.NewLLMClient(server.URL, "test-key")
+	if err != nil {
+		t.Fatalf("NewLLMClient() error = %v", err)
+	}
+
+	manager, err := NewManagerWithConfig(llmClient, nil, nil, config)
+	if err != nil {
+		t.Fatalf("NewManagerWithConfig() error = %v", err)
+	}
+
+	manager.toolset.Store(&toolset{
+		tools: []openai.Tool{{
+			Type:     openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{Name: "query_prometheus"},
+		}},
+		systemPrompt: manager.currentTools().systemPrompt,
+	})
+	return manager
+}
+
+func toolCall(id, name, args string) openai.ToolCall {
+	return openai.ToolCall{
+		ID:       id,
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: name, Arguments: args},
+	}
+}
+
+func collectChunks(t *testing.T, chunks <-chan llm.StreamChunk) []llm.StreamChunk {
+	var collected []llm.StreamChunk
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return collected
+			}
+			collected = append(collected, chunk)
+		case <-timeout:
+			t.Fatal("timed out waiting for stream to finish")
+		}
+	}
+}
+
+func chunkTypes(chunks []llm.StreamChunk) []string {
+	types := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		types[i] = chunk.Type
+	}
+	return types
+}
+
+func TestRunChatStreamFeedsToolResultsBack(t *testing.T) {
+	server := newFakeLLMServer(t,
+		fakeStep{toolCalls: []openai.ToolCall{toolCall("call_1", "query_prometheus", `{"query":"up"}`)}},
+		fakeStep{content: "All targets are up."},
+	)
+	manager := newTestManager(t, server, ManagerConfig{})
+
+	var executed []string
+	execute := func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		executed = append(executed, fmt.Sprintf("%s(%v)", name, args["query"]))
+		return mcp.NewTextResult("up=1"), nil
+	}
+
+	chunks, err := manager.RunChatStream(context.Background(), "Are my targets up?", "s1", testUser, execute)
+	if err != nil {
+		t.Fatalf("RunChatStream() error = %v", err)
+	}
+	collected := collectChunks(t, chunks)
+
+	wantTypes := []string{"start", "tool_start", "tool_result", "token", "complete", "done"}
+	gotTypes := chunkTypes(collected)
+	if fmt.Sprint(gotTypes) != fmt.Sprint(wantTypes) {
+		t.Fatalf("chunk types = %v, want %v", gotTypes, wantTypes)
+	}
+
+	if len(executed) != 1 || executed[0] != "query_prometheus(up)" {
+		t.Errorf("executed tools = %v, want [query_prometheus(up)]", executed)
+	}
+
+	if collected[2].Result != "up=1" || collected[2].ToolCallID != "call_1" {
+		t.Errorf("tool_result chunk = %+v, want result up=1 for call_1", collected[2])
+	}
+	if output, ok := collected[2].Output.(*mcp.ToolResult); !ok || output.Content[0].Text != "up=1" {
+		t.Errorf("tool_result output = %#v, want the tool's MCP result", collected[2].Output)
+	}
+
+	requests := server.recorded()
+	if len(requests) != 2 {
+		t.Fatalf("LLM requests = %d, want 2", len(requests))
+	}
+
+	// Second request must carry the assistant tool call and the matching tool result
+	followUp := requests[1].Messages
+	if len(followUp) != 4 {
+		t.Fatalf("follow-up messages = %d, want 4 (system, user, assistant, tool)", len(followUp))
+	}
+	assistant := followUp[2]
+	if assistant.Role != openai.ChatMessageRoleAssistant || len(assistant.ToolCalls) != 1 || assistant.ToolCalls[0].ID != "call_1" {
+		t.Errorf("assistant message = %+v, want tool call call_1", assistant)
+	}
+	tool := followUp[3]
+	if tool.Role != openai.ChatMessageRoleTool || tool.ToolCallID != "call_1" || tool.Content != "up=1" {
+		t.Errorf("tool message = %+v, want result up=1 for call_1", tool)
+	}
+
+	// Tool exchange and final answer are kept in session memory
+	memory, err := manager.getOrCreateMemory("s1", testUser)
+	if err != nil {
+		t.Fatalf("getOrCreateMemory() error = %v", err)
+	}
+	messages := memory.GetMessages()
+	if len(messages) != 4 {
+		t.Fatalf("memory messages = %d, want 4 (user, assistant, tool, assistant)", len(messages))
+	}
+	if messages[1].ToolCalls[0].ID != "call_1" || messages[2].ToolCallID != "call_1" {
+		t.Errorf("memory tool exchange = %+v, %+v, want call_1 pair", messages[1], messages[2])
+	}
+	if last := messages[3]; last.Role != "assistant" || last.Content != "All targets are up." {
+		t.Errorf("last memory message = %+v, want final assistant answer", last)
+	}
+}
+
+func TestBuildMessagesReplaysToolExchanges(t *testing.T) {
+	server := newFakeLLMServer(t)
+	manager := newTestManager(t, server, ManagerConfig{})
+
+	memory, err := manager.getOrCreateMemory("s1", testUser)
+	if err != nil {
+		t.Fatalf("getOrCreateMemory() error = %v", err)
+	}
+	memory.AddMessage("user", "Are my targets up?")
+	memory.AddToolExchange("", []ToolInvocation{
+		{ID: "call_1", Tool: "query_prometheus", Arguments: map[string]interface{}{"query": "up"}, Result: "up=1"},
+	})
+	memory.AddMessage("assistant", "Yes.")
+
+	messages := manager.buildMessages(memory)
+	if len(messages) != 5 {
+		t.Fatalf("messages = %d, want 5", len(messages))
+	}
+
+	call := messages[2].ToolCalls[0]
+	if call.ID != "call_1" || call.Type != openai.ToolTypeFunction || call.Function.Name != "query_prometheus" || call.Function.Arguments != `{"query":"up"}` {
+		t.Errorf("replayed tool call = %+v", call)
+	}
+	if messages[3].Role != openai.ChatMessageRoleTool || messages[3].ToolCallID != "call_1" || messages[3].Content != "up=1" {
+		t.Errorf("replayed tool result = %+v", messages[3])
+	}
+}
+
+func TestRunChatStreamToolErrorIsReportedToModel(t *testing.T) {
+	server := newFakeLLMServer(t,
+		fakeStep{toolCalls: []openai.ToolCall{toolCall("call_1", "query_prometheus", `{}`)}},
+		fakeStep{content: "The query failed."},
+	)
+	manager := newTestManager(t, server, ManagerConfig{})
+
+	execute := func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		return nil, fmt.Errorf("datasource unavailable")
+	}
+
+	chunks, err := manager.RunChatStream(context.Background(), "Query", "s1", testUser, execute)
+	if err != nil {
+		t.Fatalf("RunChatStream() error = %v", err)
+	}
+	collectChunks(t, chunks)
+
+	requests := server.recorded()
+	if len(requests) != 2 {
+		t.Fatalf("LLM requests = %d, want 2", len(requests))
+	}
+	toolMessage := requests[1].Messages[3]
+	if toolMessage.Content != "Error: datasource unavailable" {
+		t.Errorf("tool message content = %q, want error text", toolMessage.Content)
+	}
+}
+
+func TestRunChatStreamInvalidArgumentsAreReportedToModel(t *testing.T) {
+	server := newFakeLLMServer(t,
+		fakeStep{toolCalls: []openai.ToolCall{toolCall("call_1", "query_prometheus", `{"query": "up"`)}},
+		fakeStep{content: "Let me fix the query."},
+	)
+	manager := newTestManager(t, server, ManagerConfig{})
+
+	executed := 0
+	execute := func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		executed++
+		return mcp.NewTextResult("up=1"), nil
+	}
+
+	chunks, err := manager.RunChatStream(context.Background(), "Query", "s1", testUser, execute)
+	if err != nil {
+		t.Fatalf("RunChatStream() error = %v", err)
+	}
+	collected := collectChunks(t, chunks)
+
+	wantTypes := []string{"start", "tool_start", "tool_result", "token", "complete", "done"}
+	if gotTypes := chunkTypes(collected); fmt.Sprint(gotTypes) != fmt.Sprint(wantTypes) {
+		t.Fatalf("chunk types = %v, want %v", gotTypes, wantTypes)
+	}
+	if executed != 0 {
+		t.Errorf("tool ran %d times with unparseable arguments", executed)
+	}
+
+	requests := server.recorded()
+	if len(requests) != 2 {
+		t.Fatalf("LLM requests = %d, want 2", len(requests))
+	}
+	if toolMessage := requests[1].Messages[3]; !strings.HasPrefix(toolMessage.Content, "Error: invalid tool arguments") {
+		t.Errorf("tool message content = %q, want the parse error", toolMessage.Content)
+	}
+	if complete := collected[4]; complete.Message != "Let me fix the query." {
+		t.Errorf("complete chunk = %+v, want the model's answer after the error", complete)
+	}
+}
+
+func TestRunChatStreamIterationCap(t *testing.T) {
+	server := newFakeLLMServer(t,
+		fakeStep{toolCalls: []openai.ToolCall{toolCall("call_1", "query_prometheus", `{}`)}},
+		fakeStep{toolCalls: []openai.ToolCall{toolCall("call_2", "query_prometheus", `{}`)}},
+		fakeStep{content: "Giving up after two queries."},
+	)
+	manager := newTestManager(t, server, ManagerConfig{MaxToolIterations: 2})
+
+	execute := func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		return mcp.NewTextResult("ok"), nil
+	}
+
+	chunks, err := manager.RunChatStream(context.Background(), "Loop", "s1", testUser, execute)
+	if err != nil {
+		t.Fatalf("RunChatStream() error = %v", err)
+	}
+	collected := collectChunks(t, chunks)
+
+	if last := collected[len(collected)-1]; last.Type != "done" {
+		t.Errorf("last chunk type = %v, want done", last.Type)
+	}
+
+	requests := server.recorded()
+	if len(requests) != 3 {
+		t.Fatalf("LLM requests = %d, want 3", len(requests))
+	}
+	if len(requests[1].Tools) == 0 {
+		t.Error("tools should still be offered before the cap is reached")
+	}
+	if len(requests[2].Tools) != 0 {
+		t.Errorf("tools offered after cap = %d, want 0", len(requests[2].Tools))
+	}
+}
+
+func TestToolCallsPastTheCapAreNotRun(t *testing.T) {
+	// The model keeps asking for tools, even once none are offered
+	loop := func(n int) []fakeStep {
+		steps := make([]fakeStep, n)
+		for i := range steps {
+			steps[i] = fakeStep{toolCalls: []openai.ToolCall{toolCall(fmt.Sprintf("call_%d", i+1), "query_prometheus", `{}`)}}
+		}
+		return steps
+	}
+
+	var runs atomic.Int32
+	execute := func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		runs.Add(1)
+		return mcp.NewTextResult("ok"), nil
+	}
+
+	t.Run("RunChat", func(t *testing.T) {
+		runs.Store(0)
+		server := newFakeLLMServer(t, loop(4)...)
+		manager := newTestManager(t, server, ManagerConfig{MaxToolIterations: 2})
+
+		result, err := manager.RunChat(context.Background(), "Loop", "s1", testUser, execute)
+		if err != nil {
+			t.Fatalf("RunChat() error = %v", err)
+		}
+		if result.Response != toolLimitMessage {
+			t.Errorf("Response = %q, want the tool limit message", result.Response)
+		}
+		if n := runs.Load(); n != 2 || len(result.ToolCalls) != 2 {
+			t.Errorf("ran %d tools and reported %d calls, want 2", n, len(result.ToolCalls))
+		}
+		if n := len(server.recorded()); n != 3 {
+			t.Errorf("LLM requests = %d, want 3", n)
+		}
+	})
+
+	t.Run("RunChatStream", func(t *testing.T) {
+		runs.Store(0)
+		server := newFakeLLMServer(t, loop(4)...)
+		manager := newTestManager(t, server, ManagerConfig{MaxToolIterations: 2})
+
+		chunks, err := manager.RunChatStream(context.Background(), "Loop", "s1", testUser, execute)
+		if err != nil {
+			t.Fatalf("RunChatStream() error = %v", err)
+		}
+		collected := collectChunks(t, chunks)
+
+		if n := runs.Load(); n != 2 {
+			t.Errorf("ran %d tools, want 2", n)
+		}
+		if n := len(server.recorded()); n != 3 {
+			t.Errorf("LLM requests = %d, want 3", n)
+		}
+		if complete := collected[len(collected)-2]; complete.Type != "complete" || complete.Message != toolLimitMessage {
+			t.Errorf("complete chunk = %+v, want the tool limit message", complete)
+		}
+	})
+}
+
+func TestRunChatExecutesTools(t *testing.T) {
+	server := newFakeLLMServer(t,
+		fakeStep{toolCalls: []openai.ToolCall{
+			toolCall("call_1", "query_prometheus", `{"query":"up"}`),
+			toolCall("call_2", "query_prometheus", `not json`),
+		}},
+		fakeStep{content: "One query succeeded."},
+	)
+	manager := newTestManager(t, server, ManagerConfig{})
+
+	execute := func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		return mcp.NewTextResult(fmt.Sprintf("result for %v", args["query"])), nil
+	}
+
+	result, err := manager.RunChat(context.Background(), "Are my targets up?", "s1", testUser, execute)
+	if err != nil {
+		t.Fatalf("RunChat() error = %v", err)
+	}
+
+	if result.Response != "One query succeeded." {
+		t.Errorf("Response = %q, want final answer", result.Response)
+	}
+
+	if len(result.ToolCalls) != 2 {
+		t.Fatalf("ToolCalls = %d, want 2", len(result.ToolCalls))
+	}
+	if got := result.ToolCalls[0]; got.ID != "call_1" || got.Arguments["query"] != "up" || got.Result != "result for up" {
+		t.Errorf("first tool call = %+v", got)
+	}
+	if got := result.ToolCalls[1]; !strings.HasPrefix(got.Result, "Error: invalid tool arguments") {
+		t.Errorf("second tool call result = %q, want argument error", got.Result)
+	}
+
+	requests := server.recorded()
+	if len(requests) != 2 {
+		t.Fatalf("LLM requests = %d, want 2", len(requests))
+	}
+	followUp := requests[1].Messages
+	if len(followUp) != 5 {
+		t.Fatalf("follow-up messages = %d, want 5 (system, user, assistant, tool, tool)", len(followUp))
+	}
+	if followUp[3].ToolCallID != "call_1" || followUp[4].ToolCallID != "call_2" {
+		t.Errorf("tool messages answer %q and %q, want call_1 and call_2", followUp[3].ToolCallID, followUp[4].ToolCallID)
+	}
+}
+
+func TestNewManagerWithConfigDefaults(t *testing.T) {
+	llmClient, err := llm.NewLLMClient("http://localhost", "test-key")
+	if err != nil {
+		t.Fatalf("NewLLMClient() error = %v", err)
+	}
+
+	manager, err := NewManagerWithConfig(llmClient, nil, nil, ManagerConfig{})
+	if err != nil {
+		t.Fatalf("NewManagerWithConfig() error = %v", err)
+	}
+
+	if manager.maxToolIterations != DefaultMaxToolIterations {
+		t.Errorf("maxToolIterations = %d, want %d", manager.maxToolIterations, DefaultMaxToolIterations)
+	}
+}
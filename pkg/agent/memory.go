@@ -1,7 +1,9 @@
 package agent
 
 import (
+	"encoding/json"
 	"sync"
+	"time"
 )
 
 // Default memory limits
@@ -10,16 +12,28 @@ const (
 	DefaultMaxCharacters = 100000 // Maximum total characters (~25k tokens)
 )
 
-// Message represents a conversation message
+// Message represents a conversation message.
+// Assistant messages may carry the tool calls they requested; tool messages
+// carry the ID of the call they answer.
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall represents a tool invocation requested by the assistant
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
 // MemoryConfig holds configuration for conversation memory limits
 type MemoryConfig struct {
-	MaxMessages   int // Maximum number of messages (0 = default, <0 = unlimited)
-	MaxCharacters int // Maximum total characters (0 = default, <0 = unlimited)
+	MaxMessages   int  // Maximum number of messages (0 = default, <0 = unlimited)
+	MaxCharacters int  // Maximum total characters (0 = default, <0 = unlimited)
+	KeepEvicted   bool // Keep trimmed messages so they can be summarized
 }
 
 // ConversationMemory stores conversation history for a session
@@ -28,6 +42,11 @@ type ConversationMemory struct {
 	totalChars    int
 	maxMessages   int
 	maxCharacters int
+	keepEvicted   bool
+	summary       string    // Rolling summary of messages trimmed from history
+	evicted       []Message // Trimmed messages not yet folded into the summary
+	createdAt     time.Time
+	updatedAt     time.Time
 	mu            sync.RWMutex
 }
 
@@ -48,11 +67,15 @@ func NewConversationMemoryWithConfig(config MemoryConfig) *ConversationMemory {
 		config.MaxCharacters = DefaultMaxCharacters
 	}
 
+	now := time.Now().UTC()
 	return &ConversationMemory{
 		messages:      make([]Message, 0),
 		totalChars:    0,
 		maxMessages:   config.MaxMessages,
 		maxCharacters: config.MaxCharacters,
+		keepEvicted:   config.KeepEvicted,
+		createdAt:     now,
+		updatedAt:     now,
 	}
 }
 
@@ -62,15 +85,119 @@ func (m *ConversationMemory) AddMessage(role, content string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	newMsg := Message{
+	m.append(Message{
 		Role:    role,
 		Content: content,
+	})
+
+	m.trim()
+}
+
+// AddToolExchange records an assistant tool-calling step together with the results
+// of every call, so the pair is always stored (and later trimmed) as a unit
+func (m *ConversationMemory) AddToolExchange(content string, invocations []ToolInvocation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	calls := make([]ToolCall, 0, len(invocations))
+	for _, inv := range invocations {
+		args, err := json.Marshal(inv.Arguments)
+		if err != nil {
+			args = []byte("{}")
+		}
+		calls = append(calls, ToolCall{
+			ID:        inv.ID,
+			Name:      inv.Tool,
+			Arguments: string(args),
+		})
+	}
+
+	m.append(Message{
+		Role:      "assistant",
+		Content:   content,
+		ToolCalls: calls,
+	})
+
+	for _, inv := range invocations {
+		m.append(Message{
+			Role:       "tool",
+			Content:    inv.Result,
+			ToolCallID: inv.ID,
+		})
+	}
+
+	m.trim()
+}
+
+// Restore replaces the history with previously persisted messages and timestamps
+func (m *ConversationMemory) Restore(messages []Message, createdAt, updatedAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = make([]Message, 0, len(messages))
+	m.totalChars = 0
+	for _, msg := range messages {
+		m.append(msg)
+	}
+	m.createdAt = createdAt
+	m.updatedAt = updatedAt
+
+	m.trim()
+}
+
+// RestoreSummary reloads a persisted summary and the evicted messages it does not cover yet
+func (m *ConversationMemory) RestoreSummary(summary string, evicted []Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.summary = summary
+	if m.keepEvicted {
+		m.evicted = append([]Message(nil), evicted...)
+	}
+}
+
+// GetSummary returns the summary of messages trimmed from history
+func (m *ConversationMemory) GetSummary() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.summary
+}
+
+// GetEvicted returns the trimmed messages not yet folded into the summary
+func (m *ConversationMemory) GetEvicted() []Message {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]Message, len(m.evicted))
+	copy(result, m.evicted)
+	return result
+}
+
+// ApplySummary replaces the summary with one that covers the first n evicted messages
+func (m *ConversationMemory) ApplySummary(summary string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.summary = summary
+	if n > len(m.evicted) {
+		n = len(m.evicted)
 	}
-	msgChars := len(content)
+	m.evicted = m.evicted[n:]
+	m.updatedAt = time.Now().UTC()
+}
 
-	m.messages = append(m.messages, newMsg)
-	m.totalChars += msgChars
+// append adds a message without trimming
+// Must be called with lock held
+func (m *ConversationMemory) append(msg Message) {
+	m.messages = append(m.messages, msg)
+	m.totalChars += messageChars(msg)
+	m.updatedAt = time.Now().UTC()
+}
 
+// trim enforces the message and character limits
+// Must be called with lock held
+func (m *ConversationMemory) trim() {
 	// Trim if over message limit
 	m.trimToMessageLimit()
 
@@ -86,10 +213,7 @@ func (m *ConversationMemory) trimToMessageLimit() {
 	}
 
 	for len(m.messages) > m.maxMessages {
-		// Remove oldest message
-		removed := m.messages[0]
-		m.messages = m.messages[1:]
-		m.totalChars -= len(removed.Content)
+		m.removeOldest()
 	}
 }
 
@@ -102,11 +226,46 @@ func (m *ConversationMemory) trimToCharacterLimit() {
 
 	// Keep at least one message even if it exceeds the limit
 	for m.totalChars > m.maxCharacters && len(m.messages) > 1 {
-		// Remove oldest message
-		removed := m.messages[0]
-		m.messages = m.messages[1:]
-		m.totalChars -= len(removed.Content)
+		m.removeOldest()
+	}
+}
+
+// removeOldest removes the oldest message along with any tool results that
+// would otherwise be left at the head of history without their call
+// Must be called with lock held
+func (m *ConversationMemory) removeOldest() {
+	m.evict()
+
+	for len(m.messages) > 0 && m.messages[0].Role == "tool" {
+		m.evict()
+	}
+}
+
+// evict removes the oldest message, keeping it for summarization if enabled
+// Must be called with lock held
+func (m *ConversationMemory) evict() {
+	msg := m.messages[0]
+	m.totalChars -= messageChars(msg)
+	m.messages = m.messages[1:]
+
+	if !m.keepEvicted {
+		return
+	}
+	m.evicted = append(m.evicted, msg)
+
+	// Bound the backlog if summarization keeps failing
+	if m.maxMessages > 0 && len(m.evicted) > m.maxMessages {
+		m.evicted = m.evicted[len(m.evicted)-m.maxMessages:]
+	}
+}
+
+// messageChars returns the number of characters a message contributes to the limit
+func messageChars(msg Message) int {
+	chars := len(msg.Content)
+	for _, call := range msg.ToolCalls {
+		chars += len(call.Name) + len(call.Arguments)
 	}
+	return chars
 }
 
 // GetMessages returns all messages in the conversation
@@ -130,15 +289,19 @@ func (m *ConversationMemory) GetStats() MemoryStats {
 		TotalChars:    m.totalChars,
 		MaxMessages:   m.maxMessages,
 		MaxCharacters: m.maxCharacters,
+		CreatedAt:     m.createdAt,
+		UpdatedAt:     m.updatedAt,
 	}
 }
 
 // MemoryStats holds statistics about memory usage
 type MemoryStats struct {
-	MessageCount  int `json:"message_count"`
-	TotalChars    int `json:"total_chars"`
-	MaxMessages   int `json:"max_messages"`
-	MaxCharacters int `json:"max_characters"`
+	MessageCount  int       `json:"message_count"`
+	TotalChars    int       `json:"total_chars"`
+	MaxMessages   int       `json:"max_messages"`
+	MaxCharacters int       `json:"max_characters"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // Clear removes all messages from the conversation
@@ -148,4 +311,7 @@ func (m *ConversationMemory) Clear() {
 
 	m.messages = make([]Message, 0)
 	m.totalChars = 0
+	m.summary = ""
+	m.evicted = nil
+	m.updatedAt = time.Now().UTC()
 }
@@ -84,6 +84,65 @@ func TestCharacterLimitTrimming(t *testing.T) {
 	}
 }
 
+func TestAddToolExchange(t *testing.T) {
+	memory := NewConversationMemory()
+
+	memory.AddMessage("user", "Are my targets up?")
+	memory.AddToolExchange("Checking.", []ToolInvocation{
+		{ID: "call_1", Tool: "query_prometheus", Arguments: map[string]interface{}{"query": "up"}, Result: "up=1"},
+		{ID: "call_2", Tool: "list_alerts", Arguments: map[string]interface{}{}, Result: "none"},
+	})
+
+	messages := memory.GetMessages()
+	if len(messages) != 4 {
+		t.Fatalf("Expected 4 messages (user, assistant, tool, tool), got %d", len(messages))
+	}
+
+	assistant := messages[1]
+	if assistant.Role != "assistant" || assistant.Content != "Checking." || len(assistant.ToolCalls) != 2 {
+		t.Fatalf("Unexpected assistant message: %#v", assistant)
+	}
+	if call := assistant.ToolCalls[0]; call.ID != "call_1" || call.Name != "query_prometheus" || call.Arguments != `{"query":"up"}` {
+		t.Errorf("Unexpected tool call: %#v", call)
+	}
+
+	if messages[2].Role != "tool" || messages[2].ToolCallID != "call_1" || messages[2].Content != "up=1" {
+		t.Errorf("Unexpected first tool result: %#v", messages[2])
+	}
+	if messages[3].Role != "tool" || messages[3].ToolCallID != "call_2" || messages[3].Content != "none" {
+		t.Errorf("Unexpected second tool result: %#v", messages[3])
+	}
+}
+
+func TestTrimmingNeverOrphansToolResults(t *testing.T) {
+	memory := NewConversationMemoryWithConfig(MemoryConfig{
+		MaxMessages:   4,
+		MaxCharacters: -1,
+	})
+
+	memory.AddToolExchange("", []ToolInvocation{
+		{ID: "call_1", Tool: "query_prometheus", Result: "a"},
+		{ID: "call_2", Tool: "query_prometheus", Result: "b"},
+	})
+	memory.AddMessage("assistant", "done")
+	memory.AddMessage("user", "next") // 5 messages -> trimming the tool call must drop its results
+
+	messages := memory.GetMessages()
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages after trimming, got %d: %#v", len(messages), messages)
+	}
+	for _, msg := range messages {
+		if msg.Role == "tool" {
+			t.Errorf("Orphaned tool result left in history: %#v", msg)
+		}
+	}
+
+	stats := memory.GetStats()
+	if stats.TotalChars != len("done")+len("next") {
+		t.Errorf("TotalChars = %d, want %d", stats.TotalChars, len("done")+len("next"))
+	}
+}
+
 func TestZeroConfigUsesDefaults(t *testing.T) {
 	memory := NewConversationMemoryWithConfig(MemoryConfig{})
 
@@ -237,3 +296,39 @@ func BenchmarkConcurrentAddMessage(b *testing.B) {
 		}
 	})
 }
+
+func TestKeepEvicted(t *testing.T) {
+	mem := NewConversationMemoryWithConfig(MemoryConfig{MaxMessages: 2, KeepEvicted: true})
+
+	mem.AddMessage("user", "one")
+	mem.AddMessage("assistant", "two")
+	mem.AddMessage("user", "three")
+
+	evicted := mem.GetEvicted()
+	if len(evicted) != 1 || evicted[0].Content != "one" {
+		t.Fatalf("GetEvicted() = %+v, want [one]", evicted)
+	}
+
+	mem.AddMessage("assistant", "four")
+	mem.ApplySummary("one and two", 1)
+
+	if got := mem.GetSummary(); got != "one and two" {
+		t.Errorf("GetSummary() = %q", got)
+	}
+	if evicted := mem.GetEvicted(); len(evicted) != 1 || evicted[0].Content != "two" {
+		t.Errorf("GetEvicted() after ApplySummary = %+v, want [two]", evicted)
+	}
+
+	mem.Clear()
+	if mem.GetSummary() != "" || len(mem.GetEvicted()) != 0 {
+		t.Error("Clear() should drop the summary and evicted messages")
+	}
+
+	// Without KeepEvicted nothing is retained
+	plain := NewConversationMemoryWithConfig(MemoryConfig{MaxMessages: 1})
+	plain.AddMessage("user", "one")
+	plain.AddMessage("user", "two")
+	if len(plain.GetEvicted()) != 0 {
+		t.Error("GetEvicted() should be empty when KeepEvicted is off")
+	}
+}
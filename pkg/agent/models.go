@@ -0,0 +1,30 @@
+package agent
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
+)
+
+// ModelAuto picks the model per turn: short questions start on the base model,
+// and the turn moves to the large model once tools are called
+const ModelAuto = "auto"
+
+// autoBaseMaxLength is the longest message, in characters, ModelAuto starts on the
+// base model; it leaves room for the dashboard context the panel prepends
+const autoBaseMaxLength = 400
+
+// turnModels returns the model for the first LLM step of a turn and the model for
+// the steps after tool calls, given the model requested with llm.WithModel
+func (m *Manager) turnModels(ctx context.Context, userMessage string) (first, afterTools string) {
+	requested := m.llmClient.ModelFor(ctx)
+	if requested != ModelAuto {
+		return requested, requested
+	}
+
+	if len([]rune(strings.TrimSpace(userMessage))) <= autoBaseMaxLength {
+		return llm.ModelBase, llm.ModelLarge
+	}
+	return llm.ModelLarge, llm.ModelLarge
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestRunChatModelSelection(t *testing.T) {
+	execute := func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		return mcp.NewTextResult("up=1"), nil
+	}
+
+	tests := []struct {
+		name       string
+		model      string // Requested with llm.WithModel
+		message    string
+		toolCalls  bool
+		wantModels []string // Per LLM request
+	}{
+		{"default", "", "Are my targets up?", false, []string{llm.ModelLarge}},
+		{"explicit", "gpt-4o-mini", "Are my targets up?", true, []string{"gpt-4o-mini", "gpt-4o-mini"}},
+		{"auto short without tools", ModelAuto, "What is a histogram?", false, []string{llm.ModelBase}},
+		{"auto short with tools", ModelAuto, "Are my targets up?", true, []string{llm.ModelBase, llm.ModelLarge}},
+		{"auto long", ModelAuto, strings.Repeat("Why is checkout slow? ", 20), false, []string{llm.ModelLarge}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps := []fakeStep{{content: "Answer."}}
+			if tt.toolCalls {
+				steps = append([]fakeStep{{toolCalls: []openai.ToolCall{toolCall("call_1", "query_prometheus", `{}`)}}}, steps...)
+			}
+			server := newFakeLLMServer(t, steps...)
+			manager := newTestManager(t, server, ManagerConfig{})
+
+			ctx := context.Background()
+			if tt.model != "" {
+				ctx = llm.WithModel(ctx, tt.model)
+			}
+			result, err := manager.RunChat(ctx, tt.message, "s1", testUser, execute)
+			if err != nil {
+				t.Fatalf("RunChat() error = %v", err)
+			}
+
+			requests := server.recorded()
+			if len(requests) != len(tt.wantModels) {
+				t.Fatalf("LLM requests = %d, want %d", len(requests), len(tt.wantModels))
+			}
+			for n, req := range requests {
+				if req.Model != tt.wantModels[n] {
+					t.Errorf("request %d model = %q, want %q", n+1, req.Model, tt.wantModels[n])
+				}
+			}
+			if want := tt.wantModels[len(tt.wantModels)-1]; result.Model != want {
+				t.Errorf("result model = %q, want %q", result.Model, want)
+			}
+		})
+	}
+}
+
+func TestRunChatStreamReportsModel(t *testing.T) {
+	server := newFakeLLMServer(t,
+		fakeStep{toolCalls: []openai.ToolCall{toolCall("call_1", "query_prometheus", `{}`)}},
+		fakeStep{content: "All targets are up."},
+	)
+	manager := newTestManager(t, server, ManagerConfig{})
+	execute := func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		return mcp.NewTextResult("up=1"), nil
+	}
+
+	chunks, err := manager.RunChatStream(llm.WithModel(context.Background(), ModelAuto), "Are my targets up?", "s1", testUser, execute)
+	if err != nil {
+		t.Fatalf("RunChatStream() error = %v", err)
+	}
+
+	models := map[string]string{}
+	for _, chunk := range collectChunks(t, chunks) {
+		if chunk.Type == "start" || chunk.Type == "complete" {
+			models[chunk.Type] = chunk.Model
+		}
+	}
+	if models["start"] != llm.ModelBase || models["complete"] != llm.ModelLarge {
+		t.Errorf("start/complete models = %v, want base then large after the tool call", models)
+	}
+}
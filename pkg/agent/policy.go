@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrToolNotPermitted is returned when a user may not run a tool
+var ErrToolNotPermitted = errors.New("tool is not permitted")
+
+// Grafana org roles, lowest to highest
+const (
+	RoleNone   = "None"
+	RoleViewer = "Viewer"
+	RoleEditor = "Editor"
+	RoleAdmin  = "Admin"
+)
+
+// roleRanks orders Grafana org roles; unknown roles rank with None
+var roleRanks = map[string]int{
+	RoleNone:   0,
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// ToolPolicy restricts which tools are offered to the model and may be run
+type ToolPolicy struct {
+	// Servers holds allow/deny lists keyed by MCP server name
+	Servers map[string]ServerToolPolicy `json:"servers"`
+	// MinRoles maps tool name globs to the lowest Grafana role that may run them.
+	// Tools without a rule need Editor if they are mutating and Viewer otherwise.
+	MinRoles map[string]string `json:"min_roles"`
+}
+
+// ServerToolPolicy lists tool name globs allowed or denied on one MCP server.
+// An empty allow list allows every tool; deny wins over allow.
+type ServerToolPolicy struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// Validate checks that every glob and role in the policy is well formed
+func (p ToolPolicy) Validate() error {
+	for server, sp := range p.Servers {
+		for _, pattern := range append(append([]string(nil), sp.Allow...), sp.Deny...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid tool pattern %q for server %s: %w", pattern, server, err)
+			}
+		}
+	}
+
+	for pattern, role := range p.MinRoles {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid tool pattern %q: %w", pattern, err)
+		}
+		if _, ok := roleRanks[role]; !ok || role == RoleNone {
+			return fmt.Errorf("unknown role %q for tool pattern %q (expected Viewer, Editor or Admin)", role, pattern)
+		}
+	}
+
+	return nil
+}
+
+// serverAllows reports whether the allow/deny lists of a tool's server permit it.
+// Patterns match the full tool name or the tool's name on its server.
+func (p ToolPolicy) serverAllows(route ToolRoute, toolName string) bool {
+	sp, ok := p.Servers[route.Server]
+	if !ok {
+		return true
+	}
+
+	if matchesAny(sp.Deny, toolName, route.Tool) {
+		return false
+	}
+	return len(sp.Allow) == 0 || matchesAny(sp.Allow, toolName, route.Tool)
+}
+
+// minRole returns the lowest role that may run a tool. An exact rule wins,
+// then the most specific (longest) matching glob, then the default for its access class.
+func (p ToolPolicy) minRole(toolName string, mutating bool) string {
+	if role, ok := p.MinRoles[toolName]; ok {
+		return role
+	}
+
+	patterns := make([]string, 0, len(p.MinRoles))
+	for pattern := range p.MinRoles {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, toolName); ok {
+			return p.MinRoles[pattern]
+		}
+	}
+
+	if mutating {
+		return RoleEditor
+	}
+	return RoleViewer
+}
+
+// matchesAny reports whether any glob matches a tool's exposed or original name
+func matchesAny(patterns []string, toolName, short string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, toolName); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, short); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRole reports whether role is at least minRole
+func hasRole(role, minRole string) bool {
+	return roleRanks[role] >= roleRanks[minRole]
+}
+
+// CanUseTool reports whether user may run a tool, returning an error
+// wrapping ErrToolNotPermitted if not
+func (m *Manager) CanUseTool(toolName string, user User) error {
+	return m.canUseTool(m.currentTools(), toolName, user)
+}
+
+// canUseTool is CanUseTool against a given toolset
+func (m *Manager) canUseTool(set *toolset, toolName string, user User) error {
+	if route, ok := set.routes[toolName]; ok && !m.toolPolicy.serverAllows(route, toolName) {
+		return fmt.Errorf("%w: %s is disabled by the tool policy", ErrToolNotPermitted, toolName)
+	}
+
+	minRole := m.toolPolicy.minRole(toolName, set.mutating[toolName])
+	if !hasRole(user.Role, minRole) {
+		return fmt.Errorf("%w: %s requires the %s role", ErrToolNotPermitted, toolName, minRole)
+	}
+
+	return nil
+}
+
+// toolsFor returns the tools user may run, in the form offered to the model
+func (m *Manager) toolsFor(user User) []openai.Tool {
+	set := m.currentTools()
+	tools := make([]openai.Tool, 0, len(set.tools))
+	for _, tool := range set.tools {
+		if tool.Function != nil && m.canUseTool(set, tool.Function.Name, user) == nil {
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestToolPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  ToolPolicy
+		wantErr bool
+	}{
+		{"empty", ToolPolicy{}, false},
+		{"valid", ToolPolicy{
+			Servers:  map[string]ServerToolPolicy{"alertmanager": {Allow: []string{"list_*"}, Deny: []string{"*_alerts"}}},
+			MinRoles: map[string]string{"*silence*": RoleEditor},
+		}, false},
+		{"bad glob", ToolPolicy{Servers: map[string]ServerToolPolicy{"grafana": {Deny: []string{"["}}}}, true},
+		{"unknown role", ToolPolicy{MinRoles: map[string]string{"*": "Owner"}}, true},
+		{"none role", ToolPolicy{MinRoles: map[string]string{"*": RoleNone}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newPolicyTestManager returns a manager offering a read-only and a mutating Alertmanager tool
+func newPolicyTestManager(t *testing.T, server *fakeLLMServer, policy ToolPolicy) *Manager {
+	manager := newTestManager(t, server, ManagerConfig{ToolPolicy: policy})
+	manager.toolset.Store(&toolset{
+		tools: []openai.Tool{
+			{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "alertmanager__list_alerts"}},
+			{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "alertmanager__post_silence"}},
+			{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "query_prometheus"}},
+		},
+		routes: map[string]ToolRoute{
+			"alertmanager__list_alerts":  {Server: "alertmanager", Tool: "list_alerts"},
+			"alertmanager__post_silence": {Server: "alertmanager", Tool: "post_silence"},
+			"query_prometheus":           {Server: "grafana", Tool: "query_prometheus"},
+		},
+		mutating: map[string]bool{"alertmanager__post_silence": true},
+	})
+	return manager
+}
+
+func toolNames(tools []openai.Tool) string {
+	names := make([]string, len(tools))
+	for i, tool := range tools {
+		names[i] = tool.Function.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func TestToolsForRole(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ToolPolicy
+		role   string
+		want   string
+	}{
+		{"viewer cannot create silences by default", ToolPolicy{}, RoleViewer, "alertmanager__list_alerts,query_prometheus"},
+		{"editor may run mutating tools", ToolPolicy{}, RoleEditor, "alertmanager__list_alerts,alertmanager__post_silence,query_prometheus"},
+		{"no role sees nothing", ToolPolicy{}, RoleNone, ""},
+		{"min role glob", ToolPolicy{MinRoles: map[string]string{"alertmanager__*": RoleAdmin}}, RoleEditor, "query_prometheus"},
+		{"exact rule beats glob", ToolPolicy{MinRoles: map[string]string{
+			"alertmanager__*":           RoleAdmin,
+			"alertmanager__list_alerts": RoleViewer,
+		}}, RoleViewer, "alertmanager__list_alerts,query_prometheus"},
+		{"longer glob beats shorter", ToolPolicy{MinRoles: map[string]string{
+			"*":                    RoleAdmin,
+			"alertmanager__list_*": RoleViewer,
+		}}, RoleEditor, "alertmanager__list_alerts"},
+		{"deny unprefixed name", ToolPolicy{Servers: map[string]ServerToolPolicy{
+			"alertmanager": {Deny: []string{"post_*"}},
+		}}, RoleAdmin, "alertmanager__list_alerts,query_prometheus"},
+		{"allow list", ToolPolicy{Servers: map[string]ServerToolPolicy{
+			"grafana": {Allow: []string{"search_*"}},
+		}}, RoleAdmin, "alertmanager__list_alerts,alertmanager__post_silence"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newPolicyTestManager(t, newFakeLLMServer(t), tt.policy)
+			got := toolNames(manager.toolsFor(User{Login: "alice", Role: tt.role}))
+			if got != tt.want {
+				t.Errorf("toolsFor(%s) = %q, want %q", tt.role, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestViewerCannotCreateSilences(t *testing.T) {
+	server := newFakeLLMServer(t,
+		fakeStep{toolCalls: []openai.ToolCall{toolCall("call_1", "alertmanager__post_silence", `{}`)}},
+		fakeStep{content: "I can't do that."},
+	)
+	manager := newPolicyTestManager(t, server, ToolPolicy{})
+	viewer := User{Login: "vic", Role: RoleViewer}
+
+	if err := manager.CanUseTool("alertmanager__post_silence", viewer); !errors.Is(err, ErrToolNotPermitted) {
+		t.Errorf("CanUseTool() error = %v, want ErrToolNotPermitted", err)
+	}
+
+	// Even if the model names the hidden tool, it is refused without asking for approval
+	chunks, err := manager.RunChatStream(context.Background(), "Silence everything", "s1", viewer, func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		t.Errorf("tool %s was executed for a viewer", name)
+		return mcp.NewTextResult(""), nil
+	})
+	if err != nil {
+		t.Fatalf("RunChatStream() error = %v", err)
+	}
+
+	for _, chunk := range collectChunks(t, chunks) {
+		if chunk.Type == "approval_required" {
+			t.Error("viewer was asked to approve a tool they may not run")
+		}
+		if chunk.Type == "tool_result" && !strings.Contains(chunk.Result.(string), "requires the Editor role") {
+			t.Errorf("tool_result = %v, want a role error", chunk.Result)
+		}
+	}
+
+	if got := toolNames(server.recorded()[0].Tools); strings.Contains(got, "post_silence") {
+		t.Errorf("tools offered to the model = %s, want post_silence hidden", got)
+	}
+}
@@ -1,5 +1,10 @@
 package agent
 
+import (
+	"fmt"
+	"strings"
+)
+
 const SYSTEM_PROMPT = `You are an expert SRE and observability assistant specializing in Grafana, Prometheus, Loki, and related monitoring tools.
 
 ## Your Role
@@ -293,8 +298,25 @@ You have access to AlertManager MCP tools for alert management. These tools are
 - Investigating alert patterns or frequency
 - Checking if alerts are firing for specific services`
 
-// BuildSystemPrompt constructs the system prompt based on available MCP types
-func BuildSystemPrompt(mcpTypes []string) string {
+const SUMMARY_PROMPT = `You maintain a running summary of an observability troubleshooting conversation between an operator and an SRE assistant.
+
+You are given the current summary (possibly empty) and messages that are being removed from the conversation history. Produce an updated summary that merges both.
+
+Keep:
+- The operator's goals and questions
+- Findings: affected services, dashboards, alerts, metrics, queries and their results
+- Decisions made and actions taken (silences created, changes proposed)
+- Open questions and next steps
+
+Be concise and factual. Use short bullet points grouped under headings. Do not invent details. Reply with the summary only.`
+
+// SUMMARY_CONTEXT_PREFIX introduces the conversation summary in requests to the model
+const SUMMARY_CONTEXT_PREFIX = "Summary of the earlier part of this conversation (older messages are no longer shown):\n\n"
+
+// BuildSystemPrompt constructs the system prompt based on available MCP types.
+// Built-in additions cover the known server types; serverPrompts adds any
+// server's own text, keyed by server.
+func BuildSystemPrompt(mcpTypes []string, serverPrompts map[string]string) string {
 	prompt := SYSTEM_PROMPT
 
 	// Check for specific MCP types and append relevant additions
@@ -305,6 +327,10 @@ func BuildSystemPrompt(mcpTypes []string) string {
 		case "alertmanager":
 			prompt += ALERTMANAGER_PROMPT_ADDITION
 		}
+
+		if addition := strings.TrimSpace(serverPrompts[mcpType]); addition != "" {
+			prompt += fmt.Sprintf("\n\n## %s MCP Server\n\n%s", mcpType, addition)
+		}
 	}
 
 	return prompt
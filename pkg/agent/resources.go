@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ReadResourceTool is the generated tool that lets the model read MCP resources
+const ReadResourceTool = "read_resource"
+
+// maxListedResources caps how many resources and templates the tool description lists
+const maxListedResources = 50
+
+// buildReadResourceTool creates the read_resource tool for the servers that publish
+// resources. Its description lists what can be read so the model knows the URIs.
+// It returns the servers in name order, and false if there are none.
+func buildReadResourceTool(resourcesByServer map[string]*mcp.ResourceList) (openai.Tool, []string, bool) {
+	servers := make([]string, 0, len(resourcesByServer))
+	for serverType := range resourcesByServer {
+		servers = append(servers, serverType)
+	}
+	if len(servers) == 0 {
+		return openai.Tool{}, nil, false
+	}
+	sort.Strings(servers)
+
+	var listed []string
+	for _, serverType := range servers {
+		list := resourcesByServer[serverType]
+		for _, r := range list.Resources {
+			listed = append(listed, fmt.Sprintf("- %s (%s): %s", r.URI, serverType, describe(r.Title, r.Name, r.Description)))
+		}
+		for _, t := range list.Templates {
+			listed = append(listed, fmt.Sprintf("- %s (%s, template): %s", t.URITemplate, serverType, describe(t.Title, t.Name, t.Description)))
+		}
+	}
+
+	description := "Read a resource (runbook, document or data) published by an MCP server, by URI. " +
+		"URI templates can be filled in with concrete values."
+	if len(listed) > maxListedResources {
+		listed = append(listed[:maxListedResources], fmt.Sprintf("- ... and %d more", len(listed)-maxListedResources))
+	}
+	if len(listed) > 0 {
+		description += "\nAvailable resources:\n" + strings.Join(listed, "\n")
+	}
+
+	required := []string{"uri"}
+	if len(servers) > 1 {
+		required = append(required, "server")
+	}
+
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        ReadResourceTool,
+			Description: description,
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"uri": map[string]interface{}{
+						"type":        "string",
+						"description": "URI of the resource to read",
+					},
+					"server": map[string]interface{}{
+						"type":        "string",
+						"description": "MCP server publishing the resource",
+						"enum":        servers,
+					},
+				},
+				"required": required,
+			},
+		},
+	}, servers, true
+}
+
+// describe returns the best available label for a resource, with its description
+func describe(title, name, description string) string {
+	label := title
+	if label == "" {
+		label = name
+	}
+	if description != "" {
+		label += " - " + description
+	}
+	return label
+}
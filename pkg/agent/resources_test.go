@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp/mcptest"
+)
+
+// newResourceMCPClient connects to a fake MCP server publishing the given resources
+// (none means the server does not declare the resources capability)
+func newResourceMCPClient(t *testing.T, serverType string, resources []mcp.Resource) *mcp.Client {
+	t.Helper()
+
+	capabilities := map[string]interface{}{"tools": map[string]interface{}{}}
+	if resources != nil {
+		capabilities["resources"] = map[string]interface{}{}
+	}
+	server := mcptest.NewServer(t, capabilities, map[string]mcptest.Handler{
+		"resources/list":           mcptest.Result(map[string]interface{}{"resources": resources}),
+		"resources/templates/list": mcptest.Result(map[string]interface{}{"resourceTemplates": []mcp.ResourceTemplate{}}),
+		"tools/list":               mcptest.Result(map[string]interface{}{"tools": []mcp.Tool{}}),
+	})
+
+	client := mcp.NewClient(server.URL, serverType)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	return client
+}
+
+func TestBuildReadResourceTool(t *testing.T) {
+	if _, _, ok := buildReadResourceTool(map[string]*mcp.ResourceList{}); ok {
+		t.Error("buildReadResourceTool() should not create a tool when no server publishes resources")
+	}
+
+	tool, servers, ok := buildReadResourceTool(map[string]*mcp.ResourceList{
+		"genesys": {Resources: []mcp.Resource{
+			{URI: "runbook://queue-backlog", Name: "queue-backlog", Title: "Queue backlog runbook", Description: "Steps for a growing queue"},
+		}},
+		"alertmanager": {Resources: []mcp.Resource{{URI: "runbook://silences", Name: "silences"}}},
+	})
+	if !ok {
+		t.Fatal("buildReadResourceTool() should create a tool")
+	}
+	if strings.Join(servers, ",") != "alertmanager,genesys" {
+		t.Errorf("servers = %v, want alertmanager,genesys", servers)
+	}
+
+	if tool.Function.Name != ReadResourceTool {
+		t.Errorf("tool name = %s, want %s", tool.Function.Name, ReadResourceTool)
+	}
+	for _, want := range []string{
+		"runbook://queue-backlog (genesys): Queue backlog runbook - Steps for a growing queue",
+		"runbook://silences (alertmanager): silences",
+	} {
+		if !strings.Contains(tool.Function.Description, want) {
+			t.Errorf("description %q does not list %q", tool.Function.Description, want)
+		}
+	}
+
+	params := tool.Function.Parameters.(map[string]interface{})
+	server := params["properties"].(map[string]interface{})["server"].(map[string]interface{})
+	if enum := server["enum"].([]string); strings.Join(enum, ",") != "alertmanager,genesys" {
+		t.Errorf("server enum = %v, want the servers publishing resources", enum)
+	}
+	if required := params["required"].([]string); strings.Join(required, ",") != "uri,server" {
+		t.Errorf("required = %v, want uri and server when several servers publish resources", required)
+	}
+}
+
+func TestReadResourceToolPolicy(t *testing.T) {
+	llmClient, err := llm.NewLLMClient(newFakeLLMServer(t).URL, "test-key")
+	if err != nil {
+		t.Fatalf("NewLLMClient() error = %v", err)
+	}
+
+	clients := map[string]*mcp.Client{
+		"grafana":      newResourceMCPClient(t, "grafana", nil),
+		"genesys":      newResourceMCPClient(t, "genesys", []mcp.Resource{{URI: "runbook://queue-backlog", Name: "queue-backlog"}}),
+		"alertmanager": newResourceMCPClient(t, "alertmanager", []mcp.Resource{{URI: "runbook://silences", Name: "silences"}}),
+	}
+	manager, err := NewManagerWithConfig(llmClient, clients, []string{"grafana", "genesys", "alertmanager"}, ManagerConfig{
+		ToolPolicy: ToolPolicy{Servers: map[string]ServerToolPolicy{"genesys": {Deny: []string{ReadResourceTool}}}},
+	})
+	if err != nil {
+		t.Fatalf("NewManagerWithConfig() error = %v", err)
+	}
+
+	if servers := manager.ResourceServers(); strings.Join(servers, ",") != "alertmanager" {
+		t.Errorf("ResourceServers() = %v, want only alertmanager (genesys denies read_resource)", servers)
+	}
+	for _, tool := range manager.currentTools().tools {
+		if tool.Function.Name == ReadResourceTool && strings.Contains(tool.Function.Description, "runbook://queue-backlog") {
+			t.Error("read_resource lists resources of a server the policy denies it on")
+		}
+	}
+}
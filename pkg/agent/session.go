@@ -0,0 +1,289 @@
+package agent
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrSessionForbidden is returned when a user tries to use a session they do not own
+var ErrSessionForbidden = errors.New("session belongs to another user")
+
+// ErrSessionNotFound is returned when a session does not exist
+var ErrSessionNotFound = errors.New("session not found")
+
+// maxTitleLength is the length at which derived session titles are truncated
+const maxTitleLength = 60
+
+// maxCachedSessions bounds how many sessions are kept in memory between turns
+const maxCachedSessions = 1000
+
+// User identifies the Grafana user a session belongs to
+type User struct {
+	Login   string // Grafana login (or email when no login is set)
+	Role    string // Grafana org role (Viewer, Editor, Admin); decides which tools may run
+	IsAdmin bool   // Org admins may access every session in their org
+}
+
+// SessionInfo summarizes a session for listings
+type SessionInfo struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Owner        string    `json:"owner"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	MessageCount int       `json:"message_count"`
+}
+
+// SessionDetail is a session together with its full history
+type SessionDetail struct {
+	SessionInfo
+	Summary  string    `json:"summary,omitempty"` // Summary of history trimmed from messages
+	Messages []Message `json:"messages"`
+}
+
+// session is a conversation together with its owner
+type session struct {
+	owner    string
+	title    string // Set by the user; empty means derived from the conversation
+	memory   *ConversationMemory
+	lastUsed time.Time // Decides which sessions leave the cache first
+}
+
+// canAccess reports whether user may read or continue a session owned by owner.
+// Sessions without an owner predate per-user isolation and are admin-only.
+func canAccess(owner string, user User) bool {
+	if user.IsAdmin {
+		return true
+	}
+	return owner != "" && owner == user.Login
+}
+
+// NewSessionID returns a random, unguessable session identifier
+func NewSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	return "session-" + hex.EncodeToString(b), nil
+}
+
+// loadSession returns a session user may access, loading it from the store on first use.
+// When create is set, unknown sessions are created for user; otherwise ErrSessionNotFound is returned.
+// The store is read without holding m.mu, so a slow disk only delays this session.
+func (m *Manager) loadSession(sessionID string, user User, create bool) (*session, error) {
+	m.mu.Lock()
+	sess, ok := m.sessions[sessionID]
+	if ok {
+		sess.lastUsed = time.Now()
+	}
+	m.mu.Unlock()
+	if ok {
+		if !canAccess(sess.owner, user) {
+			return nil, ErrSessionForbidden
+		}
+		return sess, nil
+	}
+
+	record, err := m.sessionStore.Load(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	if record == nil && !create {
+		return nil, ErrSessionNotFound
+	}
+
+	sess = &session{
+		owner:    user.Login,
+		memory:   NewConversationMemoryWithConfig(MemoryConfig{KeepEvicted: m.summarizeHistory}),
+		lastUsed: time.Now(),
+	}
+	if record != nil {
+		if !canAccess(record.Owner, user) {
+			return nil, ErrSessionForbidden
+		}
+		sess.owner = record.Owner
+		sess.title = record.Title
+		sess.memory.RestoreSummary(record.Summary, record.Evicted)
+		sess.memory.Restore(record.Messages, record.CreatedAt, record.UpdatedAt)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Another request may have loaded the session meanwhile; everyone shares its copy
+	if cached, ok := m.sessions[sessionID]; ok {
+		if !canAccess(cached.owner, user) {
+			return nil, ErrSessionForbidden
+		}
+		cached.lastUsed = time.Now()
+		return cached, nil
+	}
+
+	m.sessions[sessionID] = sess
+	m.evictSessions()
+	return sess, nil
+}
+
+// evictSessions drops the least recently used sessions beyond maxCachedSessions.
+// Their history stays in the store and is loaded again when they are next used.
+// Must be called with m.mu held.
+func (m *Manager) evictSessions() {
+	for len(m.sessions) > maxCachedSessions {
+		var oldestID string
+		var oldest time.Time
+		for id, sess := range m.sessions {
+			if oldestID == "" || sess.lastUsed.Before(oldest) {
+				oldestID, oldest = id, sess.lastUsed
+			}
+		}
+		delete(m.sessions, oldestID)
+	}
+}
+
+// ListSessions returns the sessions owned by user, most recently updated first.
+// Org admins may set all to list every session in the org.
+func (m *Manager) ListSessions(user User, all bool) ([]SessionInfo, error) {
+	records, err := m.sessionStore.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sessions := make([]SessionInfo, 0, len(records))
+	for _, record := range records {
+		owned := record.Owner != "" && record.Owner == user.Login
+		if !owned && !(all && user.IsAdmin) {
+			continue
+		}
+
+		// Sessions already in use are reported from their live memory
+		if sess, ok := m.sessions[record.ID]; ok {
+			sessions = append(sessions, sessionInfo(record.ID, sess))
+			continue
+		}
+
+		title := record.Title
+		if title == "" {
+			title = deriveTitle(record.Messages)
+		}
+		sessions = append(sessions, SessionInfo{
+			ID:           record.ID,
+			Title:        title,
+			Owner:        record.Owner,
+			CreatedAt:    record.CreatedAt,
+			UpdatedAt:    record.UpdatedAt,
+			MessageCount: len(record.Messages),
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+
+	return sessions, nil
+}
+
+// GetSession returns a session's summary and full history
+func (m *Manager) GetSession(sessionID string, user User) (*SessionDetail, error) {
+	sess, err := m.loadSession(sessionID, user, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SessionDetail{
+		SessionInfo: sessionInfo(sessionID, sess),
+		Summary:     sess.memory.GetSummary(),
+		Messages:    sess.memory.GetMessages(),
+	}, nil
+}
+
+// RenameSession sets a session's title; an empty title reverts to the derived one
+func (m *Manager) RenameSession(sessionID string, user User, title string) (*SessionInfo, error) {
+	sess, err := m.loadSession(sessionID, user, false)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	sess.title = strings.TrimSpace(title)
+	m.mu.Unlock()
+
+	m.saveSession(sessionID, sess.memory)
+
+	info := sessionInfo(sessionID, sess)
+	return &info, nil
+}
+
+// ClearSession clears the conversation history for a session
+func (m *Manager) ClearSession(sessionID string, user User) error {
+	sess, err := m.loadSession(sessionID, user, false)
+	if err != nil {
+		return err
+	}
+
+	sess.memory.Clear()
+	m.saveSession(sessionID, sess.memory)
+	return nil
+}
+
+// DeleteSession removes a session and its stored history
+func (m *Manager) DeleteSession(sessionID string, user User) error {
+	if _, err := m.loadSession(sessionID, user, false); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	delete(m.sessions, sessionID)
+	m.mu.Unlock()
+
+	if err := m.sessionStore.Delete(sessionID); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// sessionInfo summarizes a live session
+func sessionInfo(sessionID string, sess *session) SessionInfo {
+	stats := sess.memory.GetStats()
+
+	title := sess.title
+	if title == "" {
+		title = deriveTitle(sess.memory.GetMessages())
+	}
+
+	return SessionInfo{
+		ID:           sessionID,
+		Title:        title,
+		Owner:        sess.owner,
+		CreatedAt:    stats.CreatedAt,
+		UpdatedAt:    stats.UpdatedAt,
+		MessageCount: stats.MessageCount,
+	}
+}
+
+// deriveTitle builds a title from the first user message. Only its last paragraph
+// is used so injected context (such as dashboard details) is skipped.
+func deriveTitle(messages []Message) string {
+	for _, msg := range messages {
+		if msg.Role != "user" {
+			continue
+		}
+
+		paragraphs := strings.Split(strings.TrimSpace(msg.Content), "\n\n")
+		title := strings.Join(strings.Fields(paragraphs[len(paragraphs)-1]), " ")
+
+		if runes := []rune(title); len(runes) > maxTitleLength {
+			title = strings.TrimSpace(string(runes[:maxTitleLength])) + "…"
+		}
+		return title
+	}
+
+	return "New conversation"
+}
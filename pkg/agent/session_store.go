@@ -0,0 +1,239 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// errCorruptSession marks a session file that exists but cannot be decoded
+var errCorruptSession = errors.New("corrupt session file")
+
+// SessionRecord is the persisted form of a conversation
+type SessionRecord struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Title     string    `json:"title,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Messages  []Message `json:"messages"`
+	Summary   string    `json:"summary,omitempty"` // Rolling summary of trimmed history
+	Evicted   []Message `json:"evicted,omitempty"` // Trimmed messages not yet summarized
+}
+
+// SessionStore persists conversation history so it survives plugin restarts
+type SessionStore interface {
+	// Load returns the record for a session, or nil if it does not exist
+	Load(sessionID string) (*SessionRecord, error)
+	// Save creates or replaces the record for a session
+	Save(record *SessionRecord) error
+	// Delete removes a session; deleting an unknown session is not an error
+	Delete(sessionID string) error
+	// List returns every stored session
+	List() ([]*SessionRecord, error)
+}
+
+// InMemorySessionStore keeps sessions in process memory (lost on restart)
+type InMemorySessionStore struct {
+	records map[string]*SessionRecord
+	mu      sync.RWMutex
+}
+
+// NewInMemorySessionStore creates an empty in-memory session store
+func NewInMemorySessionStore() *InMemorySessionStore {
+	return &InMemorySessionStore{
+		records: make(map[string]*SessionRecord),
+	}
+}
+
+// Load returns a copy of the stored record for a session
+func (s *InMemorySessionStore) Load(sessionID string) (*SessionRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[sessionID]
+	if !ok {
+		return nil, nil
+	}
+	return copyRecord(record), nil
+}
+
+// Save stores a copy of the record
+func (s *InMemorySessionStore) Save(record *SessionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[record.ID] = copyRecord(record)
+	return nil
+}
+
+// Delete removes a session
+func (s *InMemorySessionStore) Delete(sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, sessionID)
+	return nil
+}
+
+// List returns copies of all stored records
+func (s *InMemorySessionStore) List() ([]*SessionRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*SessionRecord, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, copyRecord(record))
+	}
+	return records, nil
+}
+
+// copyRecord returns a copy of a record that does not share its message slice
+func copyRecord(record *SessionRecord) *SessionRecord {
+	c := *record
+	c.Messages = make([]Message, len(record.Messages))
+	copy(c.Messages, record.Messages)
+	c.Evicted = append([]Message(nil), record.Evicted...)
+	return &c
+}
+
+// FileSessionStore keeps each session as a JSON file in a directory
+type FileSessionStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileSessionStore creates a file-backed session store, creating dir if needed
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if dir == "" {
+		return nil, errors.New("session store directory is required")
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create session store directory: %w", err)
+	}
+
+	return &FileSessionStore{dir: dir}, nil
+}
+
+// Load reads a session from disk. A corrupt file is renamed to .corrupt and the
+// session treated as missing, so it does not fail every later request.
+func (s *FileSessionStore) Load(sessionID string) (*SessionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.path(sessionID)
+	record, err := s.readFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, nil
+	case errors.Is(err, errCorruptSession):
+		log.DefaultLogger.Warn("Moving aside corrupt session file", "file", filepath.Base(path), "error", err)
+		if err := os.Rename(path, path+".corrupt"); err != nil {
+			return nil, fmt.Errorf("failed to move corrupt session file: %w", err)
+		}
+		return nil, nil
+	}
+	return record, err
+}
+
+// Save atomically writes a session to disk
+func (s *FileSessionStore) Save(record *SessionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated session
+	tmp, err := os.CreateTemp(s.dir, "session-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create session file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path(record.ID)); err != nil {
+		return fmt.Errorf("failed to save session file: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes a session file
+func (s *FileSessionStore) Delete(sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(sessionID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete session file: %w", err)
+	}
+	return nil
+}
+
+// List reads every session file in the store directory
+func (s *FileSessionStore) List() ([]*SessionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session store directory: %w", err)
+	}
+
+	var records []*SessionRecord
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		// One damaged file must not hide every other session
+		record, err := s.readFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			log.DefaultLogger.Warn("Skipping unreadable session file", "file", entry.Name(), "error", err)
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// path maps a session ID to its file; IDs are hashed so any client-supplied value is safe
+func (s *FileSessionStore) path(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// readFile decodes a session file
+func (s *FileSessionStore) readFile(path string) (*SessionRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var record SessionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", errCorruptSession, filepath.Base(path), err)
+	}
+
+	return &record, nil
+}
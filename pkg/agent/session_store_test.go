@@ -0,0 +1,209 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testSessionStores(t *testing.T) map[string]SessionStore {
+	fileStore, err := NewFileSessionStore(filepath.Join(t.TempDir(), "sessions"))
+	if err != nil {
+		t.Fatalf("NewFileSessionStore() error = %v", err)
+	}
+
+	return map[string]SessionStore{
+		"memory": NewInMemorySessionStore(),
+		"file":   fileStore,
+	}
+}
+
+func TestSessionStoreRoundTrip(t *testing.T) {
+	for name, store := range testSessionStores(t) {
+		t.Run(name, func(t *testing.T) {
+			created := time.Date(2026, 1, 27, 8, 0, 0, 0, time.UTC)
+			record := &SessionRecord{
+				ID:        "../not/a/path",
+				CreatedAt: created,
+				UpdatedAt: created.Add(time.Minute),
+				Messages: []Message{
+					{Role: "user", Content: "Are my targets up?"},
+					{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Name: "query_prometheus", Arguments: `{"query":"up"}`}}},
+					{Role: "tool", Content: "up=1", ToolCallID: "call_1"},
+				},
+			}
+
+			if err := store.Save(record); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+
+			loaded, err := store.Load(record.ID)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if loaded == nil {
+				t.Fatal("Load() returned nil for a saved session")
+			}
+			if !loaded.CreatedAt.Equal(record.CreatedAt) || !loaded.UpdatedAt.Equal(record.UpdatedAt) {
+				t.Errorf("Load() timestamps = %v/%v, want %v/%v", loaded.CreatedAt, loaded.UpdatedAt, record.CreatedAt, record.UpdatedAt)
+			}
+			if len(loaded.Messages) != 3 || loaded.Messages[1].ToolCalls[0].ID != "call_1" || loaded.Messages[2].ToolCallID != "call_1" {
+				t.Errorf("Load() messages = %#v", loaded.Messages)
+			}
+
+			records, err := store.List()
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if len(records) != 1 || records[0].ID != record.ID {
+				t.Errorf("List() = %#v, want the saved session", records)
+			}
+
+			if err := store.Delete(record.ID); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if loaded, err := store.Load(record.ID); err != nil || loaded != nil {
+				t.Errorf("Load() after Delete() = %v, %v, want nil, nil", loaded, err)
+			}
+			if err := store.Delete(record.ID); err != nil {
+				t.Errorf("Delete() of missing session error = %v", err)
+			}
+		})
+	}
+}
+
+func TestFileSessionStoreStaysInDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	store, err := NewFileSessionStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileSessionStore() error = %v", err)
+	}
+
+	if err := store.Save(&SessionRecord{ID: "../../escape"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("session directory has %d entries, want 1", len(entries))
+	}
+}
+
+func TestFileSessionStoreListSkipsCorruptFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileSessionStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileSessionStore() error = %v", err)
+	}
+
+	if err := store.Save(&SessionRecord{ID: "s1"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "truncated.json"), []byte(`{"id": "s2", "mess`), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	records, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(records) != 1 || records[0].ID != "s1" {
+		t.Errorf("List() = %#v, want only the readable session", records)
+	}
+}
+
+func TestFileSessionStoreLoadMovesCorruptFileAside(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileSessionStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileSessionStore() error = %v", err)
+	}
+
+	path := store.path("s1")
+	if err := os.WriteFile(path, []byte(`{"id": "s1", "mess`), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if loaded, err := store.Load("s1"); err != nil || loaded != nil {
+		t.Fatalf("Load() of corrupt session = %v, %v, want nil, nil", loaded, err)
+	}
+	if _, err := os.Stat(path + ".corrupt"); err != nil {
+		t.Errorf("corrupt file not moved aside: %v", err)
+	}
+
+	// The session starts over under the same ID
+	if err := store.Save(&SessionRecord{ID: "s1"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if loaded, err := store.Load("s1"); err != nil || loaded == nil {
+		t.Errorf("Load() after Save() = %v, %v, want the new session", loaded, err)
+	}
+}
+
+func TestManagerEvictsIdleSessions(t *testing.T) {
+	manager := newTestManager(t, newFakeLLMServer(t), ManagerConfig{})
+
+	memory, err := manager.getOrCreateMemory("first", testUser)
+	if err != nil {
+		t.Fatalf("getOrCreateMemory() error = %v", err)
+	}
+	memory.AddMessage("user", "Are my targets up?")
+	manager.saveSession("first", memory)
+
+	for n := 0; n < maxCachedSessions; n++ {
+		if _, err := manager.getOrCreateMemory(fmt.Sprintf("s%d", n), testUser); err != nil {
+			t.Fatalf("getOrCreateMemory() error = %v", err)
+		}
+	}
+
+	manager.mu.RLock()
+	cached, ok := len(manager.sessions), manager.sessions["first"] != nil
+	manager.mu.RUnlock()
+	if cached != maxCachedSessions || ok {
+		t.Fatalf("cache holds %d sessions (least recently used kept: %v), want %d without it", cached, ok, maxCachedSessions)
+	}
+
+	// The evicted session comes back from the store
+	detail, err := manager.GetSession("first", testUser)
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if len(detail.Messages) != 1 || detail.Owner != testUser.Login {
+		t.Errorf("reloaded session = %+v", detail)
+	}
+}
+
+func TestManagerLoadsSessionFromStore(t *testing.T) {
+	store, err := NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSessionStore() error = %v", err)
+	}
+
+	server := newFakeLLMServer(t)
+
+	// First manager writes history through the store
+	first := newTestManager(t, server, ManagerConfig{SessionStore: store})
+	memory, err := first.getOrCreateMemory("s1", testUser)
+	if err != nil {
+		t.Fatalf("getOrCreateMemory() error = %v", err)
+	}
+	memory.AddMessage("assistant", "Earlier finding")
+	first.saveSession("s1", memory)
+
+	// A new manager (as after a restart) picks it up lazily
+	second := newTestManager(t, server, ManagerConfig{SessionStore: store})
+	memory, err = second.getOrCreateMemory("s1", testUser)
+	if err != nil {
+		t.Fatalf("getOrCreateMemory() error = %v", err)
+	}
+
+	messages := memory.GetMessages()
+	if len(messages) != 1 || messages[0].Content != "Earlier finding" {
+		t.Errorf("restored messages = %#v, want the earlier finding", messages)
+	}
+}
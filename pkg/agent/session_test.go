@@ -0,0 +1,216 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestSessionAccessIsolation(t *testing.T) {
+	server := newFakeLLMServer(t)
+	store := NewInMemorySessionStore()
+	manager := newTestManager(t, server, ManagerConfig{SessionStore: store})
+
+	alice := User{Login: "alice"}
+	bob := User{Login: "bob"}
+	admin := User{Login: "admin", IsAdmin: true}
+
+	memory, err := manager.getOrCreateMemory("s1", alice)
+	if err != nil {
+		t.Fatalf("getOrCreateMemory(alice) error = %v", err)
+	}
+	memory.AddMessage("user", "private question")
+	manager.saveSession("s1", memory)
+
+	if _, err := manager.getOrCreateMemory("s1", bob); !errors.Is(err, ErrSessionForbidden) {
+		t.Errorf("getOrCreateMemory(bob) error = %v, want ErrSessionForbidden", err)
+	}
+	if _, err := manager.getOrCreateMemory("s1", admin); err != nil {
+		t.Errorf("getOrCreateMemory(admin) error = %v, want access", err)
+	}
+
+	// Ownership survives a restart through the store
+	restarted := newTestManager(t, server, ManagerConfig{SessionStore: store})
+	if _, err := restarted.getOrCreateMemory("s1", bob); !errors.Is(err, ErrSessionForbidden) {
+		t.Errorf("after restart getOrCreateMemory(bob) error = %v, want ErrSessionForbidden", err)
+	}
+	if _, err := restarted.getOrCreateMemory("s1", alice); err != nil {
+		t.Errorf("after restart getOrCreateMemory(alice) error = %v", err)
+	}
+}
+
+func TestLegacySessionsWithoutOwnerAreAdminOnly(t *testing.T) {
+	server := newFakeLLMServer(t)
+	store := NewInMemorySessionStore()
+	store.Save(&SessionRecord{ID: "session-1"})
+	manager := newTestManager(t, server, ManagerConfig{SessionStore: store})
+
+	if _, err := manager.getOrCreateMemory("session-1", User{Login: "alice"}); !errors.Is(err, ErrSessionForbidden) {
+		t.Errorf("getOrCreateMemory(alice) error = %v, want ErrSessionForbidden", err)
+	}
+	if _, err := manager.getOrCreateMemory("session-1", User{Login: "admin", IsAdmin: true}); err != nil {
+		t.Errorf("getOrCreateMemory(admin) error = %v", err)
+	}
+}
+
+func TestNewSessionID(t *testing.T) {
+	first, err := NewSessionID()
+	if err != nil {
+		t.Fatalf("NewSessionID() error = %v", err)
+	}
+	second, err := NewSessionID()
+	if err != nil {
+		t.Fatalf("NewSessionID() error = %v", err)
+	}
+
+	if first == second {
+		t.Error("NewSessionID() returned the same ID twice")
+	}
+	if !strings.HasPrefix(first, "session-") || len(first) != len("session-")+32 {
+		t.Errorf("NewSessionID() = %q, want session- followed by 32 hex characters", first)
+	}
+}
+
+func TestSessionManagement(t *testing.T) {
+	server := newFakeLLMServer(t)
+	manager := newTestManager(t, server, ManagerConfig{})
+
+	alice := User{Login: "alice"}
+	bob := User{Login: "bob"}
+
+	memory, err := manager.getOrCreateMemory("s1", alice)
+	if err != nil {
+		t.Fatalf("getOrCreateMemory() error = %v", err)
+	}
+	memory.AddMessage("user", "[Dashboard Context]\nName: Node Exporter\n\nWhy is CPU high on node-1?")
+	memory.AddMessage("assistant", "Because of a runaway process.")
+	manager.saveSession("s1", memory)
+
+	if _, err := manager.getOrCreateMemory("s2", bob); err != nil {
+		t.Fatalf("getOrCreateMemory() error = %v", err)
+	}
+	manager.saveSession("s2", NewConversationMemory())
+
+	// Listing only shows the caller's own sessions
+	sessions, err := manager.ListSessions(alice, true)
+	if err != nil {
+		t.Fatalf("ListSessions() error = %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != "s1" {
+		t.Fatalf("ListSessions(alice) = %+v, want only s1", sessions)
+	}
+	if sessions[0].Title != "Why is CPU high on node-1?" || sessions[0].MessageCount != 2 {
+		t.Errorf("ListSessions(alice)[0] = %+v, want derived title and 2 messages", sessions[0])
+	}
+
+	// Admins can list everyone's sessions on request
+	adminSessions, err := manager.ListSessions(User{Login: "admin", IsAdmin: true}, true)
+	if err != nil {
+		t.Fatalf("ListSessions() error = %v", err)
+	}
+	if len(adminSessions) != 2 {
+		t.Errorf("ListSessions(admin, all) = %d sessions, want 2", len(adminSessions))
+	}
+
+	// Rename
+	info, err := manager.RenameSession("s1", alice, "  CPU incident  ")
+	if err != nil {
+		t.Fatalf("RenameSession() error = %v", err)
+	}
+	if info.Title != "CPU incident" {
+		t.Errorf("RenameSession() title = %q, want CPU incident", info.Title)
+	}
+	if _, err := manager.RenameSession("s1", bob, "mine now"); !errors.Is(err, ErrSessionForbidden) {
+		t.Errorf("RenameSession(bob) error = %v, want ErrSessionForbidden", err)
+	}
+
+	// Fetch
+	detail, err := manager.GetSession("s1", alice)
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if detail.Title != "CPU incident" || len(detail.Messages) != 2 {
+		t.Errorf("GetSession() = %+v", detail)
+	}
+	if _, err := manager.GetSession("missing", alice); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetSession(missing) error = %v, want ErrSessionNotFound", err)
+	}
+
+	// Clear keeps the session but empties it
+	if err := manager.ClearSession("s1", alice); err != nil {
+		t.Fatalf("ClearSession() error = %v", err)
+	}
+	if detail, _ := manager.GetSession("s1", alice); detail == nil || len(detail.Messages) != 0 {
+		t.Errorf("GetSession() after clear = %+v, want no messages", detail)
+	}
+
+	// Delete removes it entirely
+	if err := manager.DeleteSession("s1", bob); !errors.Is(err, ErrSessionForbidden) {
+		t.Errorf("DeleteSession(bob) error = %v, want ErrSessionForbidden", err)
+	}
+	if err := manager.DeleteSession("s1", alice); err != nil {
+		t.Fatalf("DeleteSession() error = %v", err)
+	}
+	if _, err := manager.GetSession("s1", alice); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetSession() after delete error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestSessionDeletedMidTurnStaysDeleted(t *testing.T) {
+	server := newFakeLLMServer(t,
+		fakeStep{toolCalls: []openai.ToolCall{toolCall("call_1", "query_prometheus", `{"query":"up"}`)}},
+		fakeStep{content: "All targets are up."},
+	)
+	store := NewInMemorySessionStore()
+	manager := newTestManager(t, server, ManagerConfig{SessionStore: store})
+
+	// The user deletes the conversation while its tool call runs
+	execute := func(ctx context.Context, name string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		if err := manager.DeleteSession("s1", testUser); err != nil {
+			t.Errorf("DeleteSession() error = %v", err)
+		}
+		return mcp.NewTextResult("up=1"), nil
+	}
+
+	chunks, err := manager.RunChatStream(context.Background(), "Are my targets up?", "s1", testUser, execute)
+	if err != nil {
+		t.Fatalf("RunChatStream() error = %v", err)
+	}
+	collectChunks(t, chunks)
+
+	if record, err := store.Load("s1"); err != nil || record != nil {
+		t.Errorf("stored session after delete = %+v, %v, want none", record, err)
+	}
+	sessions, err := manager.ListSessions(User{Login: "admin", IsAdmin: true}, true)
+	if err != nil {
+		t.Fatalf("ListSessions() error = %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("ListSessions() = %+v, want the deleted session gone", sessions)
+	}
+}
+
+func TestDeriveTitle(t *testing.T) {
+	long := strings.Repeat("word ", 30)
+	tests := []struct {
+		name     string
+		messages []Message
+		want     string
+	}{
+		{name: "empty", messages: nil, want: "New conversation"},
+		{name: "first user message", messages: []Message{{Role: "assistant", Content: "hi"}, {Role: "user", Content: "Show  alerts\nnow"}}, want: "Show alerts now"},
+		{name: "truncated", messages: []Message{{Role: "user", Content: long}}, want: strings.TrimSpace(long[:maxTitleLength]) + "…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deriveTitle(tt.messages); got != tt.want {
+				t.Errorf("deriveTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
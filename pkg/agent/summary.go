@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxSummarizedContent is the length at which message content is truncated
+// before it is sent for summarization
+const maxSummarizedContent = 4000
+
+// summarizeEvicted folds messages trimmed from a session's history into its rolling summary.
+// Failures are logged and the messages are kept so the next attempt can include them.
+func (m *Manager) summarizeEvicted(ctx context.Context, sessionID string, memory *ConversationMemory) {
+	if !m.summarizeHistory {
+		return
+	}
+
+	evicted := memory.GetEvicted()
+	if len(evicted) == 0 {
+		return
+	}
+
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: SUMMARY_PROMPT},
+		{Role: openai.ChatMessageRoleUser, Content: buildSummaryRequest(memory.GetSummary(), evicted)},
+	}
+
+	reply, err := m.llmClient.Chat(ctx, messages, nil)
+	if err != nil {
+		log.DefaultLogger.Warn("Failed to summarize conversation history", "session", sessionID, "error", err)
+		return
+	}
+
+	summary := strings.TrimSpace(reply.Content)
+	if summary == "" {
+		log.DefaultLogger.Warn("LLM returned an empty conversation summary", "session", sessionID)
+		return
+	}
+
+	memory.ApplySummary(summary, len(evicted))
+	m.saveSession(sessionID, memory)
+}
+
+// buildSummaryRequest renders the current summary and the evicted messages as a transcript
+func buildSummaryRequest(summary string, evicted []Message) string {
+	var b strings.Builder
+
+	b.WriteString("Current summary:\n\n")
+	if summary == "" {
+		b.WriteString("(none yet)")
+	} else {
+		b.WriteString(summary)
+	}
+
+	b.WriteString("\n\nMessages removed from the history:\n")
+	for _, msg := range evicted {
+		switch msg.Role {
+		case "user":
+			fmt.Fprintf(&b, "\nOperator: %s\n", truncate(msg.Content, maxSummarizedContent))
+		case "assistant":
+			if msg.Content != "" {
+				fmt.Fprintf(&b, "\nAssistant: %s\n", truncate(msg.Content, maxSummarizedContent))
+			}
+			for _, call := range msg.ToolCalls {
+				fmt.Fprintf(&b, "\nAssistant called tool %s with %s\n", call.Name, call.Arguments)
+			}
+		case "tool":
+			fmt.Fprintf(&b, "\nTool result: %s\n", truncate(msg.Content, maxSummarizedContent))
+		default:
+			fmt.Fprintf(&b, "\n%s: %s\n", msg.Role, truncate(msg.Content, maxSummarizedContent))
+		}
+	}
+
+	return b.String()
+}
+
+// truncate shortens s to at most n bytes, marking the cut
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "… (truncated)"
+}
@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestSummarizeEvictedHistory(t *testing.T) {
+	server := newFakeLLMServer(t,
+		fakeStep{content: "- Checkout latency spiked at 09:00"},
+		fakeStep{content: "It has recovered since."},
+	)
+	manager := newTestManager(t, server, ManagerConfig{SummarizeHistory: true})
+
+	memory, err := manager.getOrCreateMemory("s1", testUser)
+	if err != nil {
+		t.Fatalf("getOrCreateMemory() error = %v", err)
+	}
+	memory.AddMessage("user", "Why is checkout slow?")
+	for i := 1; i < DefaultMaxMessages; i++ {
+		memory.AddMessage("assistant", fmt.Sprintf("Finding %d", i))
+	}
+
+	// The new question pushes the first message out of history
+	if _, err := manager.RunChat(context.Background(), "Is it still slow?", "s1", testUser, nil); err != nil {
+		t.Fatalf("RunChat() error = %v", err)
+	}
+
+	requests := server.recorded()
+	if len(requests) != 2 {
+		t.Fatalf("LLM received %d requests, want 2 (summary and chat)", len(requests))
+	}
+
+	summaryRequest := requests[0].Messages[1].Content
+	if !strings.Contains(summaryRequest, "Operator: Why is checkout slow?") {
+		t.Errorf("summary request does not contain the evicted message:\n%s", summaryRequest)
+	}
+	if len(requests[0].Tools) != 0 {
+		t.Errorf("summary request offered %d tools, want none", len(requests[0].Tools))
+	}
+
+	chat := requests[1].Messages
+	if chat[1].Role != openai.ChatMessageRoleSystem || !strings.HasSuffix(chat[1].Content, "- Checkout latency spiked at 09:00") {
+		t.Errorf("chat request second message = %+v, want the summary", chat[1])
+	}
+
+	detail, err := manager.GetSession("s1", testUser)
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if detail.Summary != "- Checkout latency spiked at 09:00" {
+		t.Errorf("GetSession().Summary = %q", detail.Summary)
+	}
+	if evicted := memory.GetEvicted(); len(evicted) != 1 || evicted[0].Content != "Finding 1" {
+		t.Errorf("evicted after the answer = %+v, want only the message trimmed since", evicted)
+	}
+}
+
+func TestSummarizeFailureKeepsEvictedMessages(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	llmClient, err := llm.NewLLMClient(failing.URL, "test-key")
+	if err != nil {
+		t.Fatalf("NewLLMClient() error = %v", err)
+	}
+	manager, err := NewManagerWithConfig(llmClient, nil, nil, ManagerConfig{SummarizeHistory: true})
+	if err != nil {
+		t.Fatalf("NewManagerWithConfig() error = %v", err)
+	}
+
+	memory, err := manager.getOrCreateMemory("s1", testUser)
+	if err != nil {
+		t.Fatalf("getOrCreateMemory() error = %v", err)
+	}
+	memory.RestoreSummary("", []Message{{Role: "user", Content: "Early question"}})
+
+	manager.summarizeEvicted(context.Background(), "s1", memory)
+
+	if got := memory.GetEvicted(); len(got) != 1 {
+		t.Errorf("evicted after failure = %+v, want the message kept", got)
+	}
+	if got := memory.GetSummary(); got != "" {
+		t.Errorf("summary after failure = %q, want empty", got)
+	}
+}
@@ -0,0 +1,197 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrUnknownTool is returned when a tool name is not offered by any MCP server
+var ErrUnknownTool = errors.New("unknown tool")
+
+// ToolRoute is where a tool offered to the model runs
+type ToolRoute struct {
+	Server string // MCP server type
+	Tool   string // Name of the tool on that server
+}
+
+// ToolCollision is a tool name exposed by more than one MCP server. Only the
+// first server (in name order) is offered the name; the others' tools are hidden.
+type ToolCollision struct {
+	Tool    string   `json:"tool"`
+	Servers []string `json:"servers"`
+}
+
+// toolset is everything derived from the MCP servers' tool lists. It is replaced
+// as a whole when the tools change, so a chat turn never sees half an update.
+type toolset struct {
+	tools        []openai.Tool
+	mutating     map[string]bool      // Tools that need the user's approval before they run
+	routes       map[string]ToolRoute // Server and original name of each exposed tool
+	collisions   []ToolCollision
+	resources    []string // Servers read_resource may read from
+	systemPrompt string
+	generation   uint64 // Sum of the clients' tool generations the set was built from
+}
+
+// currentTools returns the toolset in use
+func (m *Manager) currentTools() *toolset {
+	return m.toolset.Load()
+}
+
+// refreshTools rebuilds the toolset if any MCP server's tool list changed since it
+// was built. Expired client caches are refetched on the way.
+func (m *Manager) refreshTools(ctx context.Context) {
+	m.toolsMu.Lock()
+	defer m.toolsMu.Unlock()
+
+	toolsByServer, resourcesByServer, generation := m.discoverTools(ctx)
+	if current := m.currentTools(); current != nil && current.generation == generation {
+		return
+	}
+
+	m.toolset.Store(m.buildToolset(toolsByServer, resourcesByServer, generation))
+	log.DefaultLogger.Info("MCP tools updated", "tools", len(m.currentTools().tools))
+}
+
+// discoverTools returns each MCP server's tools, the resources of the available
+// servers publishing any and the sum of the servers' generations, which only grows,
+// so any change to any server's tools or resources changes it. Both lists come
+// from the clients' caches unless they expired or the server reported a change.
+func (m *Manager) discoverTools(ctx context.Context) (map[string][]mcp.Tool, map[string]*mcp.ResourceList, uint64) {
+	toolsByServer := make(map[string][]mcp.Tool, len(m.mcpClients))
+	resourcesByServer := make(map[string]*mcp.ResourceList)
+	var generation uint64
+
+	for serverType, client := range m.mcpClients {
+		tools, err := client.DiscoverTools(ctx)
+		if err != nil {
+			log.DefaultLogger.Warn("Failed to discover MCP tools", "type", serverType, "error", err)
+		}
+		toolsByServer[serverType] = tools
+
+		if client.Available() && client.SupportsResources() {
+			resources, err := client.DiscoverResources(ctx)
+			if err != nil {
+				// The server can still be asked for a resource by URI
+				log.DefaultLogger.Warn("Failed to discover MCP resources", "type", serverType, "error", err)
+				resources = &mcp.ResourceList{}
+			}
+			resourcesByServer[serverType] = resources
+		}
+
+		generation += client.ToolsGeneration()
+	}
+
+	return toolsByServer, resourcesByServer, generation
+}
+
+// buildToolset derives the tools offered to the model, their routes and
+// classification and the system prompt from the servers' tool and resource lists
+func (m *Manager) buildToolset(toolsByServer map[string][]mcp.Tool, resourcesByServer map[string]*mcp.ResourceList, generation uint64) *toolset {
+	offered, routes, collisions := m.routeTools(toolsByServer)
+	mutating := classifyMCPTools(offered, routes, m.toolAccess)
+
+	// read_resource counts as a tool of each server it reads from for the allow/deny lists
+	readable := make(map[string]*mcp.ResourceList, len(resourcesByServer))
+	for serverType, resources := range resourcesByServer {
+		if m.toolPolicy.serverAllows(ToolRoute{Server: serverType, Tool: ReadResourceTool}, ReadResourceTool) {
+			readable[serverType] = resources
+		}
+	}
+
+	tools := convertMCPToolsToOpenAI(offered)
+	readResource, resourceServers, ok := buildReadResourceTool(readable)
+	if ok {
+		tools = append(tools, readResource)
+	}
+
+	return &toolset{
+		tools:        tools,
+		mutating:     mutating,
+		routes:       routes,
+		collisions:   collisions,
+		resources:    resourceServers,
+		systemPrompt: BuildSystemPrompt(m.mcpTypes, m.serverPrompts),
+		generation:   generation,
+	}
+}
+
+// routeTools maps each exposed tool name to the server offering it. A name exposed
+// by several servers stays with the first and is reported as a collision.
+func (m *Manager) routeTools(toolsByServer map[string][]mcp.Tool) (map[string][]mcp.Tool, map[string]ToolRoute, []ToolCollision) {
+	offered := make(map[string][]mcp.Tool, len(toolsByServer))
+	routes := make(map[string]ToolRoute)
+	collided := make(map[string]int) // Tool name -> index in collisions
+	var collisions []ToolCollision
+
+	for _, serverType := range sortedServers(toolsByServer) {
+		prefix := mcp.DefaultToolPrefix(serverType)
+		if client := m.mcpClients[serverType]; client != nil {
+			prefix = client.ToolPrefix()
+		}
+
+		for _, tool := range toolsByServer[serverType] {
+			route, taken := routes[tool.Name]
+			if !taken && tool.Name == ReadResourceTool {
+				route, taken = ToolRoute{Server: "plugin", Tool: ReadResourceTool}, true
+			}
+			if taken {
+				n, ok := collided[tool.Name]
+				if !ok {
+					n = len(collisions)
+					collided[tool.Name] = n
+					collisions = append(collisions, ToolCollision{Tool: tool.Name, Servers: []string{route.Server}})
+				}
+				collisions[n].Servers = append(collisions[n].Servers, serverType)
+				continue
+			}
+
+			routes[tool.Name] = ToolRoute{Server: serverType, Tool: strings.TrimPrefix(tool.Name, prefix)}
+			offered[serverType] = append(offered[serverType], tool)
+		}
+	}
+
+	for _, c := range collisions {
+		log.DefaultLogger.Warn("MCP tool name exposed by several servers", "tool", c.Tool, "servers", c.Servers, "used", c.Servers[0])
+	}
+
+	return offered, routes, collisions
+}
+
+// ResolveTool returns the server and original name of a tool offered to the model,
+// or an error wrapping ErrUnknownTool
+func (m *Manager) ResolveTool(toolName string) (ToolRoute, error) {
+	route, ok := m.currentTools().routes[toolName]
+	if !ok {
+		return ToolRoute{}, fmt.Errorf("%w: %s is not offered by any connected MCP server", ErrUnknownTool, toolName)
+	}
+	return route, nil
+}
+
+// ResourceServers returns the MCP servers the read_resource tool may read from,
+// in name order: those publishing resources that the tool policy allows it on
+func (m *Manager) ResourceServers() []string {
+	return append([]string{}, m.currentTools().resources...)
+}
+
+// ToolCollisions returns the tool names exposed by more than one MCP server
+func (m *Manager) ToolCollisions() []ToolCollision {
+	return append([]ToolCollision{}, m.currentTools().collisions...)
+}
+
+// sortedServers returns the server types of toolsByServer in a stable order
+func sortedServers(toolsByServer map[string][]mcp.Tool) []string {
+	servers := make([]string, 0, len(toolsByServer))
+	for serverType := range toolsByServer {
+		servers = append(servers, serverType)
+	}
+	sort.Strings(servers)
+	return servers
+}
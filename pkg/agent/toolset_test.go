@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp/mcptest"
+)
+
+func TestRefreshToolsRebuildsToolset(t *testing.T) {
+	var mu sync.Mutex
+	tools := []mcp.Tool{{Name: "list_alerts"}}
+
+	server := mcptest.NewServer(t, map[string]interface{}{"tools": map[string]interface{}{}}, map[string]mcptest.Handler{
+		"tools/list": func(params map[string]interface{}) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return map[string]interface{}{"tools": tools}, nil
+		},
+	})
+
+	ctx := context.Background()
+	client := mcp.NewClient(server.URL, "alertmanager")
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	llmClient, err := llm.NewLLMClient(newFakeLLMServer(t).URL, "test-key")
+	if err != nil {
+		t.Fatalf("NewLLMClient() error = %v", err)
+	}
+	manager, err := NewManagerWithConfig(llmClient, map[string]*mcp.Client{"alertmanager": client}, []string{"alertmanager"}, ManagerConfig{})
+	if err != nil {
+		t.Fatalf("NewManagerWithConfig() error = %v", err)
+	}
+
+	before := manager.currentTools()
+	if len(before.tools) != 1 || before.systemPrompt == "" {
+		t.Fatalf("initial toolset has %d tools and prompt %q, want 1 tool and a prompt", len(before.tools), before.systemPrompt)
+	}
+
+	// Nothing changed: the toolset is kept
+	manager.refreshTools(ctx)
+	if manager.currentTools() != before {
+		t.Error("refreshTools() replaced the toolset although no tools changed")
+	}
+
+	mu.Lock()
+	tools = append(tools, mcp.Tool{Name: "post_silence"})
+	mu.Unlock()
+	if _, err := client.RefreshTools(ctx); err != nil {
+		t.Fatalf("RefreshTools() error = %v", err)
+	}
+	manager.refreshTools(ctx)
+
+	after := manager.currentTools()
+	if len(after.tools) != 2 || !after.mutating["alertmanager__post_silence"] || after.routes["alertmanager__post_silence"] != (ToolRoute{Server: "alertmanager", Tool: "post_silence"}) {
+		t.Errorf("refreshed toolset = %+v, want the new mutating alertmanager tool", after)
+	}
+	if len(before.tools) != 1 {
+		t.Error("refreshTools() modified the previous toolset instead of replacing it")
+	}
+}
+
+func TestRouteToolsCollisions(t *testing.T) {
+	manager := newTestManager(t, newFakeLLMServer(t), ManagerConfig{})
+
+	set := manager.buildToolset(map[string][]mcp.Tool{
+		"grafana":      {{Name: "list_alerts"}, {Name: "search_dashboards"}},
+		"alertmanager": {{Name: "alertmanager__list_alerts"}},
+		"genesys":      {{Name: "list_alerts"}},
+	}, nil, 1)
+	manager.toolset.Store(set)
+
+	if len(set.tools) != 3 {
+		t.Errorf("toolset offers %d tools, want 3 (the colliding list_alerts once)", len(set.tools))
+	}
+	want := []ToolCollision{{Tool: "list_alerts", Servers: []string{"genesys", "grafana"}}}
+	if !reflect.DeepEqual(manager.ToolCollisions(), want) {
+		t.Errorf("ToolCollisions() = %+v, want %+v", manager.ToolCollisions(), want)
+	}
+
+	route, err := manager.ResolveTool("alertmanager__list_alerts")
+	if err != nil || route != (ToolRoute{Server: "alertmanager", Tool: "list_alerts"}) {
+		t.Errorf("ResolveTool(alertmanager__list_alerts) = %+v, %v", route, err)
+	}
+	if route, err := manager.ResolveTool("list_alerts"); err != nil || route.Server != "genesys" {
+		t.Errorf("ResolveTool(list_alerts) = %+v, %v; want the genesys tool", route, err)
+	}
+	if _, err := manager.ResolveTool("drop_database"); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("ResolveTool(drop_database) error = %v, want ErrUnknownTool", err)
+	}
+}
+
+func TestRouteToolsCollisionsAcrossThreeServers(t *testing.T) {
+	manager := newTestManager(t, newFakeLLMServer(t), ManagerConfig{})
+
+	// Each collision adds to the list, so earlier entries must not be left behind
+	shared := []mcp.Tool{{Name: "x"}, {Name: "y"}}
+	_, _, collisions := manager.routeTools(map[string][]mcp.Tool{"a": shared, "b": shared, "c": shared})
+
+	want := []ToolCollision{
+		{Tool: "x", Servers: []string{"a", "b", "c"}},
+		{Tool: "y", Servers: []string{"a", "b", "c"}},
+	}
+	if !reflect.DeepEqual(collisions, want) {
+		t.Errorf("routeTools() collisions = %+v, want %+v", collisions, want)
+	}
+}
+
+func TestBuildSystemPromptServerPrompts(t *testing.T) {
+	prompt := BuildSystemPrompt([]string{"alertmanager", "loki"}, map[string]string{
+		"loki":  "Use loki tools for application logs.",
+		"tempo": "Not configured.",
+	})
+
+	if !strings.Contains(prompt, ALERTMANAGER_PROMPT_ADDITION) {
+		t.Error("prompt lacks the built-in AlertManager addition")
+	}
+	if !strings.Contains(prompt, "## loki MCP Server\n\nUse loki tools for application logs.") {
+		t.Error("prompt lacks the loki server's addition")
+	}
+	if strings.Contains(prompt, "Not configured.") {
+		t.Error("prompt includes the addition of a server that is not connected")
+	}
+}
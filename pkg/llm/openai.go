@@ -13,13 +13,24 @@ import (
 
 // StreamChunk represents a chunk of streaming response
 type StreamChunk struct {
-	Type      string                 `json:"type"`
-	Message   string                 `json:"message,omitempty"`
-	Tool      string                 `json:"tool,omitempty"`
-	Arguments map[string]interface{} `json:"arguments,omitempty"`
-	Result    interface{}            `json:"result,omitempty"`
+	Type       string                 `json:"type"`
+	SessionID  string                 `json:"session_id,omitempty"`
+	Message    string                 `json:"message,omitempty"`
+	Tool       string                 `json:"tool,omitempty"`
+	ToolCallID string                 `json:"tool_call_id,omitempty"`
+	ApprovalID string                 `json:"approval_id,omitempty"`
+	Arguments  map[string]interface{} `json:"arguments,omitempty"`
+	Result     interface{}            `json:"result,omitempty"`
+	Output     interface{}            `json:"output,omitempty"` // Full tool result: content blocks (images included), error flag, structured content
+	Model      string                 `json:"model,omitempty"`  // start and complete: the model answering
 }
 
+// Model tiers of the Grafana LLM App, which maps them to models of the configured provider
+const (
+	ModelBase  = string(llmclient.ModelBase)  // Fast and cheap, for simple questions
+	ModelLarge = string(llmclient.ModelLarge) // Most capable; the default
+)
+
 // LLMClient wraps the Grafana LLM App client
 type LLMClient struct {
 	provider llmclient.LLMProvider
@@ -46,26 +57,48 @@ func (c *LLMClient) Enabled(ctx context.Context) (bool, error) {
 	return c.provider.Enabled(ctx)
 }
 
-// Chat performs a non-streaming chat completion via Grafana LLM App
-func (c *LLMClient) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, tools []openai.Tool) (string, error) {
+// Model returns the model requests are sent to unless their context names another
+func (c *LLMClient) Model() string {
+	return ModelLarge
+}
+
+type modelContextKey struct{}
+
+// WithModel returns a context whose chat requests use model: a tier (ModelBase,
+// ModelLarge) or the name of a model the LLM App's provider offers
+func WithModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelContextKey{}, model)
+}
+
+// ModelFor returns the model chat requests made with ctx are sent to
+func (c *LLMClient) ModelFor(ctx context.Context) string {
+	if model, _ := ctx.Value(modelContextKey{}).(string); model != "" {
+		return model
+	}
+	return c.Model()
+}
+
+// Chat performs a non-streaming chat completion via Grafana LLM App.
+// The returned message carries both the content and any tool calls the model requested.
+func (c *LLMClient) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, tools []openai.Tool) (openai.ChatCompletionMessage, error) {
 	req := llmclient.ChatCompletionRequest{
 		ChatCompletionRequest: openai.ChatCompletionRequest{
 			Messages: messages,
 			Tools:    tools,
 		},
-		Model: llmclient.ModelLarge,
+		Model: llmclient.Model(c.ModelFor(ctx)),
 	}
 
 	resp, err := c.provider.ChatCompletions(ctx, req)
 	if err != nil {
-		return "", fmt.Errorf("LLM API error: %w", err)
+		return openai.ChatCompletionMessage{}, fmt.Errorf("LLM API error: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
-		return "", errors.New("no response from LLM")
+		return openai.ChatCompletionMessage{}, errors.New("no response from LLM")
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	return resp.Choices[0].Message, nil
 }
 
 // StreamChat performs a streaming chat completion via Grafana LLM App
@@ -78,7 +111,7 @@ func (c *LLMClient) StreamChat(ctx context.Context, messages []openai.ChatComple
 			Tools:    tools,
 			Stream:   true,
 		},
-		Model: llmclient.ModelLarge,
+		Model: llmclient.Model(c.ModelFor(ctx)),
 	}
 
 	stream, err := c.provider.ChatCompletionsStream(ctx, req)
@@ -160,21 +193,26 @@ func (c *LLMClient) StreamChat(ctx context.Context, messages []openai.ChatComple
 					continue
 				}
 
-				// Parse arguments
-				var args map[string]interface{}
+				// Parse arguments (tools without parameters may stream none at all)
+				args := map[string]interface{}{}
+				if tc.Function.Arguments == "" {
+					tc.Function.Arguments = "{}"
+				}
+				// Unparseable arguments still make a tool call, whose Message holds the
+				// error so it can be returned to the model as the call's result
+				var argsErr string
 				if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
-					chunks <- StreamChunk{
-						Type:    "error",
-						Message: fmt.Sprintf("Failed to parse tool arguments: %v", err),
-					}
-					continue
+					args = map[string]interface{}{}
+					argsErr = fmt.Sprintf("invalid tool arguments: %v", err)
 				}
 
 				// Send tool call event
 				chunks <- StreamChunk{
-					Type:      "tool",
-					Tool:      tc.Function.Name,
-					Arguments: args,
+					Type:       "tool",
+					Tool:       tc.Function.Name,
+					ToolCallID: tc.ID,
+					Arguments:  args,
+					Message:    argsErr,
 				}
 			}
 		}
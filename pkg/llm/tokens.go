@@ -0,0 +1,122 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultContextWindow is the context window assumed for models we do not know
+const DefaultContextWindow = 128000
+
+// Token overheads from OpenAI's chat format: every message is wrapped in
+// role/separator tokens and every reply is primed with a few more.
+const (
+	tokensPerMessage  = 3
+	tokensPerToolCall = 3
+	tokensPerTool     = 8
+	tokensReplyPrimer = 3
+)
+
+// contextWindows maps model name prefixes to their context window in tokens.
+// More specific prefixes must come first.
+var contextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	// Abstract models exposed by the Grafana LLM App (gpt-4o-mini / gpt-4o by default)
+	{"base", 128000},
+	{"large", 128000},
+
+	{"gpt-4.1", 1047576},
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4-32k", 32768},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo", 16385},
+	{"o1", 200000},
+	{"o3", 200000},
+	{"o4", 200000},
+	{"claude", 200000},
+}
+
+func init() {
+	// Use the encodings bundled into the binary instead of downloading them at runtime
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// ContextWindow returns the context window, in tokens, of a model
+func ContextWindow(model string) int {
+	model = strings.ToLower(model)
+	for _, w := range contextWindows {
+		if strings.HasPrefix(model, w.prefix) {
+			return w.tokens
+		}
+	}
+	return DefaultContextWindow
+}
+
+// TokenCounter counts the tokens a chat request uses, using tiktoken encodings
+type TokenCounter struct {
+	encoding *tiktoken.Tiktoken
+}
+
+// NewTokenCounter creates a token counter for a model.
+// Models tiktoken does not know (including the LLM App's abstract models) use o200k_base.
+func NewTokenCounter(model string) (*TokenCounter, error) {
+	encoding, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		encoding, err = tiktoken.GetEncoding(tiktoken.MODEL_O200K_BASE)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load token encoding: %w", err)
+		}
+	}
+
+	return &TokenCounter{encoding: encoding}, nil
+}
+
+// Count returns the number of tokens in a piece of text
+func (c *TokenCounter) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	return len(c.encoding.EncodeOrdinary(text))
+}
+
+// CountMessage returns the tokens a single message contributes to a request
+func (c *TokenCounter) CountMessage(msg openai.ChatCompletionMessage) int {
+	tokens := tokensPerMessage + c.Count(msg.Role) + c.Count(msg.Content) + c.Count(msg.Name) + c.Count(msg.ToolCallID)
+	for _, call := range msg.ToolCalls {
+		tokens += tokensPerToolCall + c.Count(call.ID) + c.Count(call.Function.Name) + c.Count(call.Function.Arguments)
+	}
+	return tokens
+}
+
+// CountMessages returns the tokens used by a list of messages, including the reply primer
+func (c *TokenCounter) CountMessages(messages []openai.ChatCompletionMessage) int {
+	tokens := tokensReplyPrimer
+	for _, msg := range messages {
+		tokens += c.CountMessage(msg)
+	}
+	return tokens
+}
+
+// CountTools returns the tokens used by tool definitions
+func (c *TokenCounter) CountTools(tools []openai.Tool) int {
+	tokens := 0
+	for _, tool := range tools {
+		if tool.Function == nil {
+			continue
+		}
+		definition, err := json.Marshal(tool.Function)
+		if err != nil {
+			continue
+		}
+		tokens += tokensPerTool + c.Count(string(definition))
+	}
+	return tokens
+}
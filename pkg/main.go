@@ -13,9 +13,15 @@ func main() {
 	p := plugin.NewPlugin()
 
 	// Serve plugin using backend.Manage with ServeOpts
-	if err := backend.Manage("sabio-sm3-chat-plugin", backend.ServeOpts{
+	err := backend.Manage("sabio-sm3-chat-plugin", backend.ServeOpts{
 		CallResourceHandler: p,
-	}); err != nil {
+		CheckHealthHandler:  p,
+	})
+
+	// Stop MCP server processes launched by the plugin
+	p.Dispose()
+
+	if err != nil {
 		log.DefaultLogger.Error("Plugin exited with error", "error", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,177 @@
+package mcp
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ArgumentRules adjust how a server's tool arguments are normalized before a call.
+// Tool names are the server's own, without the prefix they are exposed with.
+type ArgumentRules struct {
+	TimeProperties []string                          `json:"time_properties"` // Extra properties holding times, as "property" or "tool.property"
+	Aliases        map[string]string                 `json:"aliases"`         // Argument name -> declared property it is renamed to
+	Defaults       map[string]map[string]interface{} `json:"defaults"`        // Tool -> property -> value used when the argument is missing
+}
+
+// defaultArgumentRules are the rules for the servers the plugin is built for, whose
+// time arguments are plain strings without a date-time format
+var defaultArgumentRules = map[string]ArgumentRules{
+	"grafana": {
+		TimeProperties: []string{"startTime", "endTime", "startRfc3339", "endRfc3339"},
+		Defaults: map[string]map[string]interface{}{
+			"query_prometheus": {"stepSeconds": 60},
+		},
+	},
+	"genesys": {
+		TimeProperties: []string{"startTime", "endTime"},
+	},
+}
+
+// withDefaults returns the rules added to the server type's default rules; for
+// aliases and defaults set in both, the configured value wins
+func (r ArgumentRules) withDefaults(serverType string) ArgumentRules {
+	base := defaultArgumentRules[serverType]
+	merged := ArgumentRules{
+		TimeProperties: append(append([]string(nil), base.TimeProperties...), r.TimeProperties...),
+		Aliases:        make(map[string]string, len(base.Aliases)+len(r.Aliases)),
+		Defaults:       make(map[string]map[string]interface{}, len(base.Defaults)+len(r.Defaults)),
+	}
+
+	for _, rules := range []ArgumentRules{base, r} {
+		for key, property := range rules.Aliases {
+			merged.Aliases[key] = property
+		}
+		for tool, defaults := range rules.Defaults {
+			if merged.Defaults[tool] == nil {
+				merged.Defaults[tool] = make(map[string]interface{}, len(defaults))
+			}
+			for property, value := range defaults {
+				merged.Defaults[tool][property] = value
+			}
+		}
+	}
+	return merged
+}
+
+// normalizeArguments fits the model's arguments to the tool's input schema:
+//   - keys that only differ from a declared property in case style (snake_case or
+//     camelCase) are renamed to that property
+//   - relative times ("now", "now-1h") become RFC3339 for date-time properties
+//   - missing properties get their schema default
+//
+// Tools without a known schema only get the configured rules applied.
+func (c *Client) normalizeArguments(toolName string, args map[string]interface{}) map[string]interface{} {
+	properties := schemaProperties(c.toolSchema(toolName))
+	rules := c.argumentRules
+	normalized := make(map[string]interface{}, len(args))
+
+	// Keys used as given win over keys renamed onto the same property
+	renamed := make(map[string]interface{})
+	for key, value := range args {
+		if name := rules.propertyName(key, properties); name != key {
+			renamed[name] = value
+		} else {
+			normalized[key] = value
+		}
+	}
+	for name, value := range renamed {
+		if _, ok := normalized[name]; !ok {
+			normalized[name] = value
+		}
+	}
+
+	for key, value := range normalized {
+		strVal, ok := value.(string)
+		if !ok || !strings.HasPrefix(strVal, "now") || !rules.isTimeProperty(toolName, key, properties) {
+			continue
+		}
+		if timestamp, err := parseRelativeTime(strVal); err == nil {
+			normalized[key] = timestamp
+		}
+	}
+
+	for name, property := range properties {
+		if def, ok := property["default"]; ok {
+			if _, set := normalized[name]; !set {
+				normalized[name] = def
+			}
+		}
+	}
+	for name, def := range rules.Defaults[toolName] {
+		if _, set := normalized[name]; !set {
+			normalized[name] = def
+		}
+	}
+
+	return normalized
+}
+
+// propertyName returns the declared property an argument key stands for, or the key
+// itself when it is declared or has no unambiguous match
+func (r ArgumentRules) propertyName(key string, properties map[string]map[string]interface{}) string {
+	if alias, ok := r.Aliases[key]; ok {
+		return alias
+	}
+	if _, ok := properties[key]; ok || properties == nil {
+		return key
+	}
+
+	for _, candidate := range []string{toCamelCase(key), toSnakeCase(key)} {
+		if _, ok := properties[candidate]; ok {
+			return candidate
+		}
+	}
+	return key
+}
+
+// isTimeProperty reports whether a tool's property holds a point in time
+func (r ArgumentRules) isTimeProperty(toolName, name string, properties map[string]map[string]interface{}) bool {
+	for _, p := range r.TimeProperties {
+		if p == name || p == toolName+"."+name {
+			return true
+		}
+	}
+
+	format, _ := properties[name]["format"].(string)
+	return format == "date-time"
+}
+
+// toolSchema returns a tool's input schema from the last tool list, or nil if the
+// tool has not been discovered. It never waits for a tool list refresh.
+func (c *Client) toolSchema(toolName string) map[string]interface{} {
+	schemas := c.toolSchemas.Load()
+	if schemas == nil {
+		return nil
+	}
+	return (*schemas)[c.toolPrefix+toolName]
+}
+
+// schemaProperties returns the top-level properties declared by an object schema
+func schemaProperties(schema map[string]interface{}) map[string]map[string]interface{} {
+	declared, ok := schema["properties"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	properties := make(map[string]map[string]interface{}, len(declared))
+	for name, property := range declared {
+		p, _ := property.(map[string]interface{})
+		properties[name] = p
+	}
+	return properties
+}
+
+// toSnakeCase converts camelCase to snake_case
+func toSnakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
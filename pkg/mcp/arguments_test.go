@@ -0,0 +1,186 @@
+package mcp
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNormalizeArguments(t *testing.T) {
+	querySchema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"datasourceUid": map[string]interface{}{"type": "string"},
+			"expr":          map[string]interface{}{"type": "string"},
+			"startTime":     map[string]interface{}{"type": "string", "format": "date-time"},
+			"stepSeconds":   map[string]interface{}{"type": "integer", "default": float64(60)},
+			"label_value":   map[string]interface{}{"type": "string"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		tool     string
+		rules    ArgumentRules
+		args     map[string]interface{}
+		want     map[string]interface{}
+		wantTime []string // Keys expected to hold an RFC3339 timestamp
+	}{
+		{
+			name: "renames keys to declared properties only",
+			tool: "query_prometheus",
+			args: map[string]interface{}{"datasource_uid": "abc", "labelValue": "x", "folder_uid": "f"},
+			want: map[string]interface{}{"datasourceUid": "abc", "label_value": "x", "folder_uid": "f", "stepSeconds": float64(60)},
+		},
+		{
+			name: "declared key wins over a renamed one",
+			tool: "query_prometheus",
+			args: map[string]interface{}{"datasourceUid": "exact", "datasource_uid": "renamed"},
+			want: map[string]interface{}{"datasourceUid": "exact", "stepSeconds": float64(60)},
+		},
+		{
+			name:     "converts relative times only for date-time properties",
+			tool:     "query_prometheus",
+			args:     map[string]interface{}{"start_time": "now-1h", "expr": "now-playing", "label_value": "now-1h"},
+			want:     map[string]interface{}{"expr": "now-playing", "label_value": "now-1h", "stepSeconds": float64(60)},
+			wantTime: []string{"startTime"},
+		},
+		{
+			name: "keeps given values over defaults",
+			tool: "query_prometheus",
+			args: map[string]interface{}{"stepSeconds": 15},
+			want: map[string]interface{}{"stepSeconds": 15},
+		},
+		{
+			name: "passes arguments of unknown tools through",
+			tool: "unknown_tool",
+			args: map[string]interface{}{"folder_uid": "f", "since": "now-1h"},
+			want: map[string]interface{}{"folder_uid": "f", "since": "now-1h"},
+		},
+		{
+			name: "applies configured rules",
+			tool: "unknown_tool",
+			rules: ArgumentRules{
+				TimeProperties: []string{"unknown_tool.since"},
+				Aliases:        map[string]string{"uid": "dashboardUid"},
+				Defaults:       map[string]map[string]interface{}{"unknown_tool": {"limit": 10}},
+			},
+			args:     map[string]interface{}{"uid": "d1", "since": "now-1h"},
+			want:     map[string]interface{}{"dashboardUid": "d1", "limit": 10},
+			wantTime: []string{"since"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient("http://localhost", "grafana")
+			client.setTools([]Tool{{Name: "query_prometheus", InputSchema: querySchema}})
+			client.argumentRules = tt.rules
+
+			got := client.normalizeArguments(tt.tool, tt.args)
+
+			if len(got) != len(tt.want)+len(tt.wantTime) {
+				t.Errorf("normalizeArguments() = %v, want %d keys", got, len(tt.want)+len(tt.wantTime))
+			}
+			for key, wantVal := range tt.want {
+				if gotVal, ok := got[key]; !ok || gotVal != wantVal {
+					t.Errorf("normalizeArguments() key %v = %v, want %v", key, gotVal, wantVal)
+				}
+			}
+			for _, key := range tt.wantTime {
+				value, _ := got[key].(string)
+				if _, err := time.Parse(time.RFC3339, value); err != nil {
+					t.Errorf("normalizeArguments() key %v = %q, want an RFC3339 timestamp", key, value)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeArgumentsDefaultRules(t *testing.T) {
+	// Grafana's query tools declare their times as plain strings
+	querySchema := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"expr":        map[string]interface{}{"type": "string"},
+			"startTime":   map[string]interface{}{"type": "string"},
+			"endTime":     map[string]interface{}{"type": "string"},
+			"stepSeconds": map[string]interface{}{"type": "integer"},
+		},
+	}
+
+	client := NewClient("http://localhost", "grafana")
+	client.setTools([]Tool{{Name: "query_prometheus", InputSchema: querySchema}})
+
+	got := client.normalizeArguments("query_prometheus", map[string]interface{}{"expr": "up", "start_time": "now-1h", "endTime": "now"})
+	for _, key := range []string{"startTime", "endTime"} {
+		if _, err := time.Parse(time.RFC3339, fmt.Sprint(got[key])); err != nil {
+			t.Errorf("normalizeArguments() key %v = %v, want an RFC3339 timestamp", key, got[key])
+		}
+	}
+	if got["stepSeconds"] != 60 {
+		t.Errorf("normalizeArguments() stepSeconds = %v, want 60", got["stepSeconds"])
+	}
+
+	// Configured rules add to the defaults and override them
+	client, err := NewClientWithConfig("http://localhost", "grafana", ClientConfig{Arguments: ArgumentRules{
+		Defaults: map[string]map[string]interface{}{"query_prometheus": {"stepSeconds": 15}},
+	}})
+	if err != nil {
+		t.Fatalf("NewClientWithConfig() error = %v", err)
+	}
+	client.setTools([]Tool{{Name: "query_prometheus", InputSchema: querySchema}})
+
+	got = client.normalizeArguments("query_prometheus", map[string]interface{}{"startTime": "now-1h"})
+	if _, err := time.Parse(time.RFC3339, fmt.Sprint(got["startTime"])); err != nil || got["stepSeconds"] != 15 {
+		t.Errorf("normalizeArguments() with configured rules = %v, want startTime converted and stepSeconds 15", got)
+	}
+
+	// Other servers do not get Grafana's rules
+	client = NewClient("http://localhost", "alertmanager")
+	got = client.normalizeArguments("query_prometheus", map[string]interface{}{"startTime": "now-1h"})
+	if got["startTime"] != "now-1h" || got["stepSeconds"] != nil {
+		t.Errorf("normalizeArguments() for alertmanager = %v, want arguments unchanged", got)
+	}
+}
+
+func TestNormalizeArgumentsPrefixedTools(t *testing.T) {
+	client := NewClient("http://localhost", "alertmanager")
+	client.setTools([]Tool{{Name: "alertmanager__post_silence", InputSchema: map[string]interface{}{
+		"properties": map[string]interface{}{
+			"startsAt": map[string]interface{}{"type": "string", "format": "date-time"},
+		},
+	}}})
+
+	got := client.normalizeArguments("post_silence", map[string]interface{}{"starts_at": "now"})
+	if _, err := time.Parse(time.RFC3339, got["startsAt"].(string)); err != nil {
+		t.Errorf("normalizeArguments() = %v, want startsAt as an RFC3339 timestamp", got)
+	}
+
+	// A tool list refresh in progress does not hold up tool calls
+	client.toolsMu.Lock()
+	defer client.toolsMu.Unlock()
+	normalized := make(chan map[string]interface{}, 1)
+	go func() {
+		normalized <- client.normalizeArguments("post_silence", map[string]interface{}{"starts_at": "now"})
+	}()
+	select {
+	case got := <-normalized:
+		if _, ok := got["startsAt"]; !ok {
+			t.Errorf("normalizeArguments() during a refresh = %v, want the cached schema applied", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("normalizeArguments() waited for the tool list refresh")
+	}
+}
+
+func TestToSnakeCase(t *testing.T) {
+	for input, want := range map[string]string{
+		"datasourceUid": "datasource_uid",
+		"simple":        "simple",
+		"already_snake": "already_snake",
+	} {
+		if got := toSnakeCase(input); got != want {
+			t.Errorf("toSnakeCase(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package mcp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// TLSConfig holds the TLS settings for an MCP server reached over HTTPS
+type TLSConfig struct {
+	CACert             string // PEM bundle of CAs trusted in addition to the system roots
+	ClientCert         string // PEM client certificate for mutual TLS
+	ClientKey          string // PEM private key of ClientCert
+	InsecureSkipVerify bool   // Accept any server certificate
+}
+
+// build returns the tls.Config for the settings, or nil if they are all defaults
+func (c TLSConfig) build() (*tls.Config, error) {
+	if c == (TLSConfig{}) {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+
+	if c.CACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, errors.New("CA certificate contains no PEM certificates")
+		}
+		config.RootCAs = pool
+	}
+
+	if c.ClientCert != "" || c.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// configureHTTP applies a server's headers and TLS settings to the HTTP clients
+// that reach it. The user header is added to requests whose context carries a user.
+func configureHTTP(config ClientConfig, httpClient, streamClient *resty.Client) error {
+	tlsConfig, err := config.TLS.build()
+	if err != nil {
+		return err
+	}
+
+	for _, client := range []*resty.Client{httpClient, streamClient} {
+		client.SetHeaders(config.Headers)
+		if tlsConfig != nil {
+			client.SetTLSClientConfig(tlsConfig)
+		}
+	}
+
+	if config.UserHeader != "" {
+		httpClient.OnBeforeRequest(func(_ *resty.Client, r *resty.Request) error {
+			if user := userFromContext(r.Context()); user != "" {
+				r.SetHeader(config.UserHeader, user)
+			}
+			return nil
+		})
+	}
+
+	return nil
+}
+
+type userContextKey struct{}
+
+// WithUser returns a context whose MCP requests identify the Grafana user on whose
+// behalf they are made, for servers configured with a user header
+func WithUser(ctx context.Context, login string) context.Context {
+	return context.WithValue(ctx, userContextKey{}, login)
+}
+
+// userFromContext returns the user set by WithUser, if any
+func userFromContext(ctx context.Context) string {
+	login, _ := ctx.Value(userContextKey{}).(string)
+	return login
+}
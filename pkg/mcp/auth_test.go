@@ -0,0 +1,105 @@
+package mcp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestClientAuthAndTLS(t *testing.T) {
+	var mu sync.Mutex
+	headers := map[string]http.Header{} // Request headers by method
+	clientCerts := 0
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     *int64 `json:"id"`
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		mu.Lock()
+		headers[req.Method] = r.Header.Clone()
+		clientCerts = len(r.TLS.PeerCertificates)
+		mu.Unlock()
+
+		if req.ID == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": *req.ID, "result": map[string]interface{}{
+			"protocolVersion": LatestProtocolVersion,
+			"content":         []Content{{Type: ContentText, Text: "ok"}},
+		}})
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	// The test server's own certificate doubles as the client certificate
+	cert := server.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}))
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}))
+
+	client, err := NewClientWithConfig(server.URL, "genesys", ClientConfig{
+		Headers:    map[string]string{"Authorization": "Bearer secret"},
+		TLS:        TLSConfig{CACert: certPEM, ClientCert: certPEM, ClientKey: keyPEM},
+		UserHeader: "X-Grafana-User",
+	})
+	if err != nil {
+		t.Fatalf("NewClientWithConfig() error = %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if _, err := client.CallTool(WithUser(ctx, "alice"), "list_queues", nil); err != nil {
+		t.Fatalf("CallTool() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if clientCerts != 1 {
+		t.Errorf("server saw %d client certificates, want 1", clientCerts)
+	}
+	if got := headers["initialize"].Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("initialize Authorization = %q, want Bearer secret", got)
+	}
+	if got := headers["initialize"].Get("X-Grafana-User"); got != "" {
+		t.Errorf("initialize X-Grafana-User = %q, want none without a user", got)
+	}
+	if got := headers["tools/call"].Get("X-Grafana-User"); got != "alice" {
+		t.Errorf("tools/call X-Grafana-User = %q, want alice", got)
+	}
+}
+
+func TestTLSConfigBuild(t *testing.T) {
+	if config, err := (TLSConfig{}).build(); config != nil || err != nil {
+		t.Errorf("build() of defaults = %v, %v; want nil", config, err)
+	}
+	if config, err := (TLSConfig{InsecureSkipVerify: true}).build(); err != nil || !config.InsecureSkipVerify {
+		t.Errorf("build() = %v, %v; want InsecureSkipVerify", config, err)
+	}
+	if _, err := (TLSConfig{CACert: "not a certificate"}).build(); err == nil {
+		t.Error("build() should reject a CA bundle without certificates")
+	}
+	if _, err := (TLSConfig{ClientCert: "not a certificate"}).build(); err == nil {
+		t.Error("build() should reject an invalid client certificate")
+	}
+	if _, err := NewClientWithConfig("https://localhost", "grafana", ClientConfig{TLS: TLSConfig{CACert: "garbage"}}); err == nil {
+		t.Error("NewClientWithConfig() should fail with invalid TLS settings")
+	}
+}
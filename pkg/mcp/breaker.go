@@ -0,0 +1,107 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Circuit breaker settings for tool calls
+const (
+	breakerThreshold = 5                // Consecutive failures that open the circuit
+	breakerCooldown  = 30 * time.Second // How long an open circuit rejects calls before a trial call
+)
+
+// Circuit states reported by Client.CircuitState
+const (
+	CircuitClosed   = "closed"    // Calls go through
+	CircuitOpen     = "open"      // Calls fail fast
+	CircuitHalfOpen = "half-open" // One trial call decides whether to close again
+)
+
+// ErrServerUnavailable is returned for calls to a server that is down or whose circuit is open
+var ErrServerUnavailable = errors.New("MCP server unavailable")
+
+// circuitBreaker stops calls to a server after repeated failures so a dead server
+// fails fast instead of holding every chat turn for the full request timeout
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time // Zero while closed
+	trial     bool      // A half-open trial call is in flight
+	mu        sync.Mutex
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{threshold: breakerThreshold, cooldown: breakerCooldown}
+}
+
+// allow returns an error wrapping ErrServerUnavailable if a call may not go through.
+// After the cooldown a single trial call is let through.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openedAt.IsZero() {
+		return nil
+	}
+
+	wait := b.cooldown - time.Since(b.openedAt)
+	if wait > 0 || b.trial {
+		if wait < 0 {
+			wait = 0
+		}
+		return fmt.Errorf("%w: circuit open after %d failed calls, retrying in %s", ErrServerUnavailable, b.failures, wait.Round(time.Second))
+	}
+
+	b.trial = true
+	return nil
+}
+
+// record counts the outcome of a call; only failures reaching the server count
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if !failed {
+		b.failures = 0
+		b.openedAt = time.Time{}
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now() // A failed trial restarts the cooldown
+	}
+}
+
+// abandon ends a call whose outcome says nothing about the server (the caller gave up)
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+// reset closes the circuit, e.g. after the server reconnected
+func (b *circuitBreaker) reset() {
+	b.record(false)
+}
+
+// state returns CircuitClosed, CircuitOpen or CircuitHalfOpen
+func (b *circuitBreaker) state() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.openedAt.IsZero():
+		return CircuitClosed
+	case b.trial || time.Since(b.openedAt) >= b.cooldown:
+		return CircuitHalfOpen
+	default:
+		return CircuitOpen
+	}
+}
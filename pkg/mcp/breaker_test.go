@@ -0,0 +1,68 @@
+package mcp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp/mcptest"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := &circuitBreaker{threshold: 3, cooldown: 20 * time.Millisecond}
+
+	for i := 0; i < 3; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("allow() before the threshold = %v", err)
+		}
+		b.record(true)
+	}
+	if err := b.allow(); !errors.Is(err, ErrServerUnavailable) || b.state() != CircuitOpen {
+		t.Fatalf("after %d failures: allow() = %v, state %s; want ErrServerUnavailable and open", 3, err, b.state())
+	}
+
+	// After the cooldown one trial call goes through
+	time.Sleep(30 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("trial allow() = %v", err)
+	}
+	if err := b.allow(); err == nil {
+		t.Error("a second call during the trial should be rejected")
+	}
+
+	// A failed trial reopens the circuit
+	b.record(true)
+	if b.state() != CircuitOpen {
+		t.Errorf("state after a failed trial = %s, want open", b.state())
+	}
+
+	// A successful trial closes it
+	time.Sleep(30 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("trial allow() = %v", err)
+	}
+	b.record(false)
+	if b.state() != CircuitClosed || b.allow() != nil {
+		t.Errorf("state after a successful trial = %s, want closed", b.state())
+	}
+}
+
+func TestCallToolCircuitBreaker(t *testing.T) {
+	calls := 0
+	server := mcptest.NewServer(t, nil, map[string]mcptest.Handler{
+		"tools/call": func(params map[string]interface{}) (interface{}, error) {
+			calls++
+			return nil, &mcptest.Error{Code: -32602, Message: "bad arguments"}
+		},
+	})
+
+	client := NewClient(server.URL, "grafana")
+	for i := 0; i < breakerThreshold+1; i++ {
+		if _, err := client.CallTool(t.Context(), "search_dashboards", nil); errors.Is(err, ErrServerUnavailable) {
+			t.Fatalf("call %d: errors reported by the server should not open the circuit", i)
+		}
+	}
+	if calls != breakerThreshold+1 || client.CircuitState() != CircuitClosed {
+		t.Errorf("server got %d calls, circuit %s; want %d and closed", calls, client.CircuitState(), breakerThreshold+1)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -15,194 +17,300 @@ type Tool struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	InputSchema map[string]interface{} `json:"inputSchema"`
+	Annotations *ToolAnnotations       `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations are the behaviour hints a server may declare for a tool.
+// Hints are optional; nil means the server did not say.
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    *bool  `json:"readOnlyHint,omitempty"`
+	DestructiveHint *bool  `json:"destructiveHint,omitempty"`
+	IdempotentHint  *bool  `json:"idempotentHint,omitempty"`
+	OpenWorldHint   *bool  `json:"openWorldHint,omitempty"`
 }
 
 // Client represents an MCP HTTP client
 type Client struct {
-	url        string
-	httpClient *resty.Client
-	tools      []Tool
-	serverType string
+	url             string
+	httpClient      *resty.Client
+	transport       transport
+	serverType      string
+	toolPrefix      string // Prepended to the server's tool names to expose them
+	requestID       atomic.Int64
+	server          *InitializeResult // Set by Connect
+	version         *protocolVersion  // Negotiated by Connect, sent by the HTTP transports
+	tools           []Tool
+	toolSchemas     atomic.Pointer[schemasByTool] // Replaced together with tools
+	toolsFetchedAt  time.Time                     // When the cached tools were fetched
+	toolsStale      atomic.Bool                   // Set when the cached tools must be refetched
+	toolsTTL        time.Duration
+	toolsGeneration atomic.Uint64 // Incremented whenever the tool or resource list changes
+	toolsListeners  []func()
+	toolsMu         sync.Mutex // Serializes tool list refreshes
+	resources       *ResourceList
+	resourcesAt     time.Time   // When the cached resources were fetched
+	resourcesStale  atomic.Bool // Set when the cached resources must be refetched
+	resourcesMu     sync.Mutex  // Serializes resource list refreshes
+	argumentRules   ArgumentRules
+	unavailable     atomic.Bool // Set while the server cannot be reached
+	breaker         *circuitBreaker
+	stopSupervisor  context.CancelFunc // Set by Supervise
+	mu              sync.RWMutex
+}
+
+// ClientConfig holds optional MCP client settings
+type ClientConfig struct {
+	Transport  string            // TransportStreamableHTTP (default), TransportSSE or TransportStdio
+	Command    string            // Server binary to launch (stdio only)
+	Args       []string          // Arguments for Command
+	Env        []string          // "KEY=value" entries added to the plugin's environment for Command
+	ToolsTTL   time.Duration     // How long the tool list is cached (0 = default, <0 = until the server reports a change)
+	Arguments  ArgumentRules     // Adjustments to the schema-driven argument normalization, added to the server type's defaults
+	ToolPrefix *string           // Prefix for exposed tool names (nil = DefaultToolPrefix)
+	Headers    map[string]string // Sent with every HTTP request, e.g. Authorization
+	TLS        TLSConfig         // HTTPS settings (HTTP transports only)
+	UserHeader string            // Header carrying the user set with WithUser ("" = not sent)
 }
 
-// NewClient creates a new MCP client
+// DefaultToolPrefix returns the prefix a server's tool names get unless configured:
+// "<server type>__", except for Grafana whose tools keep their names
+func DefaultToolPrefix(serverType string) string {
+	if serverType == "grafana" {
+		return ""
+	}
+	return serverType + "__"
+}
+
+// NewClient creates a new MCP client using the Streamable HTTP transport
 func NewClient(url string, serverType string) *Client {
+	client, _ := NewClientWithConfig(url, serverType, ClientConfig{})
+	return client
+}
+
+// NewClientWithConfig creates a new MCP client with custom settings
+func NewClientWithConfig(url string, serverType string, config ClientConfig) (*Client, error) {
 	client := resty.New()
 	client.SetTimeout(30 * time.Second)
 	client.SetRetryCount(3)
 	client.SetRetryWaitTime(1 * time.Second)
 	client.SetRetryMaxWaitTime(5 * time.Second)
 
-	return &Client{
-		url:        url,
-		httpClient: client,
-		serverType: serverType,
+	if config.ToolsTTL == 0 {
+		config.ToolsTTL = DefaultToolsTTL
 	}
-}
 
-// Connect initializes the MCP session
-func (c *Client) Connect(ctx context.Context) error {
-	return c.Health(ctx)
-}
+	// Streams stay open, so their client has no timeout
+	streamClient := resty.New()
+	if err := configureHTTP(config, client, streamClient); err != nil {
+		return nil, fmt.Errorf("invalid TLS settings for MCP server %s: %w", serverType, err)
+	}
 
-// Health checks MCP server connectivity
-func (c *Client) Health(ctx context.Context) error {
-	resp, err := c.httpClient.R().
-		SetContext(ctx).
-		SetHeader("Content-Type", "application/json").
-		Get(c.url + "/health")
+	version := &protocolVersion{}
+	t, err := newTransport(url, serverType, config, client, streamClient, version)
+	if err != nil {
+		return nil, err
+	}
 
+	toolPrefix := DefaultToolPrefix(serverType)
+	if config.ToolPrefix != nil {
+		toolPrefix = *config.ToolPrefix
+	}
+
+	c := &Client{
+		url:           url,
+		httpClient:    client,
+		transport:     t,
+		version:       version,
+		serverType:    serverType,
+		toolPrefix:    toolPrefix,
+		toolsTTL:      config.ToolsTTL,
+		argumentRules: config.Arguments.withDefaults(serverType),
+		breaker:       newCircuitBreaker(),
+	}
+	t.setNotificationHandler(c.handleNotification)
+
+	// A restarted server process, a reopened SSE stream or an expired HTTP session starts a fresh session
+	switch t := t.(type) {
+	case *stdioTransport:
+		t.onRestart = c.Connect
+	case *sseTransport:
+		t.onReconnect = c.Connect
+	case *streamableHTTPTransport:
+		t.onExpired = c.Connect
+	}
+
+	return c, nil
+}
+
+// Connect initializes the MCP session: it negotiates the protocol version,
+// records the server's info and capabilities and confirms with notifications/initialized.
+// The server counts as unavailable from a failed Connect until the next successful one.
+func (c *Client) Connect(ctx context.Context) error {
+	result, err := c.initialize(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to connect to MCP server: %w", err)
+		c.setAvailable(false)
+		return err
 	}
 
-	if resp.StatusCode() != 200 {
-		return fmt.Errorf("MCP server health check failed with status: %d", resp.StatusCode())
+	c.mu.Lock()
+	reconnected := c.server != nil
+	c.server = result
+	c.mu.Unlock()
+
+	// A new session may come with different tools; setAvailable announces a server that was down
+	if reconnected && c.Available() {
+		c.toolsChanged()
 	}
+	c.setAvailable(true)
 
 	return nil
 }
 
-// DiscoverTools fetches available tools from the MCP server
-func (c *Client) DiscoverTools(ctx context.Context) ([]Tool, error) {
-	if len(c.tools) > 0 {
-		return c.tools, nil
+// initialize performs the initialize handshake
+func (c *Client) initialize(ctx context.Context) (*InitializeResult, error) {
+	var result InitializeResult
+	err := c.call(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": LatestProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      ClientInfo,
+	}, &result)
+	if err != nil {
+		return nil, fmt.Errorf("MCP initialize failed: %w", err)
 	}
 
-	resp, err := c.httpClient.R().
-		SetContext(ctx).
-		SetHeader("Content-Type", "application/json").
-		SetBody(map[string]interface{}{
-			"jsonrpc": "2.0",
-			"id":      1,
-			"method":  "tools/list",
-		}).
-		Post(c.url)
+	if !supportsProtocolVersion(result.ProtocolVersion) {
+		return nil, fmt.Errorf("MCP server requires unsupported protocol version %q", result.ProtocolVersion)
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to discover tools: %w", err)
+	// Later requests announce the negotiated version (required by HTTP transports since 2025-06-18)
+	c.version.set(result.ProtocolVersion)
+
+	if err := c.notify(ctx, "notifications/initialized", nil); err != nil {
+		return nil, fmt.Errorf("MCP initialized notification failed: %w", err)
 	}
 
-	var result struct {
-		Result struct {
-			Tools []Tool `json:"tools"`
-		} `json:"result"`
+	return &result, nil
+}
+
+// ServerInfo returns what the server reported during Connect, or nil if not connected
+func (c *Client) ServerInfo() *InitializeResult {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.server == nil {
+		return nil
 	}
+	info := *c.server
+	return &info
+}
 
-	if err := json.Unmarshal(resp.Body(), &result); err != nil {
-		return nil, fmt.Errorf("failed to parse tools response: %w", err)
+// Health checks MCP server connectivity with a ping over the client's transport
+func (c *Client) Health(ctx context.Context) error {
+	if err := c.call(ctx, "ping", nil, nil); err != nil {
+		return fmt.Errorf("MCP server health check failed: %w", err)
 	}
 
-	// Prefix non-Grafana tools with server type
-	if c.serverType != "grafana" {
-		for i := range result.Result.Tools {
-			result.Result.Tools[i].Name = fmt.Sprintf("%s__%s", c.serverType, result.Result.Tools[i].Name)
-		}
+	return nil
+}
+
+// Close ends the MCP session and releases the transport (stopping a stdio server process)
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.stopSupervisor != nil {
+		c.stopSupervisor()
 	}
+	c.mu.Unlock()
 
-	c.tools = result.Result.Tools
-	return c.tools, nil
+	return c.transport.close()
 }
 
-// InvokeTool calls an MCP tool with the given arguments
-func (c *Client) InvokeTool(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
-	// Remove prefix if present for actual invocation
-	actualName := name
-	if c.serverType != "grafana" {
-		actualName = strings.TrimPrefix(name, c.serverType+"__")
-	}
-
-	// Normalize arguments
-	normalizedArgs := c.normalizeArguments(actualName, args)
-
-	resp, err := c.httpClient.R().
-		SetContext(ctx).
-		SetHeader("Content-Type", "application/json").
-		SetBody(map[string]interface{}{
-			"jsonrpc": "2.0",
-			"id":      time.Now().Unix(),
-			"method":  "tools/call",
-			"params": map[string]interface{}{
-				"name":      actualName,
-				"arguments": normalizedArgs,
-			},
-		}).
-		Post(c.url)
+// ToolPrefix returns the prefix of the tool names DiscoverTools returns
+func (c *Client) ToolPrefix() string {
+	return c.toolPrefix
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to invoke tool %s: %w", name, err)
-	}
+// InvokeTool calls an MCP tool by the name DiscoverTools returned for it
+func (c *Client) InvokeTool(ctx context.Context, name string, args map[string]interface{}) (*ToolResult, error) {
+	return c.CallTool(ctx, strings.TrimPrefix(name, c.toolPrefix), args)
+}
 
-	var result struct {
-		Result struct {
-			Content []struct {
-				Type string      `json:"type"`
-				Text string      `json:"text,omitempty"`
-				Data interface{} `json:"data,omitempty"`
-			} `json:"content"`
-		} `json:"result"`
-		Error *struct {
-			Code    int    `json:"code"`
-			Message string `json:"message"`
-		} `json:"error"`
+// CallTool calls an MCP tool by its name on the server. Failures the tool reports
+// itself are returned as a result with IsError set, so the model can read them.
+// Calls to an unavailable server fail fast with an error wrapping ErrServerUnavailable.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (*ToolResult, error) {
+	if !c.Available() {
+		return nil, fmt.Errorf("%w: %s is reconnecting", ErrServerUnavailable, c.serverType)
+	}
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
 	}
 
-	if err := json.Unmarshal(resp.Body(), &result); err != nil {
-		return nil, fmt.Errorf("failed to parse tool response: %w", err)
+	var result ToolResult
+	err := c.call(ctx, "tools/call", map[string]interface{}{
+		"name":      name,
+		"arguments": c.normalizeArguments(name, args),
+	}, &result)
+
+	// Only failures to reach the server count against it
+	_, rpcFailed := err.(*RPCError)
+	if err != nil && !rpcFailed && ctx.Err() != nil {
+		c.breaker.abandon()
+	} else {
+		c.breaker.record(err != nil && !rpcFailed)
 	}
 
-	if result.Error != nil {
-		return nil, fmt.Errorf("tool error: %s", result.Error.Message)
+	if rpcErr, ok := err.(*RPCError); ok {
+		return nil, fmt.Errorf("tool error: %s", rpcErr.Message)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to invoke tool %s: %w", name, err)
 	}
 
-	// Return the first content item
-	if len(result.Result.Content) > 0 {
-		if result.Result.Content[0].Type == "text" {
-			return result.Result.Content[0].Text, nil
-		}
-		return result.Result.Content[0].Data, nil
+	if len(result.Content) == 0 && result.StructuredContent == nil && !result.IsError {
+		return nil, fmt.Errorf("tool returned no content")
 	}
 
-	return nil, fmt.Errorf("tool returned no content")
+	return &result, nil
 }
 
-// normalizeArguments applies MCP-specific argument transformations
-func (c *Client) normalizeArguments(toolName string, args map[string]interface{}) map[string]interface{} {
-	normalized := make(map[string]interface{})
-
-	for key, value := range args {
-		// Handle relative time strings
-		if strVal, ok := value.(string); ok {
-			if strings.HasPrefix(strVal, "now-") || strings.HasPrefix(strVal, "now+") {
-				if timestamp, err := parseRelativeTime(strVal); err == nil {
-					normalized[key] = timestamp
-					continue
-				}
-			}
-		}
+// call sends a JSON-RPC request and decodes its result into out (if not nil)
+func (c *Client) call(ctx context.Context, method string, params interface{}, out interface{}) error {
+	id := c.requestID.Add(1)
 
-		// Convert snake_case to camelCase for dashboard fields
-		if c.serverType == "grafana" && strings.Contains(key, "_") {
-			normalized[toCamelCase(key)] = value
-		} else {
-			normalized[key] = value
-		}
+	response, err := c.transport.send(ctx, rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return err
 	}
 
-	// Add default stepSeconds for Prometheus range queries
-	if strings.Contains(toolName, "prometheus") && strings.Contains(toolName, "range") {
-		if _, ok := normalized["stepSeconds"]; !ok {
-			normalized["stepSeconds"] = 60
-		}
+	if response.Error != nil {
+		return response.Error
+	}
+
+	if out == nil || len(response.Result) == 0 {
+		return nil
 	}
 
-	return normalized
+	if err := json.Unmarshal(response.Result, out); err != nil {
+		return fmt.Errorf("failed to parse %s result: %w", method, err)
+	}
+
+	return nil
+}
+
+// notify sends a JSON-RPC notification, which has no response
+func (c *Client) notify(ctx context.Context, method string, params interface{}) error {
+	return c.transport.notify(ctx, rpcRequest{JSONRPC: "2.0", Method: method, Params: params})
 }
 
 // parseRelativeTime converts relative time strings to RFC3339 timestamps
 func parseRelativeTime(relative string) (string, error) {
 	now := time.Now()
 
+	if relative == "now" {
+		return now.Format(time.RFC3339), nil
+	}
+
 	if strings.HasPrefix(relative, "now-") {
 		duration := strings.TrimPrefix(relative, "now-")
 		d, err := parseDuration(duration)
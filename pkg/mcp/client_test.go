@@ -2,8 +2,11 @@ package mcp
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -45,32 +48,96 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+// newHandshakeServer returns an MCP server that answers initialize with the given
+// protocol version and records every JSON-RPC method it receives
+func newHandshakeServer(t *testing.T, statusCode int, protocolVersion string, methods *[]string) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			// No notification stream
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			ID     *int64 `json:"id"`
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		mu.Lock()
+		*methods = append(*methods, req.Method)
+		mu.Unlock()
+
+		if statusCode != http.StatusOK {
+			w.WriteHeader(statusCode)
+			return
+		}
+
+		if req.ID == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      *req.ID,
+			"result": map[string]interface{}{
+				"protocolVersion": protocolVersion,
+				"capabilities": map[string]interface{}{
+					"tools":   map[string]interface{}{"listChanged": true},
+					"logging": map[string]interface{}{},
+				},
+				"serverInfo": map[string]interface{}{"name": "mcp-grafana", "version": "0.6.0"},
+			},
+		})
+	}))
+}
+
 func TestConnect(t *testing.T) {
 	tests := []struct {
-		name       string
-		statusCode int
-		wantErr    bool
+		name            string
+		statusCode      int
+		protocolVersion string
+		wantErr         bool
+		wantMethods     []string
 	}{
 		{
-			name:       "successful connection",
-			statusCode: http.StatusOK,
-			wantErr:    false,
+			name:            "successful connection",
+			statusCode:      http.StatusOK,
+			protocolVersion: LatestProtocolVersion,
+			wantErr:         false,
+			wantMethods:     []string{"initialize", "notifications/initialized"},
+		},
+		{
+			name:            "older protocol version",
+			statusCode:      http.StatusOK,
+			protocolVersion: "2024-11-05",
+			wantErr:         false,
+			wantMethods:     []string{"initialize", "notifications/initialized"},
+		},
+		{
+			name:            "unsupported protocol version",
+			statusCode:      http.StatusOK,
+			protocolVersion: "2023-01-01",
+			wantErr:         true,
+			wantMethods:     []string{"initialize"},
 		},
 		{
-			name:       "server unavailable",
-			statusCode: http.StatusServiceUnavailable,
-			wantErr:    true,
+			name:        "server unavailable",
+			statusCode:  http.StatusServiceUnavailable,
+			wantErr:     true,
+			wantMethods: []string{"initialize"},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create test server
-			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				if r.URL.Path == "/health" {
-					w.WriteHeader(tt.statusCode)
-				}
-			}))
+			var methods []string
+			server := newHandshakeServer(t, tt.statusCode, tt.protocolVersion, &methods)
 			defer server.Close()
 
 			client := NewClient(server.URL, "grafana")
@@ -81,10 +148,53 @@ func TestConnect(t *testing.T) {
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Connect() error = %v, wantErr %v", err, tt.wantErr)
 			}
+
+			if strings.Join(methods, ",") != strings.Join(tt.wantMethods, ",") {
+				t.Errorf("Connect() sent %v, want %v", methods, tt.wantMethods)
+			}
+
+			if tt.wantErr && client.ServerInfo() != nil {
+				t.Error("ServerInfo() should be nil after a failed handshake")
+			}
 		})
 	}
 }
 
+func TestServerInfo(t *testing.T) {
+	var methods []string
+	server := newHandshakeServer(t, http.StatusOK, "2025-03-26", &methods)
+	defer server.Close()
+
+	client := NewClient(server.URL, "grafana")
+	if client.ServerInfo() != nil {
+		t.Fatal("ServerInfo() should be nil before Connect")
+	}
+
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	info := client.ServerInfo()
+	if info == nil {
+		t.Fatal("ServerInfo() returned nil after Connect")
+	}
+	if info.ProtocolVersion != "2025-03-26" {
+		t.Errorf("ProtocolVersion = %v, want 2025-03-26", info.ProtocolVersion)
+	}
+	if info.ServerInfo.Name != "mcp-grafana" || info.ServerInfo.Version != "0.6.0" {
+		t.Errorf("ServerInfo = %+v, want mcp-grafana 0.6.0", info.ServerInfo)
+	}
+	if info.Capabilities.Tools == nil || !info.Capabilities.Tools.ListChanged {
+		t.Errorf("Capabilities.Tools = %+v, want listChanged", info.Capabilities.Tools)
+	}
+	if info.Capabilities.Logging == nil {
+		t.Error("Capabilities.Logging should be set")
+	}
+	if info.Capabilities.Resources != nil || info.Capabilities.Prompts != nil {
+		t.Error("Capabilities.Resources and Prompts should be nil when not declared")
+	}
+}
+
 func TestDiscoverTools(t *testing.T) {
 	// Mock MCP tools/list response
 	mockResponse := `{
@@ -218,6 +328,11 @@ func TestParseRelativeTime(t *testing.T) {
 			relative: "now+1h",
 			wantErr:  false,
 		},
+		{
+			name:     "now",
+			relative: "now",
+			wantErr:  false,
+		},
 		{
 			name:     "invalid format",
 			relative: "invalid",
@@ -286,54 +401,46 @@ func TestToCamelCase(t *testing.T) {
 	}
 }
 
-func TestNormalizeArguments(t *testing.T) {
-	client := NewClient("http://localhost", "grafana")
+func TestInvokeToolResult(t *testing.T) {
+	mockResponse := `{
+		"jsonrpc": "2.0",
+		"id": 1,
+		"result": {
+			"content": [
+				{"type": "text", "text": "Panel rendered"},
+				{"type": "image", "data": "iVBORw0KGgo=", "mimeType": "image/png"},
+				{"type": "resource", "resource": {"uri": "grafana://dashboards/abc", "text": "{}"}}
+			],
+			"structuredContent": {"panels": 1},
+			"isError": true
+		}
+	}`
 
-	tests := []struct {
-		name     string
-		toolName string
-		args     map[string]interface{}
-		want     map[string]interface{}
-	}{
-		{
-			name:     "converts snake_case to camelCase",
-			toolName: "update_dashboard",
-			args: map[string]interface{}{
-				"datasource_uid": "abc123",
-				"folder_uid":     "folder1",
-			},
-			want: map[string]interface{}{
-				"datasourceUid": "abc123",
-				"folderUid":     "folder1",
-			},
-		},
-		{
-			name:     "adds stepSeconds for prometheus range query",
-			toolName: "query_prometheus_range",
-			args: map[string]interface{}{
-				"query": "up",
-			},
-			want: map[string]interface{}{
-				"query":       "up",
-				"stepSeconds": 60,
-			},
-		},
-	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := client.normalizeArguments(tt.toolName, tt.args)
+	client := NewClient(server.URL, "grafana")
+	result, err := client.InvokeTool(context.Background(), "render_panel", nil)
+	if err != nil {
+		t.Fatalf("InvokeTool() error = %v", err)
+	}
 
-			for key, wantVal := range tt.want {
-				gotVal, ok := got[key]
-				if !ok {
-					t.Errorf("normalizeArguments() missing key %v", key)
-					continue
-				}
-				if gotVal != wantVal {
-					t.Errorf("normalizeArguments() key %v = %v, want %v", key, gotVal, wantVal)
-				}
-			}
-		})
+	if len(result.Content) != 3 {
+		t.Fatalf("InvokeTool() returned %d content blocks, want 3", len(result.Content))
+	}
+	if result.Content[1].Type != ContentImage || result.Content[1].MimeType != "image/png" || result.Content[1].Data != "iVBORw0KGgo=" {
+		t.Errorf("image block = %+v", result.Content[1])
+	}
+	if result.Content[2].Resource == nil || result.Content[2].Resource.URI != "grafana://dashboards/abc" {
+		t.Errorf("resource block = %+v", result.Content[2])
+	}
+	if !result.IsError {
+		t.Error("IsError should be set")
+	}
+	if result.StructuredContent == nil {
+		t.Error("StructuredContent should be set")
 	}
 }
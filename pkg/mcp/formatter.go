@@ -1,27 +1,93 @@
 package mcp
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
-// FormatToolResult formats MCP tool results for LLM consumption
-func FormatToolResult(result interface{}) string {
-	if result == nil {
+// FormatToolResult formats MCP tool results for LLM consumption.
+// Text is passed through; binary blocks are described since the model cannot
+// see them; structured content is included when no text block carries it.
+func FormatToolResult(result *ToolResult) string {
+	if result == nil || (len(result.Content) == 0 && result.StructuredContent == nil) {
+		if result != nil && result.IsError {
+			return "Error: the tool reported a failure without details"
+		}
 		return "No result returned"
 	}
 
-	switch v := result.(type) {
-	case string:
-		return v
-	case map[string]interface{}, []interface{}:
+	var parts []string
+	hasText := false
+
+	for _, block := range result.Content {
+		switch block.Type {
+		case ContentText:
+			hasText = true
+			parts = append(parts, block.Text)
+		case ContentImage, ContentAudio:
+			parts = append(parts, fmt.Sprintf("[%s: %s, %s; shown to the user]", block.Type, block.MimeType, formatSize(decodedSize(block.Data))))
+		case ContentResourceLink:
+			parts = append(parts, fmt.Sprintf("[resource link: %s]", describeResource(block.URI, block.Name, block.MimeType)))
+		case ContentResource:
+			parts = append(parts, formatResource(block.Resource))
+		default:
+			parts = append(parts, fmt.Sprintf("[unsupported %s content]", block.Type))
+		}
+	}
+
+	if result.StructuredContent != nil && !hasText {
 		// Pretty print JSON
-		jsonBytes, err := json.MarshalIndent(v, "", "  ")
+		jsonBytes, err := json.MarshalIndent(result.StructuredContent, "", "  ")
 		if err != nil {
-			return fmt.Sprintf("%v", v)
+			parts = append(parts, fmt.Sprintf("%v", result.StructuredContent))
+		} else {
+			parts = append(parts, string(jsonBytes))
 		}
-		return string(jsonBytes)
-	default:
-		return fmt.Sprintf("%v", v)
 	}
+
+	text := strings.Join(parts, "\n\n")
+	if result.IsError {
+		return "Error: " + text
+	}
+	return text
+}
+
+// formatResource renders an embedded resource: its text, or a description of binary data
+func formatResource(resource *ResourceContents) string {
+	if resource == nil {
+		return "[empty resource]"
+	}
+
+	if resource.Blob != "" {
+		return fmt.Sprintf("[resource: %s, %s]", describeResource(resource.URI, "", resource.MimeType), formatSize(decodedSize(resource.Blob)))
+	}
+
+	return fmt.Sprintf("Resource %s:\n%s", resource.URI, resource.Text)
+}
+
+// describeResource names a resource by URI, with its name and MIME type when known
+func describeResource(uri, name, mimeType string) string {
+	desc := uri
+	if name != "" {
+		desc = fmt.Sprintf("%s (%s)", name, uri)
+	}
+	if mimeType != "" {
+		desc += ", " + mimeType
+	}
+	return desc
+}
+
+// formatSize renders a byte count for humans
+func formatSize(bytes int) string {
+	if bytes < 1024 {
+		return fmt.Sprintf("%d bytes", bytes)
+	}
+	return fmt.Sprintf("%.1f KB", float64(bytes)/1024)
+}
+
+// decodedSize returns the size of base64 data once decoded
+func decodedSize(data string) int {
+	return base64.StdEncoding.DecodedLen(len(data)) - strings.Count(data[len(strings.TrimRight(data, "=")):], "=")
 }
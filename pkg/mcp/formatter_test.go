@@ -0,0 +1,80 @@
+package mcp
+
+import (
+	"testing"
+)
+
+func TestFormatToolResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *ToolResult
+		want   string
+	}{
+		{
+			name:   "nil result",
+			result: nil,
+			want:   "No result returned",
+		},
+		{
+			name:   "single text block",
+			result: NewTextResult("up=1"),
+			want:   "up=1",
+		},
+		{
+			name: "every text block is kept",
+			result: &ToolResult{Content: []Content{
+				{Type: ContentText, Text: "Dashboard: Overview"},
+				{Type: ContentText, Text: "Panels: 4"},
+			}},
+			want: "Dashboard: Overview\n\nPanels: 4",
+		},
+		{
+			name: "images are described",
+			result: &ToolResult{Content: []Content{
+				{Type: ContentText, Text: "Rendered panel"},
+				{Type: ContentImage, MimeType: "image/png", Data: "iVBORw0KGgo="},
+			}},
+			want: "Rendered panel\n\n[image: image/png, 8 bytes; shown to the user]",
+		},
+		{
+			name: "resources",
+			result: &ToolResult{Content: []Content{
+				{Type: ContentResourceLink, URI: "grafana://dashboards/abc", Name: "Overview", MimeType: "application/json"},
+				{Type: ContentResource, Resource: &ResourceContents{URI: "file:///runbook.md", Text: "Restart the pod"}},
+				{Type: ContentResource, Resource: &ResourceContents{URI: "file:///dump.bin", MimeType: "application/octet-stream", Blob: "AAAA"}},
+			}},
+			want: "[resource link: Overview (grafana://dashboards/abc), application/json]\n\n" +
+				"Resource file:///runbook.md:\nRestart the pod\n\n" +
+				"[resource: file:///dump.bin, application/octet-stream, 3 bytes]",
+		},
+		{
+			name:   "structured content without text",
+			result: &ToolResult{StructuredContent: map[string]interface{}{"firing": 2}},
+			want:   "{\n  \"firing\": 2\n}",
+		},
+		{
+			name: "structured content duplicated in text is not repeated",
+			result: &ToolResult{
+				Content:           []Content{{Type: ContentText, Text: `{"firing":2}`}},
+				StructuredContent: map[string]interface{}{"firing": 2},
+			},
+			want: `{"firing":2}`,
+		},
+		{
+			name: "tool errors are flagged",
+			result: &ToolResult{
+				Content: []Content{{Type: ContentText, Text: "datasource not found"}},
+				IsError: true,
+			},
+			want: "Error: datasource not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatToolResult(tt.result); got != tt.want {
+				t.Errorf("FormatToolResult() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
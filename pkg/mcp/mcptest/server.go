@@ -0,0 +1,111 @@
+// Package mcptest runs fake MCP servers for tests.
+//
+// It does not import the mcp package, so the package's own tests can use it.
+package mcptest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// SessionID is the Mcp-Session-Id every server hands out on initialize
+const SessionID = "mcptest-session"
+
+// Handler answers one JSON-RPC method with a result or an error.
+// An *Error is sent as is; any other error as an internal error.
+type Handler func(params map[string]interface{}) (interface{}, error)
+
+// Error is a JSON-RPC error returned by a Handler
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Result returns a Handler that always answers with result
+func Result(result interface{}) Handler {
+	return func(map[string]interface{}) (interface{}, error) {
+		return result, nil
+	}
+}
+
+// Server is a fake MCP server speaking the Streamable HTTP transport
+type Server struct {
+	*httptest.Server
+	closed atomic.Int32 // Sessions ended with DELETE
+}
+
+// NewServer starts a server that dispatches requests to handlers. Unless handlers
+// override them, initialize is answered with capabilities and the protocol
+// version the client asked for, and ping with an empty result. Other methods
+// get "method not found". The server is closed when the test ends.
+func NewServer(t testing.TB, capabilities map[string]interface{}, handlers map[string]Handler) *Server {
+	t.Helper()
+
+	if capabilities == nil {
+		capabilities = map[string]interface{}{}
+	}
+
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			s.closed.Add(1)
+			return
+		}
+
+		var req struct {
+			ID     *int64                 `json:"id"`
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.ID == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": *req.ID}
+		switch handler, ok := handlers[req.Method]; {
+		case ok:
+			result, err := handler(req.Params)
+			var rpcErr *Error
+			switch {
+			case errors.As(err, &rpcErr):
+				response["error"] = rpcErr
+			case err != nil:
+				response["error"] = Error{Code: -32603, Message: err.Error()}
+			default:
+				response["result"] = result
+			}
+		case req.Method == "initialize":
+			w.Header().Set("Mcp-Session-Id", SessionID)
+			response["result"] = map[string]interface{}{
+				"protocolVersion": req.Params["protocolVersion"],
+				"capabilities":    capabilities,
+				"serverInfo":      map[string]string{"name": "mcptest", "version": "1"},
+			}
+		case req.Method == "ping":
+			response["result"] = map[string]interface{}{}
+		default:
+			response["error"] = Error{Code: -32601, Message: "method not found"}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// ClosedSessions returns how many sessions clients ended with DELETE
+func (s *Server) ClosedSessions() int {
+	return int(s.closed.Load())
+}
@@ -0,0 +1,114 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+// LatestProtocolVersion is the MCP protocol revision the client asks for
+const LatestProtocolVersion = "2025-06-18"
+
+// SupportedProtocolVersions are the MCP revisions the client can speak, newest first
+var SupportedProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// ClientInfo identifies this plugin to MCP servers
+var ClientInfo = Implementation{Name: "sabio-sm3-chat-plugin", Version: "1.0.0"}
+
+// Implementation names an MCP client or server and its version
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// ListChangedCapability is a capability whose list may change at runtime
+type ListChangedCapability struct {
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+// ResourcesCapability describes a server's resource support
+type ResourcesCapability struct {
+	Subscribe   bool `json:"subscribe,omitempty"`
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+// ServerCapabilities are the features a server declared during initialization.
+// A nil field means the server does not offer that feature.
+type ServerCapabilities struct {
+	Tools     *ListChangedCapability `json:"tools,omitempty"`
+	Resources *ResourcesCapability   `json:"resources,omitempty"`
+	Prompts   *ListChangedCapability `json:"prompts,omitempty"`
+	Logging   *struct{}              `json:"logging,omitempty"`
+}
+
+// InitializeResult is what a server reports about itself during the handshake
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      Implementation     `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
+}
+
+// protocolVersion holds the version negotiated by the last initialize, shared by
+// a client and its transport. It is empty until the first handshake completes.
+type protocolVersion struct {
+	value atomic.Pointer[string]
+}
+
+func (p *protocolVersion) get() string {
+	if v := p.value.Load(); v != nil {
+		return *v
+	}
+	return ""
+}
+
+func (p *protocolVersion) set(version string) {
+	p.value.Store(&version)
+}
+
+// rpcRequest is a JSON-RPC 2.0 request, or a notification when ID is nil
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *int64      `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 message received from a server: usually a response,
+// but Method is set when the server sends a request or notification of its own
+type rpcResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// isNotification reports whether the message is a notification from the server
+func (r *rpcResponse) isNotification() bool {
+	return r.Method != "" && len(r.ID) == 0
+}
+
+// notificationHandler receives the notifications a server sends
+type notificationHandler func(method string, params json.RawMessage)
+
+// RPCError is an error returned by an MCP server
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements error
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("MCP error %d: %s", e.Code, e.Message)
+}
+
+// supportsProtocolVersion reports whether the client can speak a protocol revision
+func supportsProtocolVersion(version string) bool {
+	for _, v := range SupportedProtocolVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// maxListPages bounds paginated list requests against misbehaving servers
+const maxListPages = 100
+
+// Resource is a document or data item published by an MCP server
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+// ResourceTemplate describes a family of resources by URI template (RFC 6570)
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// Prompt is a canned conversation starter published by an MCP server
+type Prompt struct {
+	Name        string           `json:"name"`
+	Title       string           `json:"title,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// PromptArgument is a value the user supplies when getting a prompt
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptMessage is one message of a rendered prompt
+type PromptMessage struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// PromptResult is a prompt rendered with its arguments
+type PromptResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+// SupportsResources reports whether the server declared resources during Connect
+func (c *Client) SupportsResources() bool {
+	info := c.ServerInfo()
+	return info != nil && info.Capabilities.Resources != nil
+}
+
+// SupportsPrompts reports whether the server declared prompts during Connect
+func (c *Client) SupportsPrompts() bool {
+	info := c.ServerInfo()
+	return info != nil && info.Capabilities.Prompts != nil
+}
+
+// ResourceList is what a server publishes to read: resources and resource templates
+type ResourceList struct {
+	Resources []Resource
+	Templates []ResourceTemplate
+}
+
+// DiscoverResources returns the server's resources and templates, cached like the
+// tool list: they are refetched when the cache expires or the server reports a
+// change. It returns nil for a server without resources and fails fast for an
+// unavailable one.
+func (c *Client) DiscoverResources(ctx context.Context) (*ResourceList, error) {
+	if !c.SupportsResources() {
+		return nil, nil
+	}
+	if !c.Available() {
+		return nil, fmt.Errorf("failed to discover resources: %w", ErrServerUnavailable)
+	}
+
+	c.resourcesMu.Lock()
+	defer c.resourcesMu.Unlock()
+
+	if c.resources != nil && !c.resourcesStale.Load() && (c.toolsTTL < 0 || time.Since(c.resourcesAt) < c.toolsTTL) {
+		return c.resources, nil
+	}
+
+	// A change reported while the list is fetched expires it again
+	c.resourcesStale.Store(false)
+
+	resources, err := c.ListResources(ctx)
+	if err != nil {
+		c.resourcesStale.Store(true)
+		return nil, fmt.Errorf("failed to discover resources: %w", err)
+	}
+
+	// Templates are optional; servers without them answer with an error
+	templates, err := c.ListResourceTemplates(ctx)
+	if err != nil {
+		log.DefaultLogger.Debug("Failed to list MCP resource templates", "type", c.serverType, "error", err)
+	}
+
+	list := &ResourceList{Resources: resources, Templates: templates}
+	if !reflect.DeepEqual(list, c.resources) {
+		c.toolsGeneration.Add(1)
+	}
+	c.resources = list
+	c.resourcesAt = time.Now()
+
+	return list, nil
+}
+
+// ListResources fetches every resource the server publishes
+func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
+	var resources []Resource
+	err := c.list(ctx, "resources/list", func(cursor string) (string, error) {
+		var page struct {
+			Resources  []Resource `json:"resources"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		err := c.call(ctx, "resources/list", cursorParams(cursor), &page)
+		resources = append(resources, page.Resources...)
+		return page.NextCursor, err
+	})
+	return resources, err
+}
+
+// ListResourceTemplates fetches every resource template the server publishes
+func (c *Client) ListResourceTemplates(ctx context.Context) ([]ResourceTemplate, error) {
+	var templates []ResourceTemplate
+	err := c.list(ctx, "resources/templates/list", func(cursor string) (string, error) {
+		var page struct {
+			ResourceTemplates []ResourceTemplate `json:"resourceTemplates"`
+			NextCursor        string             `json:"nextCursor"`
+		}
+		err := c.call(ctx, "resources/templates/list", cursorParams(cursor), &page)
+		templates = append(templates, page.ResourceTemplates...)
+		return page.NextCursor, err
+	})
+	return templates, err
+}
+
+// ReadResource fetches the contents of a resource
+func (c *Client) ReadResource(ctx context.Context, uri string) ([]ResourceContents, error) {
+	var result struct {
+		Contents []ResourceContents `json:"contents"`
+	}
+
+	if err := c.call(ctx, "resources/read", map[string]interface{}{"uri": uri}, &result); err != nil {
+		return nil, fmt.Errorf("failed to read resource %s: %w", uri, err)
+	}
+
+	return result.Contents, nil
+}
+
+// ListPrompts fetches every prompt the server publishes
+func (c *Client) ListPrompts(ctx context.Context) ([]Prompt, error) {
+	var prompts []Prompt
+	err := c.list(ctx, "prompts/list", func(cursor string) (string, error) {
+		var page struct {
+			Prompts    []Prompt `json:"prompts"`
+			NextCursor string   `json:"nextCursor"`
+		}
+		err := c.call(ctx, "prompts/list", cursorParams(cursor), &page)
+		prompts = append(prompts, page.Prompts...)
+		return page.NextCursor, err
+	})
+	return prompts, err
+}
+
+// GetPrompt renders a prompt with the given arguments
+func (c *Client) GetPrompt(ctx context.Context, name string, args map[string]string) (*PromptResult, error) {
+	params := map[string]interface{}{"name": name}
+	if len(args) > 0 {
+		params["arguments"] = args
+	}
+
+	var result PromptResult
+	if err := c.call(ctx, "prompts/get", params, &result); err != nil {
+		return nil, fmt.Errorf("failed to get prompt %s: %w", name, err)
+	}
+
+	return &result, nil
+}
+
+// list follows nextCursor through a paginated list method
+func (c *Client) list(ctx context.Context, method string, fetch func(cursor string) (string, error)) error {
+	cursor := ""
+	for page := 0; page < maxListPages; page++ {
+		next, err := fetch(cursor)
+		if err != nil {
+			return fmt.Errorf("%s failed: %w", method, err)
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+	return fmt.Errorf("%s returned more than %d pages", method, maxListPages)
+}
+
+// cursorParams returns the params of a list request for a page
+func cursorParams(cursor string) interface{} {
+	if cursor == "" {
+		return nil
+	}
+	return map[string]string{"cursor": cursor}
+}
+
+// ResourceResult turns the contents of a resource into a tool result
+func ResourceResult(contents []ResourceContents) *ToolResult {
+	result := &ToolResult{Content: make([]Content, 0, len(contents))}
+	for i := range contents {
+		result.Content = append(result.Content, Content{Type: ContentResource, Resource: &contents[i]})
+	}
+	return result
+}
@@ -0,0 +1,165 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp/mcptest"
+)
+
+func TestResourcesAndPrompts(t *testing.T) {
+	server := mcptest.NewServer(t, map[string]interface{}{
+		"resources": map[string]interface{}{},
+		"prompts":   map[string]interface{}{},
+	}, map[string]mcptest.Handler{
+		"resources/list": func(params map[string]interface{}) (interface{}, error) {
+			// Two pages
+			if params["cursor"] == "page-2" {
+				return map[string]interface{}{
+					"resources": []Resource{{URI: "runbook://disk-full", Name: "disk-full"}},
+				}, nil
+			}
+			return map[string]interface{}{
+				"resources":  []Resource{{URI: "runbook://high-cpu", Name: "high-cpu", MimeType: "text/markdown"}},
+				"nextCursor": "page-2",
+			}, nil
+		},
+		"resources/templates/list": func(params map[string]interface{}) (interface{}, error) {
+			return map[string]interface{}{
+				"resourceTemplates": []ResourceTemplate{{URITemplate: "queue://{name}/stats", Name: "queue-stats"}},
+			}, nil
+		},
+		"resources/read": func(params map[string]interface{}) (interface{}, error) {
+			if params["uri"] != "runbook://high-cpu" {
+				return nil, &mcptest.Error{Code: -32002, Message: "resource not found"}
+			}
+			return map[string]interface{}{
+				"contents": []ResourceContents{{URI: "runbook://high-cpu", MimeType: "text/markdown", Text: "# High CPU"}},
+			}, nil
+		},
+		"prompts/list": func(params map[string]interface{}) (interface{}, error) {
+			return map[string]interface{}{
+				"prompts": []Prompt{{
+					Name:      "investigate_queue",
+					Arguments: []PromptArgument{{Name: "queue", Required: true}},
+				}},
+			}, nil
+		},
+		"prompts/get": func(params map[string]interface{}) (interface{}, error) {
+			args, _ := params["arguments"].(map[string]interface{})
+			return PromptResult{Messages: []PromptMessage{{
+				Role:    "user",
+				Content: Content{Type: ContentText, Text: "Why is queue " + args["queue"].(string) + " slow?"},
+			}}}, nil
+		},
+	})
+
+	client := NewClient(server.URL, "genesys")
+	ctx := context.Background()
+
+	if client.SupportsResources() || client.SupportsPrompts() {
+		t.Error("capabilities should be unknown before Connect")
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if !client.SupportsResources() || !client.SupportsPrompts() {
+		t.Error("SupportsResources() and SupportsPrompts() should follow the declared capabilities")
+	}
+
+	resources, err := client.ListResources(ctx)
+	if err != nil {
+		t.Fatalf("ListResources() error = %v", err)
+	}
+	if len(resources) != 2 || resources[0].URI != "runbook://high-cpu" || resources[1].URI != "runbook://disk-full" {
+		t.Errorf("ListResources() = %+v, want both pages", resources)
+	}
+
+	templates, err := client.ListResourceTemplates(ctx)
+	if err != nil || len(templates) != 1 || templates[0].URITemplate != "queue://{name}/stats" {
+		t.Errorf("ListResourceTemplates() = %+v, %v", templates, err)
+	}
+
+	contents, err := client.ReadResource(ctx, "runbook://high-cpu")
+	if err != nil || len(contents) != 1 || contents[0].Text != "# High CPU" {
+		t.Errorf("ReadResource() = %+v, %v", contents, err)
+	}
+	if FormatToolResult(ResourceResult(contents)) != "Resource runbook://high-cpu:\n# High CPU" {
+		t.Errorf("ResourceResult() formats as %q", FormatToolResult(ResourceResult(contents)))
+	}
+	if _, err := client.ReadResource(ctx, "runbook://missing"); err == nil {
+		t.Error("ReadResource() should fail for an unknown resource")
+	}
+
+	prompts, err := client.ListPrompts(ctx)
+	if err != nil || len(prompts) != 1 || !prompts[0].Arguments[0].Required {
+		t.Errorf("ListPrompts() = %+v, %v", prompts, err)
+	}
+
+	prompt, err := client.GetPrompt(ctx, "investigate_queue", map[string]string{"queue": "Support"})
+	if err != nil {
+		t.Fatalf("GetPrompt() error = %v", err)
+	}
+	if len(prompt.Messages) != 1 || prompt.Messages[0].Content.Text != "Why is queue Support slow?" {
+		t.Errorf("GetPrompt() = %+v", prompt)
+	}
+}
+
+func TestListPaginationLimit(t *testing.T) {
+	server := mcptest.NewServer(t, map[string]interface{}{"resources": map[string]interface{}{}}, map[string]mcptest.Handler{
+		"resources/list": func(params map[string]interface{}) (interface{}, error) {
+			return map[string]interface{}{"resources": []Resource{}, "nextCursor": "again"}, nil
+		},
+	})
+
+	client := NewClient(server.URL, "grafana")
+	if _, err := client.ListResources(context.Background()); err == nil {
+		t.Error("ListResources() should stop following a cursor that never ends")
+	}
+}
+
+func TestDiscoverResources(t *testing.T) {
+	var lists atomic.Int32
+	server := mcptest.NewServer(t, map[string]interface{}{"resources": map[string]interface{}{"listChanged": true}}, map[string]mcptest.Handler{
+		"resources/list": func(params map[string]interface{}) (interface{}, error) {
+			lists.Add(1)
+			return map[string]interface{}{"resources": []Resource{{URI: "runbook://disk-full", Name: "disk-full"}}}, nil
+		},
+	})
+
+	ctx := context.Background()
+	client := NewClient(server.URL, "grafana")
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	for n := 0; n < 2; n++ {
+		list, err := client.DiscoverResources(ctx)
+		if err != nil {
+			t.Fatalf("DiscoverResources() error = %v", err)
+		}
+		if len(list.Resources) != 1 || len(list.Templates) != 0 {
+			t.Errorf("DiscoverResources() = %+v, want one resource and no templates", list)
+		}
+	}
+	if n := lists.Load(); n != 1 {
+		t.Errorf("resources/list called %d times, want the cached list reused", n)
+	}
+
+	// The server reports a change
+	client.handleNotification("notifications/resources/list_changed", nil)
+	if _, err := client.DiscoverResources(ctx); err != nil {
+		t.Fatalf("DiscoverResources() error = %v", err)
+	}
+	if n := lists.Load(); n != 2 {
+		t.Errorf("resources/list called %d times after list_changed, want 2", n)
+	}
+
+	// An unavailable server is not asked
+	client.setAvailable(false)
+	if _, err := client.DiscoverResources(ctx); !errors.Is(err, ErrServerUnavailable) {
+		t.Errorf("DiscoverResources() on an unavailable server error = %v, want %v", err, ErrServerUnavailable)
+	}
+}
@@ -0,0 +1,43 @@
+package mcp
+
+// Content block types of a tool result
+const (
+	ContentText         = "text"
+	ContentImage        = "image"
+	ContentAudio        = "audio"
+	ContentResourceLink = "resource_link"
+	ContentResource     = "resource"
+)
+
+// ToolResult is the outcome of a tools/call. IsError marks a failure the tool
+// reported itself, as opposed to a protocol error.
+type ToolResult struct {
+	Content           []Content   `json:"content"`
+	StructuredContent interface{} `json:"structuredContent,omitempty"`
+	IsError           bool        `json:"isError,omitempty"`
+}
+
+// Content is one block of a tool result
+type Content struct {
+	Type        string            `json:"type"`
+	Text        string            `json:"text,omitempty"`        // text
+	Data        string            `json:"data,omitempty"`        // image, audio: base64
+	MimeType    string            `json:"mimeType,omitempty"`    // image, audio, resource_link
+	URI         string            `json:"uri,omitempty"`         // resource_link
+	Name        string            `json:"name,omitempty"`        // resource_link
+	Description string            `json:"description,omitempty"` // resource_link
+	Resource    *ResourceContents `json:"resource,omitempty"`    // resource
+}
+
+// ResourceContents is the content of a resource: Text, or Blob for binary data (base64)
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// NewTextResult creates a result holding a single text block
+func NewTextResult(text string) *ToolResult {
+	return &ToolResult{Content: []Content{{Type: ContentText, Text: text}}}
+}
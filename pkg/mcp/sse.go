@@ -0,0 +1,374 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// sseEndpointTimeout bounds the wait for the server to announce its message endpoint
+const sseEndpointTimeout = 10 * time.Second
+
+var errSSEEndpointTimeout = errors.New("timed out waiting for SSE endpoint")
+
+// maxMessageSize is the largest message the transports accept (tool results can be large)
+const maxMessageSize = 16 * 1024 * 1024
+
+// sseEvent is one server-sent event
+type sseEvent struct {
+	Event string
+	Data  string
+	ID    string
+}
+
+// readSSE parses an event stream and passes each event to fn until fn returns false
+// or the stream ends
+func readSSE(r io.Reader, fn func(sseEvent) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+
+	var ev sseEvent
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" {
+			if len(data) > 0 || ev.Event != "" {
+				ev.Data = strings.Join(data, "\n")
+				if !fn(ev) {
+					return nil
+				}
+			}
+			ev, data = sseEvent{}, nil
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue // Comment / keep-alive
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.Event = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			ev.ID = value
+		}
+	}
+
+	return scanner.Err()
+}
+
+// sseTransport implements the HTTP+SSE transport: the server announces a message
+// endpoint on a long-lived event stream, requests are POSTed to that endpoint and
+// responses arrive on the stream
+type sseTransport struct {
+	streamURL    string
+	httpClient   *resty.Client
+	streamClient *resty.Client // Without a timeout, the stream stays open
+	version      *protocolVersion
+	stream       *sseStream
+	opening      chan struct{}                   // Closed when the open in progress finishes
+	generation   int                             // Incremented by close, so an open in progress is discarded
+	onReconnect  func(ctx context.Context) error // Initializes the session on a stream that replaced a dropped one
+	pending      map[string]chan *rpcResponse    // Requests waiting for a response, by ID
+	pendingMu    sync.Mutex
+	onNotify     notificationHandler
+	mu           sync.Mutex
+}
+
+// sseStream is one open event stream and the endpoint it announced
+type sseStream struct {
+	endpoint string
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// newSSETransport creates an SSE transport. The stream lives at /sse below the
+// server URL unless the URL already points at it.
+func newSSETransport(serverURL string, httpClient, streamClient *resty.Client, version *protocolVersion) *sseTransport {
+	streamURL := strings.TrimSuffix(serverURL, "/")
+	if !strings.HasSuffix(streamURL, "/sse") {
+		streamURL += "/sse"
+	}
+
+	return &sseTransport{
+		streamURL:    streamURL,
+		httpClient:   httpClient,
+		streamClient: streamClient,
+		version:      version,
+		pending:      make(map[string]chan *rpcResponse),
+	}
+}
+
+// open returns the current stream, opening a new one if there is none or it ended.
+// A stream that replaces a dropped one belongs to a new server session, so it is
+// initialized with onReconnect before callers that need a session may use it;
+// the handshake's own messages pass session=false.
+func (t *sseTransport) open(ctx context.Context, session bool) (*sseStream, error) {
+	for {
+		t.mu.Lock()
+		alive := t.stream != nil && !t.stream.ended()
+		if alive && (t.opening == nil || !session) {
+			stream := t.stream
+			t.mu.Unlock()
+			return stream, nil
+		}
+		if t.opening != nil {
+			opening := t.opening
+			t.mu.Unlock()
+			select {
+			case <-opening:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		opening := make(chan struct{})
+		t.opening = opening
+		reopened := t.stream != nil
+		generation := t.generation
+		t.mu.Unlock()
+
+		stream, err := t.dial(ctx)
+
+		t.mu.Lock()
+		if err == nil && t.generation != generation {
+			stream.cancel()
+			err = errors.New("SSE transport closed")
+		}
+		if err == nil {
+			t.stream = stream
+		}
+		t.mu.Unlock()
+
+		if err == nil && reopened && t.onReconnect != nil {
+			if rerr := t.onReconnect(ctx); rerr != nil {
+				err = fmt.Errorf("failed to re-initialize MCP session on the new SSE stream: %w", rerr)
+			}
+		}
+
+		t.mu.Lock()
+		t.opening = nil
+		t.mu.Unlock()
+		close(opening)
+
+		if err != nil {
+			return nil, err
+		}
+		return stream, nil
+	}
+}
+
+// dial opens an event stream and waits for it to announce its endpoint. The
+// caller's context and sseEndpointTimeout bound the wait; the stream itself stays
+// open until it is cancelled.
+func (t *sseTransport) dial(ctx context.Context) (*sseStream, error) {
+	streamCtx, cancel := context.WithCancelCause(context.Background())
+	stopWait := context.AfterFunc(ctx, func() { cancel(ctx.Err()) })
+	defer stopWait()
+	timer := time.AfterFunc(sseEndpointTimeout, func() { cancel(errSSEEndpointTimeout) })
+	defer timer.Stop()
+
+	// fail ends the stream and reports why; a timeout or cancellation that cut
+	// the request short is the better explanation
+	fail := func(err error) (*sseStream, error) {
+		cancel(err)
+		return nil, context.Cause(streamCtx)
+	}
+
+	resp, err := t.streamClient.R().
+		SetContext(streamCtx).
+		SetDoNotParseResponse(true).
+		SetHeader("Accept", "text/event-stream").
+		Get(t.streamURL)
+	if err != nil {
+		return fail(fmt.Errorf("failed to open SSE stream: %w", err))
+	}
+	if resp.StatusCode() != 200 {
+		resp.RawBody().Close()
+		return fail(fmt.Errorf("SSE stream failed with status: %d", resp.StatusCode()))
+	}
+
+	stream := &sseStream{cancel: func() { cancel(nil) }, done: make(chan struct{})}
+	endpoints := make(chan string, 1)
+
+	go func() {
+		defer close(stream.done)
+		defer resp.RawBody().Close()
+
+		readSSE(resp.RawBody(), func(ev sseEvent) bool {
+			switch ev.Event {
+			case "endpoint":
+				select {
+				case endpoints <- ev.Data:
+				default:
+				}
+			case "", "message":
+				t.dispatch([]byte(ev.Data))
+			}
+			return true
+		})
+	}()
+
+	select {
+	case endpoint := <-endpoints:
+		if stream.endpoint, err = t.resolve(endpoint); err != nil {
+			return fail(err)
+		}
+	case <-stream.done:
+		return fail(errors.New("SSE stream closed before announcing an endpoint"))
+	}
+
+	// From here on the stream outlives the caller
+	if !stopWait() || !timer.Stop() {
+		return fail(context.Canceled)
+	}
+	return stream, nil
+}
+
+// ended reports whether the stream has closed
+func (s *sseStream) ended() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// resolve turns the announced endpoint, usually a path, into an absolute URL
+func (t *sseTransport) resolve(endpoint string) (string, error) {
+	base, err := url.Parse(t.streamURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid SSE URL: %w", err)
+	}
+	ref, err := url.Parse(strings.TrimSpace(endpoint))
+	if err != nil {
+		return "", fmt.Errorf("invalid SSE endpoint %q: %w", endpoint, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// dispatch hands a response from the stream to the request waiting for it
+// and notifications to the notification handler
+func (t *sseTransport) dispatch(data []byte) {
+	var msg rpcResponse
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+	if msg.isNotification() {
+		if t.onNotify != nil {
+			t.onNotify(msg.Method, msg.Params)
+		}
+		return
+	}
+	if msg.Result == nil && msg.Error == nil {
+		return // Server request, not supported
+	}
+
+	t.pendingMu.Lock()
+	ch, ok := t.pending[strings.TrimSpace(string(msg.ID))]
+	t.pendingMu.Unlock()
+
+	if ok {
+		select {
+		case ch <- &msg:
+		default:
+		}
+	}
+}
+
+// post sends a message to the stream's endpoint
+func (t *sseTransport) post(ctx context.Context, stream *sseStream, req rpcRequest) error {
+	r := t.httpClient.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(req)
+	setProtocolVersion(r, t.version)
+	limitRetries(r, req.Method)
+
+	resp, err := r.Post(stream.endpoint)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode() >= 400 {
+		return fmt.Errorf("%s failed with status: %d", req.Method, resp.StatusCode())
+	}
+
+	return nil
+}
+
+func (t *sseTransport) send(ctx context.Context, req rpcRequest) (*rpcResponse, error) {
+	stream, err := t.open(ctx, req.Method != "initialize")
+	if err != nil {
+		return nil, err
+	}
+
+	key := strconv.FormatInt(*req.ID, 10)
+	ch := make(chan *rpcResponse, 1)
+
+	t.pendingMu.Lock()
+	t.pending[key] = ch
+	t.pendingMu.Unlock()
+
+	defer func() {
+		t.pendingMu.Lock()
+		delete(t.pending, key)
+		t.pendingMu.Unlock()
+	}()
+
+	if err := t.post(ctx, stream, req); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-stream.done:
+		return nil, fmt.Errorf("SSE stream closed before %s was answered", req.Method)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *sseTransport) notify(ctx context.Context, req rpcRequest) error {
+	stream, err := t.open(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	return t.post(ctx, stream, req)
+}
+
+func (t *sseTransport) setNotificationHandler(handler notificationHandler) {
+	t.onNotify = handler
+}
+
+func (t *sseTransport) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.generation++
+	if t.stream != nil {
+		t.stream.cancel()
+		t.stream = nil
+	}
+
+	return nil
+}
@@ -0,0 +1,333 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Restart backoff for crashed stdio servers
+const (
+	stdioRestartMinBackoff = 1 * time.Second
+	stdioRestartMaxBackoff = 30 * time.Second
+	stdioStableRuntime     = 1 * time.Minute // A process that ran this long resets the backoff
+	stdioStopTimeout       = 5 * time.Second // Grace period after closing stdin before the process is killed
+)
+
+// errTransportClosed is returned when a closed transport is used
+var errTransportClosed = errors.New("MCP transport is closed")
+
+// stdioTransport launches an MCP server as a child process and exchanges
+// newline-delimited JSON-RPC messages over its stdin and stdout
+type stdioTransport struct {
+	name      string // Server type, for logs
+	command   string
+	args      []string
+	env       []string
+	onRestart func(ctx context.Context) error // Re-initializes the session after a crash
+	proc      *stdioProcess
+	started   bool
+	closed    bool
+	backoff   time.Duration
+	pending   map[string]chan *rpcResponse // Requests waiting for a response, by ID
+	pendingMu sync.Mutex
+	onNotify  notificationHandler
+	mu        sync.Mutex
+}
+
+// stdioProcess is one running server process
+type stdioProcess struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	writeMu   sync.Mutex
+	startedAt time.Time
+	done      chan struct{} // Closed when the process has exited
+}
+
+// newStdioTransport creates a stdio transport; the process starts on first use
+func newStdioTransport(name, command string, args, env []string) *stdioTransport {
+	return &stdioTransport{
+		name:    name,
+		command: command,
+		args:    args,
+		env:     env,
+		backoff: stdioRestartMinBackoff,
+		pending: make(map[string]chan *rpcResponse),
+	}
+}
+
+// process returns the running process, starting one if needed. A process
+// started to replace a crashed one is re-initialized before it is used.
+func (t *stdioTransport) process(ctx context.Context) (*stdioProcess, error) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil, errTransportClosed
+	}
+	if t.proc != nil && !t.proc.exited() {
+		proc := t.proc
+		t.mu.Unlock()
+		return proc, nil
+	}
+
+	proc, err := t.start()
+	if err != nil {
+		t.mu.Unlock()
+		return nil, err
+	}
+	restarted := t.started
+	t.started = true
+	t.proc = proc
+	t.mu.Unlock()
+
+	if restarted && t.onRestart != nil {
+		if err := t.onRestart(ctx); err != nil {
+			return nil, fmt.Errorf("failed to re-initialize restarted MCP server: %w", err)
+		}
+	}
+
+	return proc, nil
+}
+
+// start launches the server process and its reader goroutines
+// Must be called with lock held
+func (t *stdioTransport) start() (*stdioProcess, error) {
+	cmd := exec.Command(t.command, t.args...)
+	cmd.Env = append(os.Environ(), t.env...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start MCP server %s: %w", t.command, err)
+	}
+	log.DefaultLogger.Info("Started MCP server process", "type", t.name, "command", t.command, "pid", cmd.Process.Pid)
+
+	proc := &stdioProcess{cmd: cmd, stdin: stdin, startedAt: time.Now(), done: make(chan struct{})}
+
+	var output sync.WaitGroup
+	output.Add(2)
+	go func() {
+		defer output.Done()
+		t.readMessages(proc, stdout)
+	}()
+	go func() {
+		defer output.Done()
+		t.drainStderr(stderr)
+	}()
+
+	go func() {
+		// Pipes must be fully read before Wait closes them
+		output.Wait()
+		err := cmd.Wait()
+		close(proc.done)
+		t.exited(proc, err)
+	}()
+
+	return proc, nil
+}
+
+// readMessages dispatches responses from stdout and answers the server's own requests
+func (t *stdioTransport) readMessages(proc *stdioProcess, stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+
+	for scanner.Scan() {
+		var msg rpcResponse
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.DefaultLogger.Debug("Ignoring non-JSON output from MCP server", "type", t.name, "line", scanner.Text())
+			continue
+		}
+
+		if msg.isNotification() {
+			if t.onNotify != nil {
+				t.onNotify(msg.Method, msg.Params)
+			}
+			continue
+		}
+		if msg.Method != "" {
+			t.reply(proc, msg.ID, msg.Method)
+			continue
+		}
+
+		t.pendingMu.Lock()
+		ch, ok := t.pending[strings.TrimSpace(string(msg.ID))]
+		t.pendingMu.Unlock()
+
+		if ok {
+			resp := msg
+			select {
+			case ch <- &resp:
+			default:
+			}
+		}
+	}
+}
+
+// reply answers a request from the server: pings succeed, anything else is not supported
+func (t *stdioTransport) reply(proc *stdioProcess, id json.RawMessage, method string) {
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if method == "ping" {
+		response["result"] = map[string]interface{}{}
+	} else {
+		response["error"] = RPCError{Code: -32601, Message: "method not found: " + method}
+	}
+
+	if err := proc.write(response); err != nil {
+		log.DefaultLogger.Debug("Failed to answer MCP server request", "type", t.name, "method", method, "error", err)
+	}
+}
+
+// drainStderr copies the server's log output into the plugin log
+func (t *stdioTransport) drainStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+
+	for scanner.Scan() {
+		log.DefaultLogger.Info("MCP server output", "type", t.name, "line", scanner.Text())
+	}
+}
+
+// exited schedules a restart unless the transport was closed
+func (t *stdioTransport) exited(proc *stdioProcess, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed || t.proc != proc {
+		return
+	}
+
+	if time.Since(proc.startedAt) >= stdioStableRuntime {
+		t.backoff = stdioRestartMinBackoff
+	}
+	delay := t.backoff
+	t.backoff *= 2
+	if t.backoff > stdioRestartMaxBackoff {
+		t.backoff = stdioRestartMaxBackoff
+	}
+
+	log.DefaultLogger.Warn("MCP server process exited, restarting", "type", t.name, "error", err, "delay", delay)
+	time.AfterFunc(delay, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if _, err := t.process(ctx); err != nil && !errors.Is(err, errTransportClosed) {
+			log.DefaultLogger.Error("Failed to restart MCP server process", "type", t.name, "error", err)
+		}
+	})
+}
+
+func (t *stdioTransport) send(ctx context.Context, req rpcRequest) (*rpcResponse, error) {
+	proc, err := t.process(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key := strconv.FormatInt(*req.ID, 10)
+	ch := make(chan *rpcResponse, 1)
+
+	t.pendingMu.Lock()
+	t.pending[key] = ch
+	t.pendingMu.Unlock()
+
+	defer func() {
+		t.pendingMu.Lock()
+		delete(t.pending, key)
+		t.pendingMu.Unlock()
+	}()
+
+	if err := proc.write(req); err != nil {
+		return nil, fmt.Errorf("failed to send %s: %w", req.Method, err)
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-proc.done:
+		return nil, fmt.Errorf("MCP server process exited before %s was answered", req.Method)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) notify(ctx context.Context, req rpcRequest) error {
+	proc, err := t.process(ctx)
+	if err != nil {
+		return err
+	}
+
+	return proc.write(req)
+}
+
+func (t *stdioTransport) setNotificationHandler(handler notificationHandler) {
+	t.onNotify = handler
+}
+
+// close stops the server: stdin is closed so it can exit cleanly, then it is killed
+func (t *stdioTransport) close() error {
+	t.mu.Lock()
+	t.closed = true
+	proc := t.proc
+	t.proc = nil
+	t.mu.Unlock()
+
+	if proc == nil {
+		return nil
+	}
+
+	proc.stdin.Close()
+	select {
+	case <-proc.done:
+	case <-time.After(stdioStopTimeout):
+		log.DefaultLogger.Warn("MCP server did not exit, killing it", "type", t.name, "pid", proc.cmd.Process.Pid)
+		proc.cmd.Process.Kill()
+		<-proc.done
+	}
+
+	return nil
+}
+
+// write sends one message as a line on stdin
+func (p *stdioProcess) write(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	_, err = p.stdin.Write(append(data, '\n'))
+	return err
+}
+
+// exited reports whether the process has exited
+func (p *stdioProcess) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,139 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStdioHelperProcess is not a real test: it is the MCP server launched by the
+// stdio tests, running in a child copy of the test binary
+func TestStdioHelperProcess(t *testing.T) {
+	if os.Getenv("MCP_STDIO_HELPER") != "1" {
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, "helper server started")
+
+	initialized := false
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req rpcRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || req.ID == nil {
+			continue
+		}
+
+		var result interface{}
+		switch {
+		case req.Method == "initialize":
+			initialized = true
+			result = map[string]interface{}{
+				"protocolVersion": LatestProtocolVersion,
+				"serverInfo":      map[string]string{"name": "helper", "version": "1"},
+			}
+		case !initialized:
+			fmt.Printf(`{"jsonrpc":"2.0","id":%d,"error":{"code":-32002,"message":"not initialized"}}`+"\n", *req.ID)
+			continue
+		case req.Method == "tools/call" && strings.Contains(scanner.Text(), `"crash"`):
+			os.Exit(3)
+		case req.Method == "tools/call":
+			result = map[string]interface{}{"content": []map[string]string{{"type": "text", "text": "pong"}}}
+		default:
+			result = map[string]interface{}{}
+		}
+
+		fmt.Println(rpcResult(*req.ID, result))
+	}
+	os.Exit(0)
+}
+
+func newStdioTestClient(t *testing.T) *Client {
+	t.Helper()
+
+	client, err := NewClientWithConfig("", "helper", ClientConfig{
+		Transport: TransportStdio,
+		Command:   os.Args[0],
+		Args:      []string{"-test.run=^TestStdioHelperProcess$"},
+		Env:       []string{"MCP_STDIO_HELPER=1"},
+	})
+	if err != nil {
+		t.Fatalf("NewClientWithConfig() error = %v", err)
+	}
+	return client
+}
+
+func TestStdioTransport(t *testing.T) {
+	client := newStdioTestClient(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if info := client.ServerInfo(); info.ServerInfo.Name != "helper" {
+		t.Errorf("ServerInfo() = %+v, want helper", info)
+	}
+
+	result, err := client.InvokeTool(ctx, "helper__echo", nil)
+	if err != nil || FormatToolResult(result) != "pong" {
+		t.Fatalf("InvokeTool() = %v, %v, want pong", result, err)
+	}
+
+	stdio := client.transport.(*stdioTransport)
+	proc := stdio.proc
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if !proc.exited() {
+		t.Error("Close() should stop the server process")
+	}
+	if err := client.Health(ctx); err == nil {
+		t.Error("Health() should fail after Close()")
+	}
+}
+
+func TestStdioTransportRestart(t *testing.T) {
+	client := newStdioTestClient(t)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	stdio := client.transport.(*stdioTransport)
+	crashed := stdio.proc
+
+	if _, err := client.InvokeTool(ctx, "helper__crash", nil); err == nil {
+		t.Fatal("InvokeTool() should fail when the server crashes")
+	}
+	<-crashed.done
+
+	// The next call starts a new process, which only answers after a new handshake
+	result, err := client.InvokeTool(ctx, "helper__echo", nil)
+	if err != nil || FormatToolResult(result) != "pong" {
+		t.Fatalf("InvokeTool() after restart = %v, %v, want pong", result, err)
+	}
+
+	stdio.mu.Lock()
+	restarted := stdio.proc != crashed
+	stdio.mu.Unlock()
+	if !restarted {
+		t.Error("the crashed process should have been replaced")
+	}
+}
+
+func TestStdioTransportRequiresCommand(t *testing.T) {
+	if _, err := NewClientWithConfig("", "helper", ClientConfig{Transport: TransportStdio}); err == nil {
+		t.Error("NewClientWithConfig() should require a command for stdio")
+	}
+}
@@ -0,0 +1,108 @@
+package mcp
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Reconnect backoff and health checking for supervised servers
+const (
+	DefaultHealthInterval = 30 * time.Second // Pause between pings of a connected server
+	reconnectMinBackoff   = 1 * time.Second
+	reconnectMaxBackoff   = 2 * time.Minute
+	supervisorTimeout     = 10 * time.Second // Per ping or connection attempt
+)
+
+// Available reports whether the server is usable: false after a failed Connect or
+// ping until the server is reached again
+func (c *Client) Available() bool {
+	return !c.unavailable.Load()
+}
+
+// CircuitState returns the state of the circuit breaker around tool calls
+func (c *Client) CircuitState() string {
+	return c.breaker.state()
+}
+
+// setAvailable records whether the server can be reached. A change counts as a
+// tool list change, so the server's tools are dropped while it is down and
+// offered again when it comes back.
+func (c *Client) setAvailable(available bool) {
+	if c.unavailable.Swap(!available) == !available {
+		return
+	}
+
+	if available {
+		c.breaker.reset()
+		log.DefaultLogger.Info("MCP server available", "type", c.serverType)
+	} else {
+		log.DefaultLogger.Warn("MCP server unavailable", "type", c.serverType)
+	}
+
+	c.toolsGeneration.Add(1)
+	c.toolsChanged()
+}
+
+// Supervise keeps the client connected in the background until Close: a connected
+// server is pinged every interval (0 = DefaultHealthInterval), and an unavailable
+// one is reconnected with exponential backoff and jitter
+func (c *Client) Supervise(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopSupervisor != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stopSupervisor = cancel
+
+	go c.supervise(ctx, interval)
+}
+
+func (c *Client) supervise(ctx context.Context, interval time.Duration) {
+	backoff := reconnectMinBackoff
+
+	for {
+		wait := interval
+		if c.Available() {
+			if err := c.check(ctx, c.Health); err != nil {
+				log.DefaultLogger.Warn("MCP server health check failed", "type", c.serverType, "error", err)
+				c.setAvailable(false)
+				wait = reconnectMinBackoff
+			}
+		} else if err := c.check(ctx, c.Connect); err != nil {
+			wait = jitter(backoff)
+			log.DefaultLogger.Debug("MCP server reconnect failed", "type", c.serverType, "error", err, "retry_in", wait)
+			backoff = min(backoff*2, reconnectMaxBackoff)
+		} else {
+			backoff = reconnectMinBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// check runs a ping or connection attempt with the supervisor's timeout
+func (c *Client) check(ctx context.Context, fn func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, supervisorTimeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// jitter returns a random delay between half and all of d, so servers that went
+// down together are not all retried at once
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
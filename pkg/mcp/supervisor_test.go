@@ -0,0 +1,92 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp/mcptest"
+)
+
+func TestSupervisorReconnects(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+
+	rpc := mcptest.NewServer(t, nil, map[string]mcptest.Handler{
+		"tools/list": func(params map[string]interface{}) (interface{}, error) {
+			return map[string]interface{}{"tools": []Tool{{Name: "list_queues"}}}, nil
+		},
+	})
+	handler := rpc.Config.Handler
+	rpc.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	client := NewClient(rpc.URL, "genesys")
+	defer client.Close()
+	ctx := context.Background()
+
+	// Degraded start: the server is down
+	if err := client.Connect(ctx); err == nil {
+		t.Fatal("Connect() should fail while the server is down")
+	}
+	if client.Available() {
+		t.Error("Available() = true after a failed Connect")
+	}
+	if _, err := client.DiscoverTools(ctx); !errors.Is(err, ErrServerUnavailable) {
+		t.Errorf("DiscoverTools() error = %v, want ErrServerUnavailable", err)
+	}
+	if _, err := client.CallTool(ctx, "list_queues", nil); !errors.Is(err, ErrServerUnavailable) {
+		t.Errorf("CallTool() error = %v, want ErrServerUnavailable", err)
+	}
+
+	changed := make(chan struct{}, 10)
+	client.OnToolsChanged(func() { changed <- struct{}{} })
+	generation := client.ToolsGeneration()
+
+	client.Supervise(20 * time.Millisecond)
+	down.Store(false)
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor("reconnect", client.Available)
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listeners were not told that the server came back")
+	}
+	if client.ToolsGeneration() == generation {
+		t.Error("ToolsGeneration() unchanged after the server came back")
+	}
+	if tools, err := client.DiscoverTools(ctx); err != nil || len(tools) != 1 {
+		t.Errorf("DiscoverTools() after reconnect = %v, %v", tools, err)
+	}
+
+	// A failing ping marks the server unavailable again
+	down.Store(true)
+	waitFor("health check failure", func() bool { return !client.Available() })
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := jitter(time.Second); d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("jitter(1s) = %s, want between 500ms and 1s", d)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// DefaultToolsTTL is how long a client caches the server's tool list
+const DefaultToolsTTL = 5 * time.Minute
+
+// DiscoverTools returns the server's tools, fetching them when the cached list
+// has expired or the server reported a change. An unavailable server has none.
+func (c *Client) DiscoverTools(ctx context.Context) ([]Tool, error) {
+	if !c.Available() {
+		return nil, fmt.Errorf("failed to discover tools: %w", ErrServerUnavailable)
+	}
+
+	c.toolsMu.Lock()
+	defer c.toolsMu.Unlock()
+
+	if !c.toolsFetchedAt.IsZero() && !c.toolsStale.Load() && (c.toolsTTL < 0 || time.Since(c.toolsFetchedAt) < c.toolsTTL) {
+		return c.tools, nil
+	}
+
+	return c.fetchTools(ctx)
+}
+
+// RefreshTools fetches the server's tools, ignoring the cache
+func (c *Client) RefreshTools(ctx context.Context) ([]Tool, error) {
+	c.toolsMu.Lock()
+	defer c.toolsMu.Unlock()
+
+	return c.fetchTools(ctx)
+}
+
+// ToolsGeneration identifies the current tool and resource lists; it increases whenever either changes
+func (c *Client) ToolsGeneration() uint64 {
+	return c.toolsGeneration.Load()
+}
+
+// OnToolsChanged registers fn to be called (in its own goroutine) when the server
+// reports that its tools or resources changed or the session is re-established
+func (c *Client) OnToolsChanged(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.toolsListeners = append(c.toolsListeners, fn)
+}
+
+// fetchTools requests the tool list and replaces the cache
+// Must be called with toolsMu held
+func (c *Client) fetchTools(ctx context.Context) ([]Tool, error) {
+	// A change reported while the list is fetched expires it again
+	c.toolsStale.Store(false)
+
+	var tools []Tool
+	err := c.list(ctx, "tools/list", func(cursor string) (string, error) {
+		var page struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		err := c.call(ctx, "tools/list", cursorParams(cursor), &page)
+		tools = append(tools, page.Tools...)
+		return page.NextCursor, err
+	})
+	if err != nil {
+		c.toolsStale.Store(true)
+		return nil, fmt.Errorf("failed to discover tools: %w", err)
+	}
+
+	for i := range tools {
+		tools[i].Name = c.toolPrefix + tools[i].Name
+	}
+
+	if c.toolsGeneration.Load() == 0 || !reflect.DeepEqual(tools, c.tools) {
+		c.toolsGeneration.Add(1)
+	}
+	c.setTools(tools)
+	c.toolsFetchedAt = time.Now()
+
+	return c.tools, nil
+}
+
+// setTools replaces the cached tools and publishes their input schemas, which
+// tool calls read without waiting for a refresh to finish.
+// Must be called with toolsMu held
+func (c *Client) setTools(tools []Tool) {
+	schemas := make(schemasByTool, len(tools))
+	for _, tool := range tools {
+		schemas[tool.Name] = tool.InputSchema
+	}
+
+	c.tools = tools
+	c.toolSchemas.Store(&schemas)
+}
+
+// schemasByTool maps exposed tool names to their input schemas
+type schemasByTool map[string]map[string]interface{}
+
+// handleNotification reacts to notifications sent by the server
+func (c *Client) handleNotification(method string, params json.RawMessage) {
+	switch method {
+	case "notifications/tools/list_changed":
+		c.toolsChanged()
+	case "notifications/resources/list_changed":
+		// The resources are described alongside the tools, so their listeners hear of it
+		c.resourcesStale.Store(true)
+		c.notifyToolsListeners()
+	}
+}
+
+// toolsChanged expires the cached tools and resources and tells the listeners. It
+// does not wait for a refresh in progress, which may be the one that caused it.
+func (c *Client) toolsChanged() {
+	c.toolsStale.Store(true)
+	c.resourcesStale.Store(true)
+	c.notifyToolsListeners()
+}
+
+// notifyToolsListeners calls the functions registered with OnToolsChanged
+func (c *Client) notifyToolsListeners() {
+	c.mu.RLock()
+	listeners := append([]func(){}, c.toolsListeners...)
+	c.mu.RUnlock()
+
+	for _, fn := range listeners {
+		go fn()
+	}
+}
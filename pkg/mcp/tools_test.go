@@ -0,0 +1,141 @@
+package mcp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp/mcptest"
+)
+
+func TestToolRegistry(t *testing.T) {
+	var mu sync.Mutex
+	listCalls := 0
+	tools := []Tool{{Name: "list_alerts"}}
+
+	server := mcptest.NewServer(t, map[string]interface{}{"tools": map[string]interface{}{"listChanged": true}}, map[string]mcptest.Handler{
+		"tools/list": func(params map[string]interface{}) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			listCalls++
+			return map[string]interface{}{"tools": tools}, nil
+		},
+	})
+
+	client, _ := NewClientWithConfig(server.URL, "alertmanager", ClientConfig{ToolsTTL: time.Hour})
+	ctx := context.Background()
+
+	calls := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return listCalls
+	}
+
+	// Concurrent discovery fetches once
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.DiscoverTools(ctx); err != nil {
+				t.Errorf("DiscoverTools() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls() != 1 || client.ToolsGeneration() != 1 {
+		t.Fatalf("after discovery: %d tools/list calls, generation %d; want 1 and 1", calls(), client.ToolsGeneration())
+	}
+
+	// An unchanged list keeps the generation
+	if _, err := client.RefreshTools(ctx); err != nil {
+		t.Fatalf("RefreshTools() error = %v", err)
+	}
+	if client.ToolsGeneration() != 1 {
+		t.Errorf("generation = %d after an unchanged refresh, want 1", client.ToolsGeneration())
+	}
+
+	// list_changed expires the cache and notifies listeners
+	mu.Lock()
+	tools = append(tools, Tool{Name: "post_silence"})
+	mu.Unlock()
+
+	changed := make(chan struct{}, 1)
+	client.OnToolsChanged(func() { changed <- struct{}{} })
+	client.handleNotification("notifications/tools/list_changed", nil)
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnToolsChanged listener was not called")
+	}
+
+	got, err := client.DiscoverTools(ctx)
+	if err != nil {
+		t.Fatalf("DiscoverTools() error = %v", err)
+	}
+	if len(got) != 2 || got[1].Name != "alertmanager__post_silence" || client.ToolsGeneration() != 2 {
+		t.Errorf("after list_changed: tools %+v, generation %d; want 2 tools and generation 2", got, client.ToolsGeneration())
+	}
+}
+
+func TestToolRegistryTTL(t *testing.T) {
+	listCalls := 0
+	server := mcptest.NewServer(t, nil, map[string]mcptest.Handler{
+		"tools/list": func(params map[string]interface{}) (interface{}, error) {
+			listCalls++
+			return map[string]interface{}{"tools": []Tool{{Name: "search_dashboards"}}}, nil
+		},
+	})
+
+	client, _ := NewClientWithConfig(server.URL, "grafana", ClientConfig{ToolsTTL: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	client.DiscoverTools(ctx)
+	client.DiscoverTools(ctx)
+	if listCalls != 1 {
+		t.Fatalf("tools/list calls = %d within the TTL, want 1", listCalls)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	client.DiscoverTools(ctx)
+	if listCalls != 2 {
+		t.Errorf("tools/list calls = %d after the TTL, want 2", listCalls)
+	}
+}
+
+func TestToolPrefixConfig(t *testing.T) {
+	var called string
+	server := mcptest.NewServer(t, nil, map[string]mcptest.Handler{
+		"tools/list": func(params map[string]interface{}) (interface{}, error) {
+			return map[string]interface{}{"tools": []Tool{{Name: "list_alerts"}}}, nil
+		},
+		"tools/call": func(params map[string]interface{}) (interface{}, error) {
+			called, _ = params["name"].(string)
+			return map[string]interface{}{"content": []Content{{Type: ContentText, Text: "ok"}}}, nil
+		},
+	})
+
+	prefix := "am_"
+	client, _ := NewClientWithConfig(server.URL, "alertmanager", ClientConfig{ToolPrefix: &prefix})
+	ctx := context.Background()
+
+	tools, err := client.DiscoverTools(ctx)
+	if err != nil || len(tools) != 1 || tools[0].Name != "am_list_alerts" {
+		t.Fatalf("DiscoverTools() = %+v, %v; want am_list_alerts", tools, err)
+	}
+
+	if _, err := client.InvokeTool(ctx, "am_list_alerts", nil); err != nil || called != "list_alerts" {
+		t.Errorf("InvokeTool() called %q (error %v), want list_alerts", called, err)
+	}
+	if _, err := client.CallTool(ctx, "list_alerts", nil); err != nil || called != "list_alerts" {
+		t.Errorf("CallTool() called %q (error %v), want list_alerts", called, err)
+	}
+
+	none := ""
+	unprefixed, _ := NewClientWithConfig(server.URL, "alertmanager", ClientConfig{ToolPrefix: &none})
+	if tools, _ := unprefixed.DiscoverTools(ctx); len(tools) != 1 || tools[0].Name != "list_alerts" {
+		t.Errorf("DiscoverTools() without prefix = %+v, want list_alerts", tools)
+	}
+}
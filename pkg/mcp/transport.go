@@ -0,0 +1,332 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Transport names, selected per server in settings
+const (
+	TransportStreamableHTTP = "streamable-http" // POST JSON-RPC to the server URL (default)
+	TransportSSE            = "sse"             // HTTP+SSE: event stream at /sse, messages POSTed to the announced endpoint
+	TransportStdio          = "stdio"           // Child process speaking JSON-RPC on stdin/stdout
+)
+
+// Transports lists the known transport names
+var Transports = []string{TransportStreamableHTTP, TransportSSE, TransportStdio}
+
+// ErrSessionExpired is returned when the server no longer knows the client's session
+var ErrSessionExpired = errors.New("MCP session expired")
+
+// transport carries JSON-RPC messages between the client and an MCP server
+type transport interface {
+	// send delivers a request and waits for its response
+	send(ctx context.Context, req rpcRequest) (*rpcResponse, error)
+	// notify delivers a notification, which has no response
+	notify(ctx context.Context, req rpcRequest) error
+	// close ends the session and releases any open stream
+	close() error
+	// setNotificationHandler sets the function that receives server notifications
+	setNotificationHandler(handler notificationHandler)
+}
+
+// newTransport creates the transport selected in config for a server
+func newTransport(url, serverType string, config ClientConfig, httpClient, streamClient *resty.Client, version *protocolVersion) (transport, error) {
+	switch config.Transport {
+	case "", TransportStreamableHTTP:
+		return &streamableHTTPTransport{url: url, httpClient: httpClient, streamClient: streamClient, version: version}, nil
+	case TransportSSE:
+		return newSSETransport(url, httpClient, streamClient, version), nil
+	case TransportStdio:
+		if config.Command == "" {
+			return nil, errors.New("the stdio transport requires a command")
+		}
+		return newStdioTransport(serverType, config.Command, config.Args, config.Env), nil
+	default:
+		return nil, fmt.Errorf("unknown MCP transport %q (expected one of %s)", config.Transport, strings.Join(Transports, ", "))
+	}
+}
+
+// ValidTransport reports whether name is a known transport ("" selects the default)
+func ValidTransport(name string) bool {
+	if name == "" {
+		return true
+	}
+	for _, t := range Transports {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// streamableHTTPTransport implements the Streamable HTTP transport: every message is
+// POSTed to the server URL and answered with JSON or with an SSE stream. Once the
+// session is initialized, a GET stream receives notifications sent between requests.
+type streamableHTTPTransport struct {
+	url          string
+	httpClient   *resty.Client
+	streamClient *resty.Client // Without a timeout, for the GET stream
+	version      *protocolVersion
+	sessionID    string // Mcp-Session-Id assigned by the server, if any
+	onNotify     notificationHandler
+	onExpired    func(ctx context.Context) error // Initializes a new session after the server dropped ours
+	stopListen   context.CancelFunc              // Ends the GET stream
+	renewing     sync.Mutex                      // Lets one caller re-initialize an expired session
+	mu           sync.Mutex
+}
+
+// post sends a message with the session header and leaves the body unread
+func (t *streamableHTTPTransport) post(ctx context.Context, req rpcRequest) (*resty.Response, error) {
+	r := t.httpClient.R().
+		SetContext(ctx).
+		SetDoNotParseResponse(true).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Accept", "application/json, text/event-stream").
+		SetBody(req)
+	setProtocolVersion(r, t.version)
+	limitRetries(r, req.Method)
+
+	sessionID := t.session()
+	if sessionID != "" {
+		r.SetHeader("Mcp-Session-Id", sessionID)
+	}
+
+	resp, err := r.Post(t.url)
+	if err != nil {
+		return nil, err
+	}
+
+	if assigned := resp.Header().Get("Mcp-Session-Id"); assigned != "" {
+		t.mu.Lock()
+		t.sessionID = assigned
+		t.mu.Unlock()
+	}
+
+	if resp.StatusCode() == 404 && sessionID != "" {
+		resp.RawBody().Close()
+		t.expire(sessionID)
+		return nil, ErrSessionExpired
+	}
+
+	if resp.StatusCode() >= 400 {
+		resp.RawBody().Close()
+		return nil, fmt.Errorf("%s failed with status: %d", req.Method, resp.StatusCode())
+	}
+
+	return resp, nil
+}
+
+// expire forgets a session the server no longer knows and ends its GET stream,
+// so the stream is reopened once a new session is initialized. A session that
+// another request already replaced is left alone.
+func (t *streamableHTTPTransport) expire(sessionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sessionID != sessionID {
+		return
+	}
+	t.sessionID = ""
+	if t.stopListen != nil {
+		t.stopListen()
+		t.stopListen = nil
+	}
+}
+
+// renew initializes a new session with onExpired, unless a concurrent caller
+// already did while this one waited
+func (t *streamableHTTPTransport) renew(ctx context.Context) error {
+	t.renewing.Lock()
+	defer t.renewing.Unlock()
+
+	if t.session() != "" {
+		return nil
+	}
+	if err := t.onExpired(ctx); err != nil {
+		return fmt.Errorf("failed to re-initialize expired MCP session: %w", err)
+	}
+	return nil
+}
+
+func (t *streamableHTTPTransport) send(ctx context.Context, req rpcRequest) (*rpcResponse, error) {
+	resp, err := t.post(ctx, req)
+	// The server rejected the request without running it, so it is safe to send again on a new session
+	if errors.Is(err, ErrSessionExpired) && req.Method != "initialize" && t.onExpired != nil {
+		if err := t.renew(ctx); err != nil {
+			return nil, err
+		}
+		resp, err = t.post(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	body := resp.RawBody()
+	defer body.Close()
+
+	if !strings.HasPrefix(resp.Header().Get("Content-Type"), "text/event-stream") {
+		var response rpcResponse
+		if err := json.NewDecoder(body).Decode(&response); err != nil {
+			return nil, fmt.Errorf("failed to parse %s response: %w", req.Method, err)
+		}
+		return &response, nil
+	}
+
+	// The server streams its reply; skip its own requests and notifications until ours is answered
+	var response *rpcResponse
+	err = readSSE(body, func(ev sseEvent) bool {
+		if ev.Event != "" && ev.Event != "message" {
+			return true
+		}
+		var msg rpcResponse
+		if json.Unmarshal([]byte(ev.Data), &msg) != nil {
+			return true
+		}
+		if msg.isNotification() && t.onNotify != nil {
+			t.onNotify(msg.Method, msg.Params)
+		}
+		if !msg.answers(req) {
+			return true
+		}
+		response = &msg
+		return false
+	})
+	if response != nil {
+		return response, nil
+	}
+	if err == nil {
+		err = errors.New("stream ended without a response")
+	}
+	return nil, fmt.Errorf("failed to read %s response: %w", req.Method, err)
+}
+
+func (t *streamableHTTPTransport) notify(ctx context.Context, req rpcRequest) error {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	if req.Method == "notifications/initialized" {
+		t.listen()
+	}
+
+	return resp.RawBody().Close()
+}
+
+// listen opens the GET stream on which the server may send notifications.
+// Servers without one answer 405, and a dropped stream is not reopened until
+// the session expires and a new one is initialized; the tool list TTL still
+// picks up changes.
+func (t *streamableHTTPTransport) listen() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopListen != nil || t.onNotify == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.stopListen = cancel
+
+	r := t.streamClient.R().
+		SetContext(ctx).
+		SetDoNotParseResponse(true).
+		SetHeader("Accept", "text/event-stream")
+	setProtocolVersion(r, t.version)
+	if t.sessionID != "" {
+		r.SetHeader("Mcp-Session-Id", t.sessionID)
+	}
+
+	go func() {
+		resp, err := r.Get(t.url)
+		if err != nil {
+			return
+		}
+		defer resp.RawBody().Close()
+
+		if resp.StatusCode() != 200 || !strings.HasPrefix(resp.Header().Get("Content-Type"), "text/event-stream") {
+			return
+		}
+
+		readSSE(resp.RawBody(), func(ev sseEvent) bool {
+			var msg rpcResponse
+			if json.Unmarshal([]byte(ev.Data), &msg) == nil && msg.isNotification() {
+				t.onNotify(msg.Method, msg.Params)
+			}
+			return true
+		})
+	}()
+}
+
+// close asks the server to end the session; servers may refuse, which is fine
+func (t *streamableHTTPTransport) close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.sessionID = ""
+	if t.stopListen != nil {
+		t.stopListen()
+		t.stopListen = nil
+	}
+	t.mu.Unlock()
+
+	if sessionID == "" {
+		return nil
+	}
+
+	r := t.httpClient.R().SetHeader("Mcp-Session-Id", sessionID)
+	setProtocolVersion(r, t.version)
+	_, err := r.Delete(t.url)
+	return err
+}
+
+func (t *streamableHTTPTransport) setNotificationHandler(handler notificationHandler) {
+	t.onNotify = handler
+}
+
+func (t *streamableHTTPTransport) session() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID
+}
+
+// setProtocolVersion announces the negotiated protocol version on an HTTP request
+// (required since 2025-06-18). Requests before the first handshake go out without it.
+func setProtocolVersion(r *resty.Request, version *protocolVersion) {
+	if v := version.get(); v != "" {
+		r.SetHeader("MCP-Protocol-Version", v)
+	}
+}
+
+// limitRetries keeps the HTTP client from resending a message after a transport
+// error unless it is safe to repeat: a tool call may have run on the server
+// before the connection failed, and an approved change must not run twice.
+func limitRetries(r *resty.Request, method string) {
+	if !idempotent(method) {
+		r.AddRetryCondition(func(*resty.Response, error) bool { return false })
+	}
+}
+
+// idempotent reports whether a method can be repeated without side effects
+func idempotent(method string) bool {
+	switch method {
+	case "initialize", "ping", "resources/read", "prompts/get":
+		return true
+	}
+	return strings.HasSuffix(method, "/list")
+}
+
+// answers reports whether a message is the response to req
+func (r *rpcResponse) answers(req rpcRequest) bool {
+	if req.ID == nil || (r.Result == nil && r.Error == nil) {
+		return false
+	}
+	return string(bytes.TrimSpace(r.ID)) == strconv.FormatInt(*req.ID, 10)
+}
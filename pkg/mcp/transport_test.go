@@ -0,0 +1,609 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rpcResult builds a JSON-RPC response for a request ID
+func rpcResult(id int64, result interface{}) string {
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": result})
+	return string(body)
+}
+
+// decodeRPC reads the JSON-RPC message in a request body
+func decodeRPC(t *testing.T, r *http.Request) rpcRequest {
+	t.Helper()
+
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		t.Errorf("failed to decode request: %v", err)
+	}
+	return req
+}
+
+func TestReadSSE(t *testing.T) {
+	stream := ": keep-alive\n\n" +
+		"event: endpoint\ndata: /message?sessionId=abc\n\n" +
+		"id: 7\ndata: {\"a\":\ndata: 1}\n\n" +
+		"event: message\ndata:{\"b\":2}\n\n" +
+		"data: never reached\n\n"
+
+	var events []sseEvent
+	err := readSSE(strings.NewReader(stream), func(ev sseEvent) bool {
+		events = append(events, ev)
+		return len(events) < 3
+	})
+	if err != nil {
+		t.Fatalf("readSSE() error = %v", err)
+	}
+
+	want := []sseEvent{
+		{Event: "endpoint", Data: "/message?sessionId=abc"},
+		{ID: "7", Data: "{\"a\":\n1}"},
+		{Event: "message", Data: "{\"b\":2}"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("readSSE() returned %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+}
+
+func TestNewClientWithConfig(t *testing.T) {
+	tests := []struct {
+		transport string
+		wantErr   bool
+	}{
+		{"", false},
+		{TransportStreamableHTTP, false},
+		{TransportSSE, false},
+		{"websocket", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.transport, func(t *testing.T) {
+			_, err := NewClientWithConfig("http://localhost:9300", "alertmanager", ClientConfig{Transport: tt.transport})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClientWithConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ValidTransport(tt.transport) == tt.wantErr {
+				t.Errorf("ValidTransport(%q) = %v", tt.transport, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStreamableHTTPTransport(t *testing.T) {
+	var mu sync.Mutex
+	var sessions, versions []string
+	var streamSession, streamVersion string
+	deleted := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			// Notification stream
+			mu.Lock()
+			streamSession = r.Header.Get("Mcp-Session-Id")
+			streamVersion = r.Header.Get("MCP-Protocol-Version")
+			mu.Unlock()
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/tools/list_changed\"}\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+
+		mu.Lock()
+		sessions = append(sessions, r.Header.Get("Mcp-Session-Id"))
+		versions = append(versions, r.Header.Get("MCP-Protocol-Version"))
+		if r.Method == http.MethodDelete {
+			deleted = true
+		}
+		mu.Unlock()
+
+		if r.Method == http.MethodDelete {
+			return
+		}
+
+		req := decodeRPC(t, r)
+		switch req.Method {
+		case "initialize":
+			w.Header().Set("Mcp-Session-Id", "session-1")
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, rpcResult(*req.ID, map[string]interface{}{
+				"protocolVersion": LatestProtocolVersion,
+				"serverInfo":      map[string]string{"name": "test", "version": "1"},
+			}))
+		case "notifications/initialized":
+			w.WriteHeader(http.StatusAccepted)
+		case "tools/list":
+			// Answer as a stream, with a server notification ahead of the response
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/message\"}\n\n")
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", rpcResult(*req.ID, map[string]interface{}{
+				"tools": []map[string]string{{"name": "get_alerts"}},
+			}))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithConfig(server.URL, "alertmanager", ClientConfig{Transport: TransportStreamableHTTP})
+	if err != nil {
+		t.Fatalf("NewClientWithConfig() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+	client.OnToolsChanged(func() { changed <- struct{}{} })
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	select {
+	case <-changed:
+	case <-ctx.Done():
+		t.Fatal("list_changed on the notification stream was not delivered")
+	}
+
+	tools, err := client.DiscoverTools(ctx)
+	if err != nil {
+		t.Fatalf("DiscoverTools() error = %v", err)
+	}
+	if len(tools) != 1 || tools[0].Name != "alertmanager__get_alerts" {
+		t.Errorf("DiscoverTools() = %+v, want alertmanager__get_alerts", tools)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	want := []string{"", "session-1", "session-1", "session-1"}
+	if strings.Join(sessions, ",") != strings.Join(want, ",") {
+		t.Errorf("Mcp-Session-Id headers = %v, want %v", sessions, want)
+	}
+	if !deleted {
+		t.Error("Close() should delete the session")
+	}
+	if streamSession != "session-1" {
+		t.Errorf("notification stream Mcp-Session-Id = %q, want session-1", streamSession)
+	}
+
+	// Every request after the handshake announces the negotiated version
+	wantVersions := []string{"", LatestProtocolVersion, LatestProtocolVersion, LatestProtocolVersion}
+	if strings.Join(versions, ",") != strings.Join(wantVersions, ",") {
+		t.Errorf("MCP-Protocol-Version headers = %v, want %v", versions, wantVersions)
+	}
+	if streamVersion != LatestProtocolVersion {
+		t.Errorf("notification stream MCP-Protocol-Version = %q, want %s", streamVersion, LatestProtocolVersion)
+	}
+}
+
+func TestReconnectDuringRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		req := decodeRPC(t, r)
+		if req.ID == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, rpcResult(*req.ID, map[string]interface{}{"protocolVersion": LatestProtocolVersion}))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "grafana")
+	ctx := context.Background()
+
+	// Reconnecting renegotiates the version while other requests are sent (run with -race)
+	var wg sync.WaitGroup
+	for n := 0; n < 4; n++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := client.Connect(ctx); err != nil {
+				t.Errorf("Connect() error = %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := client.Health(ctx); err != nil {
+				t.Errorf("Health() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestToolCallsAreNotRetried(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[string]int{}
+
+	// Every request dies with the connection, as after a timeout on the way back
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := decodeRPC(t, r)
+		mu.Lock()
+		attempts[req.Method]++
+		mu.Unlock()
+
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "grafana")
+	client.httpClient.SetRetryWaitTime(time.Millisecond).SetRetryMaxWaitTime(time.Millisecond)
+	ctx := context.Background()
+
+	if _, err := client.InvokeTool(ctx, "create_incident", nil); err == nil {
+		t.Fatal("InvokeTool() should fail when the connection drops")
+	}
+	if err := client.Health(ctx); err == nil {
+		t.Fatal("Health() should fail when the connection drops")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts["tools/call"] != 1 {
+		t.Errorf("tools/call sent %d times, want 1: the tool may have run already", attempts["tools/call"])
+	}
+	if attempts["ping"] != 4 {
+		t.Errorf("ping sent %d times, want 4 (3 retries)", attempts["ping"])
+	}
+}
+
+func TestStreamableHTTPSessionExpired(t *testing.T) {
+	var mu sync.Mutex
+	sessions, expired := 0, false
+	streams := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Method == http.MethodGet {
+			streams <- r.Header.Get("Mcp-Session-Id")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		req := decodeRPC(t, r)
+		switch {
+		case req.Method == "initialize":
+			sessions++
+			w.Header().Set("Mcp-Session-Id", fmt.Sprintf("session-%d", sessions))
+			fmt.Fprint(w, rpcResult(*req.ID, map[string]interface{}{"protocolVersion": LatestProtocolVersion}))
+		case req.ID == nil:
+			w.WriteHeader(http.StatusAccepted)
+		case r.Header.Get("Mcp-Session-Id") == "session-1" && !expired:
+			// The server restarts and forgets the first session
+			expired = true
+			http.NotFound(w, r)
+		case r.Header.Get("Mcp-Session-Id") == "session-1":
+			http.NotFound(w, r)
+		default:
+			fmt.Fprint(w, rpcResult(*req.ID, map[string]interface{}{}))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "grafana")
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	if err := client.Health(context.Background()); err != nil {
+		t.Fatalf("Health() error = %v, want the call to succeed on a new session", err)
+	}
+
+	mu.Lock()
+	if sessions != 2 {
+		t.Errorf("initialize sent %d times, want 2", sessions)
+	}
+	mu.Unlock()
+
+	for _, want := range []string{"session-1", "session-2"} {
+		select {
+		case got := <-streams:
+			if got != want {
+				t.Errorf("GET stream opened for %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("GET stream not opened for %q", want)
+		}
+	}
+}
+
+func TestStreamableHTTPSessionExpiresAgain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		req := decodeRPC(t, r)
+		if req.Method == "initialize" {
+			w.Header().Set("Mcp-Session-Id", "session-1")
+			fmt.Fprint(w, rpcResult(*req.ID, map[string]interface{}{"protocolVersion": LatestProtocolVersion}))
+			return
+		}
+		if req.ID == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "grafana")
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	err := client.Health(context.Background())
+	if !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Health() error = %v, want %v", err, ErrSessionExpired)
+	}
+}
+
+// newSSEServer returns a server speaking the HTTP+SSE transport: the stream at /sse
+// announces /message, and responses to POSTed requests are sent on the stream
+func newSSEServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	messages := make(chan string, 10)
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: endpoint\ndata: /message?sessionId=abc\n\n")
+		w.(http.Flusher).Flush()
+
+		for {
+			select {
+			case msg := <-messages:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+
+	mux.HandleFunc("/message", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sessionId") != "abc" {
+			http.Error(w, "unknown session", http.StatusBadRequest)
+			return
+		}
+
+		req := decodeRPC(t, r)
+		w.WriteHeader(http.StatusAccepted)
+
+		switch req.Method {
+		case "initialize":
+			messages <- rpcResult(*req.ID, map[string]interface{}{
+				"protocolVersion": "2024-11-05",
+				"serverInfo":      map[string]string{"name": "alertmanager-mcp", "version": "1.0.0"},
+			})
+		case "tools/call":
+			messages <- `{"jsonrpc":"2.0","method":"notifications/progress"}`
+			messages <- rpcResult(*req.ID, map[string]interface{}{
+				"content": []map[string]string{{"type": "text", "text": "2 alerts firing"}},
+			})
+		case "ping":
+			messages <- rpcResult(*req.ID, map[string]interface{}{})
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestSSETransport(t *testing.T) {
+	server := newSSEServer(t)
+	defer server.Close()
+
+	for _, url := range []string{server.URL, server.URL + "/sse"} {
+		t.Run(url, func(t *testing.T) {
+			client, err := NewClientWithConfig(url, "alertmanager", ClientConfig{Transport: TransportSSE})
+			if err != nil {
+				t.Fatalf("NewClientWithConfig() error = %v", err)
+			}
+			defer client.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := client.Connect(ctx); err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+			if info := client.ServerInfo(); info.ServerInfo.Name != "alertmanager-mcp" {
+				t.Errorf("ServerInfo() = %+v, want alertmanager-mcp", info)
+			}
+
+			if err := client.Health(ctx); err != nil {
+				t.Errorf("Health() error = %v", err)
+			}
+
+			result, err := client.InvokeTool(ctx, "alertmanager__get_alerts", nil)
+			if err != nil {
+				t.Fatalf("InvokeTool() error = %v", err)
+			}
+			if FormatToolResult(result) != "2 alerts firing" {
+				t.Errorf("InvokeTool() = %v, want 2 alerts firing", result)
+			}
+		})
+	}
+}
+
+func TestSSETransportStreamUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	client, _ := NewClientWithConfig(server.URL, "alertmanager", ClientConfig{Transport: TransportSSE})
+	if err := client.Connect(context.Background()); err == nil {
+		t.Error("Connect() should fail when the SSE stream is unavailable")
+	}
+}
+
+func TestSSETransportEndpointTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	handlers := map[string]http.HandlerFunc{
+		// Headers sent, but no endpoint event
+		"silent stream": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.(http.Flusher).Flush()
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		},
+		// Connection accepted, but no response at all
+		"no response": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		},
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			client, _ := NewClientWithConfig(server.URL, "alertmanager", ClientConfig{Transport: TransportSSE})
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			if err := client.Connect(ctx); err == nil {
+				t.Fatal("Connect() should fail without an endpoint")
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Connect() took %v, want it bounded by the context", elapsed)
+			}
+		})
+	}
+}
+
+func TestSSETransportReconnect(t *testing.T) {
+	var mu sync.Mutex
+	streams := map[string]chan string{} // Session -> messages for its stream
+	initialized := map[string]bool{}
+	drop := make(chan struct{}, 1)
+	sessions := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sessions++
+		session := strconv.Itoa(sessions)
+		messages := make(chan string, 10)
+		streams[session] = messages
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: endpoint\ndata: /message?sessionId=%s\n\n", session)
+		w.(http.Flusher).Flush()
+
+		for {
+			select {
+			case msg := <-messages:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+				w.(http.Flusher).Flush()
+			case <-drop:
+				return
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/message", func(w http.ResponseWriter, r *http.Request) {
+		session := r.URL.Query().Get("sessionId")
+		req := decodeRPC(t, r)
+
+		mu.Lock()
+		defer mu.Unlock()
+		messages, ok := streams[session]
+		if !ok || (req.Method != "initialize" && req.Method != "notifications/initialized" && !initialized[session]) {
+			http.Error(w, "session not initialized", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+
+		switch req.Method {
+		case "initialize":
+			messages <- rpcResult(*req.ID, map[string]interface{}{"protocolVersion": "2024-11-05"})
+		case "notifications/initialized":
+			initialized[session] = true
+		case "ping":
+			messages <- rpcResult(*req.ID, map[string]interface{}{})
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewClientWithConfig(server.URL, "alertmanager", ClientConfig{Transport: TransportSSE})
+	if err != nil {
+		t.Fatalf("NewClientWithConfig() error = %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	// The server ends the stream and with it the session
+	drop <- struct{}{}
+	transport := client.transport.(*sseTransport)
+	for {
+		transport.mu.Lock()
+		ended := transport.stream.ended()
+		transport.mu.Unlock()
+		if ended {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatal("stream did not end")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := client.Health(ctx); err != nil {
+		t.Fatalf("Health() after the stream dropped error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if sessions != 2 || !initialized["2"] {
+		t.Errorf("sessions = %d, initialized = %v; want the new stream initialized", sessions, initialized)
+	}
+}
@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/agent"
+)
+
+// handleApprove approves or rejects a mutating tool call paused in a chat stream
+func (i *Instance) handleApprove(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if req.Method != "POST" {
+		return i.sendError(sender, 405, "Method not allowed")
+	}
+
+	var approveReq ApproveRequest
+	if err := json.Unmarshal(req.Body, &approveReq); err != nil {
+		return i.sendError(sender, 400, fmt.Sprintf("Invalid request body: %v", err))
+	}
+	if approveReq.ApprovalID == "" {
+		return i.sendError(sender, 400, "approval_id is required")
+	}
+
+	user, err := sessionUser(req.PluginContext)
+	if err != nil {
+		return i.sendError(sender, 401, err.Error())
+	}
+
+	err = i.resolveApproval(approveReq.ApprovalID, user, approveReq.Approved)
+	switch {
+	case errors.Is(err, agent.ErrApprovalNotFound):
+		return i.sendError(sender, 404, err.Error())
+	case errors.Is(err, agent.ErrApprovalForbidden):
+		return i.sendError(sender, 403, err.Error())
+	case err != nil:
+		return i.sendError(sender, 500, err.Error())
+	}
+
+	status := "rejected"
+	if approveReq.Approved {
+		status = "approved"
+	}
+	return i.sendJSON(sender, 200, map[string]string{"status": status})
+}
+
+// resolveApproval resolves a pending approval. Approvals not found here may belong
+// to a chat still running on the instance this one replaced.
+func (i *Instance) resolveApproval(approvalID string, user agent.User, approved bool) error {
+	err := i.agentManager.ResolveApproval(approvalID, user, approved)
+	if previous := i.previous.Load(); previous != nil && errors.Is(err, agent.ErrApprovalNotFound) {
+		return previous.resolveApproval(approvalID, user, approved)
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestHandleApprove(t *testing.T) {
+	instance := newSessionTestInstance(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+	}{
+		{"wrong method", "GET", "", 405},
+		{"invalid body", "POST", "{", 400},
+		{"missing approval ID", "POST", `{"approved":true}`, 400},
+		{"unknown approval", "POST", `{"approval_id":"approval-unknown","approved":true}`, 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &recordingSender{}
+			err := instance.handleApprove(context.Background(), &backend.CallResourceRequest{
+				Method: tt.method,
+				Path:   "chat/approve",
+				Body:   []byte(tt.body),
+				PluginContext: backend.PluginContext{
+					User: &backend.User{Login: "alice", Role: "Viewer"},
+				},
+			}, sender)
+			if err != nil {
+				t.Fatalf("handleApprove() error = %v", err)
+			}
+			if got := sender.responses[0].Status; got != tt.wantStatus {
+				t.Errorf("status = %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+}
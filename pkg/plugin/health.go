@@ -0,0 +1,370 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+)
+
+// Health check settings
+const (
+	healthTimeout       = 3 * time.Second  // Bounds each component check
+	healthCacheTTL      = 5 * time.Second  // How long a result is reused for health requests
+	healthProbeInterval = 30 * time.Second // Pause between background probes
+	healthHistorySize   = 120              // Probes kept for health/history (an hour at the default interval)
+)
+
+// healthMonitor caches the last health result and keeps the history of recent
+// checks. The zero value is ready to use.
+type healthMonitor struct {
+	mu          sync.Mutex // Guards the fields below; never held while checking
+	last        *HealthResponse
+	lastSuccess map[string]time.Time // Component -> last passed check
+	history     []HealthProbe
+	running     *healthCheck // Check in progress, shared by everyone asking meanwhile
+	stop        context.CancelFunc
+}
+
+// healthCheck is a health check in progress
+type healthCheck struct {
+	done   chan struct{} // Closed when result is set
+	result *HealthResponse
+}
+
+// CheckHealth runs the same checks as the health resource for Grafana's
+// "Save & test", with per-component results in the JSON details
+func (p *Plugin) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
+	instance, err := p.getInstance(ctx, req.PluginContext)
+	if err != nil {
+		return &backend.CheckHealthResult{
+			Status:  backend.HealthStatusError,
+			Message: err.Error(),
+		}, nil
+	}
+	defer instance.release()
+
+	health := instance.checkHealth(ctx)
+	details, err := json.Marshal(health)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal health details: %w", err)
+	}
+
+	result := &backend.CheckHealthResult{
+		Status:      backend.HealthStatusOk,
+		Message:     healthSummary(health),
+		JSONDetails: details,
+	}
+	if health.Status != HealthHealthy {
+		result.Status = backend.HealthStatusError
+	}
+	return result, nil
+}
+
+// handleHealth returns health status
+func (i *Instance) handleHealth(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	health := i.checkHealth(ctx)
+
+	statusCode := 200
+	if health.Status == HealthUnhealthy {
+		statusCode = 503
+	}
+
+	return i.sendJSON(sender, statusCode, health)
+}
+
+// checkHealth returns the health of the LLM provider and every MCP server,
+// reusing a result younger than healthCacheTTL
+func (i *Instance) checkHealth(ctx context.Context) *HealthResponse {
+	i.health.mu.Lock()
+	last := i.health.last
+	i.health.mu.Unlock()
+
+	if last != nil && time.Since(last.CheckedAt) < healthCacheTTL {
+		return last
+	}
+	return i.probeHealth(ctx)
+}
+
+// probeHealth checks every component and records the result. A check already
+// running is waited for rather than started again.
+func (i *Instance) probeHealth(ctx context.Context) *HealthResponse {
+	i.health.mu.Lock()
+	if running := i.health.running; running != nil {
+		i.health.mu.Unlock()
+		<-running.done
+		return running.result
+	}
+	check := &healthCheck{done: make(chan struct{})}
+	i.health.running = check
+	i.health.mu.Unlock()
+
+	// The result is shared, so one caller giving up must not fail the checks
+	check.result = i.runHealthChecks(context.WithoutCancel(ctx))
+
+	i.health.mu.Lock()
+	i.health.record(check.result)
+	i.health.running = nil
+	i.health.mu.Unlock()
+	close(check.done)
+
+	return check.result
+}
+
+// runHealthChecks checks every component concurrently
+func (i *Instance) runHealthChecks(ctx context.Context) *HealthResponse {
+	health := &HealthResponse{
+		Status:     HealthHealthy,
+		CheckedAt:  time.Now(),
+		MCPServers: make(map[string]MCPServerHealth, len(i.mcpClients)),
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	// Check LLM provider via Grafana LLM App
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		llm := i.checkLLM(ctx)
+		mu.Lock()
+		health.LLMProvider = llm
+		mu.Unlock()
+	}()
+
+	// Check MCP servers
+	for serverType, client := range i.mcpClients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			server := checkMCPServer(ctx, client)
+			mu.Lock()
+			health.MCPServers[serverType] = server
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if !health.LLMProvider.OK {
+		health.Status = HealthUnhealthy
+	}
+
+	// Some servers down is degraded; chat still works with the others' tools
+	serversUp := 0
+	for _, server := range health.MCPServers {
+		if server.OK {
+			serversUp++
+		}
+	}
+	if serversUp == 0 {
+		health.Status = HealthUnhealthy
+	} else if serversUp < len(i.mcpClients) && health.Status == HealthHealthy {
+		health.Status = HealthDegraded
+	}
+
+	// Tool names exposed by several servers only reach one of them
+	health.ToolCollisions = i.agentManager.ToolCollisions()
+
+	return health
+}
+
+// checkLLM checks that the Grafana LLM App has a working provider
+func (i *Instance) checkLLM(ctx context.Context) ComponentHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	start := time.Now()
+	enabled, err := i.llmClient.Enabled(ctx)
+	result := ComponentHealth{LatencyMS: time.Since(start).Milliseconds()}
+
+	switch {
+	case err != nil:
+		result.Error = err.Error()
+	case !enabled:
+		result.Error = "LLM provider not enabled"
+	default:
+		result.OK = true
+	}
+	return result
+}
+
+// checkMCPServer pings an MCP server and counts the tools it offers. A server
+// left to its supervisor or whose circuit is open is down even if it answers,
+// since chat cannot use its tools.
+func checkMCPServer(ctx context.Context, client *mcp.Client) MCPServerHealth {
+	server := MCPServerHealth{Circuit: client.CircuitState()}
+	if !client.Available() {
+		server.Error = "not connected, reconnecting in the background"
+		return server
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := client.Health(ctx)
+	server.LatencyMS = time.Since(start).Milliseconds()
+	switch {
+	case err != nil:
+		server.Error = err.Error()
+		return server
+	case server.Circuit == mcp.CircuitOpen:
+		server.Error = "circuit open after repeated tool call failures"
+		return server
+	}
+
+	server.OK = true
+	if tools, err := client.DiscoverTools(ctx); err == nil {
+		count := len(tools)
+		server.Tools = &count
+	}
+	if info := client.ServerInfo(); info != nil {
+		server.ProtocolVersion = info.ProtocolVersion
+		server.ServerInfo = &info.ServerInfo
+		server.Capabilities = &info.Capabilities
+	}
+	return server
+}
+
+// record stores a health result: it becomes the cached result, sets each
+// component's last success and is appended to the history. Callers hold mu.
+func (h *healthMonitor) record(health *HealthResponse) {
+	if h.lastSuccess == nil {
+		h.lastSuccess = make(map[string]time.Time)
+	}
+	track := func(component string, result *ComponentHealth) {
+		if result.OK {
+			h.lastSuccess[component] = health.CheckedAt
+		}
+		if last, ok := h.lastSuccess[component]; ok {
+			result.LastSuccess = &last
+		}
+	}
+
+	track("llm_provider", &health.LLMProvider)
+	probe := HealthProbe{
+		Time:        health.CheckedAt,
+		Status:      health.Status,
+		LLMProvider: health.LLMProvider,
+		MCPServers:  make(map[string]ComponentHealth, len(health.MCPServers)),
+	}
+	for serverType, server := range health.MCPServers {
+		track("mcp/"+serverType, &server.ComponentHealth)
+		health.MCPServers[serverType] = server
+		probe.MCPServers[serverType] = server.ComponentHealth
+	}
+
+	h.last = health
+	h.history = append(h.history, probe)
+	if len(h.history) > healthHistorySize {
+		h.history = append([]HealthProbe(nil), h.history[len(h.history)-healthHistorySize:]...)
+	}
+}
+
+// startHealthProber checks health in the background every interval until Dispose,
+// keeping the history current even when nobody asks
+func (i *Instance) startHealthProber(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	i.health.mu.Lock()
+	i.health.stop = cancel
+	i.health.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if ctx.Err() == nil {
+				if health := i.probeHealth(ctx); health.Status != HealthHealthy {
+					log.DefaultLogger.Warn("Health probe", "status", health.Status, "summary", healthSummary(health))
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stopProber stops the background prober, if one was started
+func (h *healthMonitor) stopProber() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.stop != nil {
+		h.stop()
+		h.stop = nil
+	}
+}
+
+// handleHealthHistory returns the recent health checks and how often each MCP
+// server went up or down over them
+func (i *Instance) handleHealthHistory(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	i.health.mu.Lock()
+	probes := append([]HealthProbe{}, i.health.history...)
+	i.health.mu.Unlock()
+
+	transitions := make(map[string]int, len(i.mcpClients))
+	for serverType := range i.mcpClients {
+		transitions[serverType] = 0
+	}
+	for n := 1; n < len(probes); n++ {
+		for serverType, server := range probes[n].MCPServers {
+			if previous, ok := probes[n-1].MCPServers[serverType]; ok && previous.OK != server.OK {
+				transitions[serverType]++
+			}
+		}
+	}
+
+	return i.sendJSON(sender, 200, HealthHistoryResponse{
+		IntervalSeconds: int(healthProbeInterval / time.Second),
+		Probes:          probes,
+		MCPTransitions:  transitions,
+	})
+}
+
+// healthSummary describes a health result in one line per failed component
+func healthSummary(health *HealthResponse) string {
+	var problems []string
+	if !health.LLMProvider.OK {
+		problems = append(problems, "LLM provider: "+health.LLMProvider.Error)
+	}
+
+	servers := make([]string, 0, len(health.MCPServers))
+	for serverType := range health.MCPServers {
+		servers = append(servers, serverType)
+	}
+	sort.Strings(servers)
+
+	up := 0
+	for _, serverType := range servers {
+		if server := health.MCPServers[serverType]; server.OK {
+			up++
+		} else {
+			problems = append(problems, fmt.Sprintf("MCP server %s: %s", serverType, server.Error))
+		}
+	}
+
+	summary := fmt.Sprintf("%d of %d MCP servers reachable", up, len(servers))
+	if health.LLMProvider.OK {
+		summary = "LLM provider enabled, " + summary
+	}
+	for _, collision := range health.ToolCollisions {
+		problems = append(problems, fmt.Sprintf("tool %s is exposed by %s", collision.Tool, strings.Join(collision.Servers, ", ")))
+	}
+
+	if len(problems) == 0 {
+		return summary
+	}
+	return summary + "\n" + strings.Join(problems, "\n")
+}
@@ -0,0 +1,191 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/agent"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp/mcptest"
+)
+
+func TestCheckHealth(t *testing.T) {
+	grafana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/plugins/grafana-llm-app/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"details":{"llmProvider":{"ok":true}}}`))
+	}))
+	defer grafana.Close()
+
+	// An MCP server that rejects every request, failing fast unlike an unreachable one
+	unavailable := func(map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("backend unavailable")
+	}
+	down := mcptest.NewServer(t, nil, map[string]mcptest.Handler{"initialize": unavailable, "ping": unavailable})
+
+	checkHealth := func(p *Plugin, settings map[string]interface{}) *backend.CheckHealthResult {
+		t.Helper()
+		jsonData, _ := json.Marshal(settings)
+		result, err := p.CheckHealth(context.Background(), &backend.CheckHealthRequest{
+			PluginContext: backend.PluginContext{OrgID: 1, AppInstanceSettings: &backend.AppInstanceSettings{JSONData: jsonData}},
+		})
+		if err != nil {
+			t.Fatalf("CheckHealth() error = %v", err)
+		}
+		return result
+	}
+
+	p := NewPlugin()
+	defer p.Dispose()
+
+	result := checkHealth(p, map[string]interface{}{"grafana_url": grafana.URL})
+	if result.Status != backend.HealthStatusError || !strings.Contains(result.Message, "invalid settings") {
+		t.Errorf("CheckHealth() with invalid settings = %v %q", result.Status, result.Message)
+	}
+
+	settings := map[string]interface{}{
+		"grafana_url":     grafana.URL,
+		"grafana_api_key": "key",
+		"mcp_servers": []map[string]string{
+			{"name": "grafana", "url": newToolsMCPServer(t, "grafana").URL},
+			{"name": "down", "url": down.URL},
+		},
+	}
+	result = checkHealth(p, settings)
+	if result.Status != backend.HealthStatusError {
+		t.Errorf("CheckHealth() status = %v, want error with a server down", result.Status)
+	}
+	for _, want := range []string{"LLM provider enabled, 1 of 2 MCP servers reachable", "MCP server down: "} {
+		if !strings.Contains(result.Message, want) {
+			t.Errorf("CheckHealth() message = %q, want it to contain %q", result.Message, want)
+		}
+	}
+
+	var details HealthResponse
+	if err := json.Unmarshal(result.JSONDetails, &details); err != nil {
+		t.Fatalf("JSONDetails = %s: %v", result.JSONDetails, err)
+	}
+	if details.Status != HealthDegraded || !details.LLMProvider.OK {
+		t.Errorf("details = %+v, want degraded with the LLM provider up", details)
+	}
+	if grafana := details.MCPServers["grafana"]; !grafana.OK || grafana.Tools == nil || *grafana.Tools != 1 {
+		t.Errorf("grafana server = %+v, want up with 1 tool", grafana)
+	}
+	if down := details.MCPServers["down"]; down.OK || !strings.Contains(down.Error, "reconnecting") || down.Circuit != "closed" {
+		t.Errorf("down server = %+v, want it reported as left to its supervisor", down)
+	}
+
+	settings["mcp_servers"] = []map[string]string{{"name": "grafana", "url": newToolsMCPServer(t, "grafana").URL}}
+	if result := checkHealth(p, settings); result.Status != backend.HealthStatusOk {
+		t.Errorf("CheckHealth() = %v %q, want OK", result.Status, result.Message)
+	}
+}
+
+func TestHealthHistory(t *testing.T) {
+	grafana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"details":{"llmProvider":{"ok":true}}}`))
+	}))
+	defer grafana.Close()
+	llmClient, err := llm.NewLLMClient(grafana.URL, "key")
+	if err != nil {
+		t.Fatalf("NewLLMClient() error = %v", err)
+	}
+
+	// Each server answers pings after a delay; "flaky" fails them while down is set
+	var down atomic.Bool
+	mcpServer := func(name string) *mcp.Client {
+		server := mcptest.NewServer(t, nil, map[string]mcptest.Handler{
+			"ping": func(map[string]interface{}) (interface{}, error) {
+				time.Sleep(200 * time.Millisecond)
+				if name == "flaky" && down.Load() {
+					return nil, errors.New("down")
+				}
+				return map[string]interface{}{}, nil
+			},
+		})
+
+		client := mcp.NewClient(server.URL, name)
+		if err := client.Connect(context.Background()); err != nil {
+			t.Fatalf("Connect() error = %v", err)
+		}
+		return client
+	}
+
+	mcpClients := map[string]*mcp.Client{"grafana": mcpServer("grafana"), "flaky": mcpServer("flaky"), "loki": mcpServer("loki")}
+	manager, err := agent.NewManager(llmClient, mcpClients, []string{"grafana", "flaky", "loki"})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	instance := &Instance{agentManager: manager, llmClient: llmClient, mcpClients: mcpClients}
+
+	// Servers are checked concurrently, so three slow pings take about one ping's time
+	start := time.Now()
+	first := instance.checkHealth(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("checkHealth() took %s, want the servers checked concurrently", elapsed)
+	}
+	if cached := instance.checkHealth(context.Background()); cached != first {
+		t.Error("checkHealth() should reuse a fresh result")
+	}
+	if grafana := first.MCPServers["grafana"]; grafana.LatencyMS < 200 || grafana.LastSuccess == nil {
+		t.Errorf("grafana = %+v, want its latency and last success", grafana)
+	}
+
+	// While a probe runs, another one shares it and the history is served at once
+	down.Store(true)
+	probed := make(chan *HealthResponse, 2)
+	for n := 0; n < 2; n++ {
+		go func() { probed <- instance.probeHealth(context.Background()) }()
+	}
+	time.Sleep(50 * time.Millisecond)
+	start = time.Now()
+	if err := instance.handleHealthHistory(context.Background(), &backend.CallResourceRequest{Path: "health/history"}, &recordingSender{}); err != nil {
+		t.Fatalf("handleHealthHistory() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("handleHealthHistory() waited %s for the running probe", elapsed)
+	}
+	if a, b := <-probed, <-probed; a != b {
+		t.Error("concurrent probes should share one check")
+	}
+
+	down.Store(false)
+	instance.probeHealth(context.Background())
+
+	sender := &recordingSender{}
+	if err := instance.handleHealthHistory(context.Background(), &backend.CallResourceRequest{Path: "health/history"}, sender); err != nil {
+		t.Fatalf("handleHealthHistory() error = %v", err)
+	}
+	var history HealthHistoryResponse
+	if err := json.Unmarshal(sender.responses[0].Body, &history); err != nil {
+		t.Fatalf("invalid history %s: %v", sender.responses[0].Body, err)
+	}
+
+	if len(history.Probes) != 3 {
+		t.Fatalf("history has %d probes, want 3", len(history.Probes))
+	}
+	if status := history.Probes[1].Status; status != HealthDegraded {
+		t.Errorf("second probe status = %s, want degraded", status)
+	}
+	if flaky := history.Probes[1].MCPServers["flaky"]; flaky.OK || flaky.LastSuccess == nil {
+		t.Errorf("flaky while down = %+v, want an error and its last success", flaky)
+	}
+	want := map[string]int{"grafana": 0, "flaky": 2, "loki": 0}
+	for server, n := range want {
+		if history.MCPTransitions[server] != n {
+			t.Errorf("mcp_transitions = %v, want %v", history.MCPTransitions, want)
+			break
+		}
+	}
+}
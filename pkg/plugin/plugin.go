@@ -2,9 +2,15 @@ package plugin
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -17,12 +23,26 @@ import (
 // Make sure Plugin implements required interfaces
 var (
 	_ backend.CallResourceHandler = (*Plugin)(nil)
+	_ backend.CheckHealthHandler  = (*Plugin)(nil)
 )
 
+// mcpConnectTimeout bounds the initial connection to each MCP server while an
+// instance is created; servers that miss it are connected by their supervisor
+const mcpConnectTimeout = 5 * time.Second
+
 // Plugin is the main plugin struct that manages instances
 type Plugin struct {
 	mu        sync.RWMutex
 	instances map[int64]*Instance
+	builds    map[int64]*instanceBuild // Instances being created, by org
+}
+
+// instanceBuild is an instance being created. Requests for the same settings wait
+// for it instead of creating their own.
+type instanceBuild struct {
+	version string
+	done    chan struct{} // Closed when the build finished
+	err     error
 }
 
 // Instance represents a plugin instance for a specific data source
@@ -31,12 +51,18 @@ type Instance struct {
 	llmClient    *llm.LLMClient
 	mcpClients   map[string]*mcp.Client
 	settings     *PluginSettings
+	sessionStore agent.SessionStore
+	version      string                   // Fingerprint of the settings the instance was built from
+	requests     sync.WaitGroup           // Requests running on the instance
+	previous     atomic.Pointer[Instance] // Replaced instance still finishing its requests
+	health       healthMonitor
 }
 
 // NewPlugin creates a new Plugin
 func NewPlugin() *Plugin {
 	return &Plugin{
 		instances: make(map[int64]*Instance),
+		builds:    make(map[int64]*instanceBuild),
 	}
 }
 
@@ -49,6 +75,7 @@ func (p *Plugin) CallResource(ctx context.Context, req *backend.CallResourceRequ
 	if err != nil {
 		return p.sendError(sender, 500, fmt.Sprintf("Failed to get plugin instance: %v", err))
 	}
+	defer instance.release()
 
 	// Route to appropriate handler
 	switch req.Path {
@@ -56,61 +83,163 @@ func (p *Plugin) CallResource(ctx context.Context, req *backend.CallResourceRequ
 		return instance.handleChat(ctx, req, sender)
 	case "chat-stream":
 		return instance.handleChatStream(ctx, req, sender)
+	case "chat/approve":
+		return instance.handleApprove(ctx, req, sender)
 	case "health":
 		return instance.handleHealth(ctx, req, sender)
+	case "health/history":
+		return instance.handleHealthHistory(ctx, req, sender)
+	case "sessions":
+		return instance.handleListSessions(ctx, req, sender)
+	case "prompts":
+		return instance.handleListPrompts(ctx, req, sender)
 	default:
+		if strings.HasPrefix(req.Path, "sessions/") {
+			return instance.handleSession(ctx, req, sender)
+		}
+		if strings.HasPrefix(req.Path, "prompts/") {
+			return instance.handleGetPrompt(ctx, req, sender)
+		}
 		return p.sendError(sender, 404, "Not found")
 	}
 }
 
-// getInstance gets or creates an instance for the given plugin context
+// getInstance gets or creates an instance for the given plugin context. An instance
+// whose settings changed is replaced; the old one is disposed once the requests
+// running on it have finished. Instances are created outside the plugin lock, so
+// an org whose MCP servers are slow to answer does not hold up the others.
+// Callers must release the instance when done.
 func (p *Plugin) getInstance(ctx context.Context, pluginCtx backend.PluginContext) (*Instance, error) {
 	// Use OrgID as the instance key since this is a panel plugin
 	instanceID := pluginCtx.OrgID
+	version := settingsVersion(pluginCtx)
+
+	for {
+		// Check if an up-to-date instance already exists
+		p.mu.RLock()
+		instance, exists := p.instances[instanceID]
+		if exists && instance.version == version {
+			instance.requests.Add(1)
+			p.mu.RUnlock()
+			return instance, nil
+		}
+		p.mu.RUnlock()
+
+		p.mu.Lock()
+		// Double-check after acquiring write lock
+		previous, exists := p.instances[instanceID]
+		if exists && previous.version == version {
+			previous.requests.Add(1)
+			p.mu.Unlock()
+			return previous, nil
+		}
 
-	// Check if instance already exists
-	p.mu.RLock()
-	instance, exists := p.instances[instanceID]
-	p.mu.RUnlock()
+		// Wait for an instance already being created for this org
+		if build := p.builds[instanceID]; build != nil {
+			p.mu.Unlock()
+			select {
+			case <-build.done:
+				if build.err != nil && build.version == version {
+					return nil, build.err
+				}
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		build := &instanceBuild{version: version, done: make(chan struct{})}
+		p.builds[instanceID] = build
+		p.mu.Unlock()
 
-	if exists {
-		return instance, nil
+		return p.buildInstance(ctx, pluginCtx, build, previous)
 	}
+}
 
-	// Create new instance
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// buildInstance creates the instance for a build and installs it in place of
+// previous, which is retired. The instance is returned with a request registered.
+func (p *Plugin) buildInstance(ctx context.Context, pluginCtx backend.PluginContext, build *instanceBuild, previous *Instance) (*Instance, error) {
+	instanceID := pluginCtx.OrgID
+	if previous != nil {
+		log.DefaultLogger.Info("Plugin settings changed, rebuilding instance", "org_id", instanceID)
+	}
+
+	// The build is shared, so one request giving up must not fail it
+	instance, err := p.createInstance(context.WithoutCancel(ctx), pluginCtx, previous)
 
-	// Double-check after acquiring write lock
-	if instance, exists = p.instances[instanceID]; exists {
-		return instance, nil
+	p.mu.Lock()
+	delete(p.builds, instanceID)
+	if err == nil {
+		instance.version = build.version
+		p.instances[instanceID] = instance
+		if previous != nil {
+			instance.previous.Store(previous)
+			go instance.retire(previous)
+		}
+		instance.requests.Add(1)
 	}
+	build.err = err
+	p.mu.Unlock()
+	close(build.done)
 
-	// Create new instance
-	instance, err := p.createInstance(ctx, pluginCtx)
 	if err != nil {
 		return nil, err
 	}
-
-	p.instances[instanceID] = instance
 	return instance, nil
 }
 
-// createInstance creates a new plugin instance
-func (p *Plugin) createInstance(ctx context.Context, pluginCtx backend.PluginContext) (*Instance, error) {
-	log.DefaultLogger.Info("Creating new plugin instance", "org_id", pluginCtx.OrgID)
+// release marks a request obtained from getInstance as finished
+func (i *Instance) release() {
+	i.requests.Done()
+}
 
-	// Get settings from AppInstanceSettings if available, otherwise use DataSourceInstanceSettings
-	var jsonData []byte
-	var decryptedSecrets map[string]string
+// retire disposes a replaced instance once its requests have finished
+func (i *Instance) retire(previous *Instance) {
+	previous.requests.Wait()
+	previous.Dispose()
+	i.previous.CompareAndSwap(previous, nil)
+	log.DefaultLogger.Info("Disposed replaced plugin instance")
+}
 
+// instanceSettings returns the JSON and decrypted secure data of the app, or of
+// the data source if the plugin runs as one
+func instanceSettings(pluginCtx backend.PluginContext) ([]byte, map[string]string) {
 	if pluginCtx.AppInstanceSettings != nil {
-		jsonData = pluginCtx.AppInstanceSettings.JSONData
-		decryptedSecrets = pluginCtx.AppInstanceSettings.DecryptedSecureJSONData
-	} else if pluginCtx.DataSourceInstanceSettings != nil {
-		jsonData = pluginCtx.DataSourceInstanceSettings.JSONData
-		decryptedSecrets = pluginCtx.DataSourceInstanceSettings.DecryptedSecureJSONData
+		return pluginCtx.AppInstanceSettings.JSONData, pluginCtx.AppInstanceSettings.DecryptedSecureJSONData
+	}
+	if pluginCtx.DataSourceInstanceSettings != nil {
+		return pluginCtx.DataSourceInstanceSettings.JSONData, pluginCtx.DataSourceInstanceSettings.DecryptedSecureJSONData
 	}
+	return nil, nil
+}
+
+// settingsVersion fingerprints the settings an instance is built from, so any
+// change to the JSON or secure data is noticed on the next request
+func settingsVersion(pluginCtx backend.PluginContext) string {
+	jsonData, secrets := instanceSettings(pluginCtx)
+
+	keys := make([]string, 0, len(secrets))
+	for key := range secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	hash.Write(jsonData)
+	for _, key := range keys {
+		fmt.Fprintf(hash, "\x00%s\x00%s", key, secrets[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// createInstance creates a new plugin instance. An in-memory session store is
+// taken over from the instance being replaced, so conversations survive a
+// settings change.
+func (p *Plugin) createInstance(ctx context.Context, pluginCtx backend.PluginContext, previous *Instance) (*Instance, error) {
+	log.DefaultLogger.Info("Creating new plugin instance", "org_id", pluginCtx.OrgID)
+
+	// Get settings from AppInstanceSettings if available, otherwise use DataSourceInstanceSettings
+	jsonData, decryptedSecrets := instanceSettings(pluginCtx)
 
 	// Parse plugin settings
 	pluginSettings, err := LoadSettings(jsonData)
@@ -141,109 +270,146 @@ func (p *Plugin) createInstance(ctx context.Context, pluginCtx backend.PluginCon
 		return nil, fmt.Errorf("failed to create LLM client: %w", err)
 	}
 
-	// Connect to MCP servers
+	// Create the MCP clients; they are connected below
 	mcpClients := make(map[string]*mcp.Client)
 	mcpTypes := []string{}
+	serverPrompts := make(map[string]string)
 
-	for serverType, url := range pluginSettings.GetMCPServers() {
-		log.DefaultLogger.Info("Connecting to MCP server", "type", serverType, "url", url)
+	for _, server := range pluginSettings.GetMCPServers() {
+		serverType := server.Name
+		clientConfig := pluginSettings.GetMCPClientConfig(server, decryptedSecrets)
+		log.DefaultLogger.Info("Connecting to MCP server", "type", serverType, "url", server.URL, "transport", clientConfig.Transport)
 
-		client := mcp.NewClient(url, serverType)
-		if err := client.Connect(ctx); err != nil {
-			log.DefaultLogger.Warn("Failed to connect to MCP server", "type", serverType, "error", err)
-			continue
-		}
-
-		// Discover tools
-		tools, err := client.DiscoverTools(ctx)
+		client, err := mcp.NewClientWithConfig(server.URL, serverType, clientConfig)
 		if err != nil {
-			log.DefaultLogger.Warn("Failed to discover tools", "type", serverType, "error", err)
+			log.DefaultLogger.Warn("Failed to create MCP client", "type", serverType, "error", err)
 			continue
 		}
 
-		log.DefaultLogger.Info("Discovered tools", "type", serverType, "count", len(tools))
 		mcpClients[serverType] = client
 		mcpTypes = append(mcpTypes, serverType)
+		if server.Prompt != "" {
+			serverPrompts[serverType] = server.Prompt
+		}
 	}
 
 	if len(mcpClients) == 0 {
-		return nil, fmt.Errorf("failed to connect to any MCP servers")
+		return nil, fmt.Errorf("no usable MCP server configuration")
+	}
+
+	connectMCPClients(ctx, mcpClients)
+
+	// Open session store. A rebuild takes over the replaced instance's store when it
+	// holds the same sessions, so the two never write the same files through
+	// separate stores while the old one drains.
+	var sessionStore agent.SessionStore
+	if previous != nil && sameSessionStore(previous.settings, pluginSettings) {
+		sessionStore = previous.sessionStore
+	} else if sessionStore, err = newSessionStore(pluginSettings, pluginCtx.OrgID); err != nil {
+		closeMCPClients(mcpClients)
+		return nil, fmt.Errorf("failed to open session store: %w", err)
 	}
 
 	// Initialize agent manager
 	log.DefaultLogger.Info("Initializing agent manager", "mcp_types", mcpTypes)
-	agentManager, err := agent.NewManager(llmClient, mcpClients, mcpTypes)
+	agentManager, err := agent.NewManagerWithConfig(llmClient, mcpClients, mcpTypes, agent.ManagerConfig{
+		MaxToolIterations: pluginSettings.MaxToolIterations,
+		SessionStore:      sessionStore,
+		ContextWindow:     pluginSettings.ContextWindow,
+		ContextBudget:     pluginSettings.ContextBudget,
+		SummarizeHistory:  pluginSettings.SummarizeHistory,
+		ToolAccess:        pluginSettings.GetToolAccess(),
+		ToolPolicy:        pluginSettings.ToolPolicy,
+		ServerPrompts:     serverPrompts,
+	})
 	if err != nil {
+		closeMCPClients(mcpClients)
 		return nil, fmt.Errorf("failed to create agent manager: %w", err)
 	}
 
-	return &Instance{
+	instance := &Instance{
 		agentManager: agentManager,
 		llmClient:    llmClient,
 		mcpClients:   mcpClients,
 		settings:     pluginSettings,
-	}, nil
+		sessionStore: sessionStore,
+	}
+	instance.startHealthProber(healthProbeInterval)
+	return instance, nil
 }
 
-// handleHealth returns health status
-func (i *Instance) handleHealth(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
-	const healthTimeout = 3 * time.Second
+// Dispose releases every instance, stopping MCP server processes started by the plugin
+func (p *Plugin) Dispose() {
+	p.mu.Lock()
+	instances := p.instances
+	p.instances = make(map[int64]*Instance)
+	p.mu.Unlock()
 
-	overallStatus := "healthy"
-	response := map[string]interface{}{
-		"status":      "healthy",
-		"mcp_servers": map[string]map[string]interface{}{},
+	for _, instance := range instances {
+		instance.Dispose()
 	}
+}
 
-	// Check LLM provider via Grafana LLM App
-	llmHealthCtx, llmCancel := context.WithTimeout(ctx, healthTimeout)
-	llmEnabled, llmErr := i.llmClient.Enabled(llmHealthCtx)
-	llmCancel()
+// Dispose stops the health prober and closes the instance's MCP sessions
+func (i *Instance) Dispose() {
+	i.health.stopProber()
+	closeMCPClients(i.mcpClients)
+}
 
-	if llmErr != nil || !llmEnabled {
-		overallStatus = "unhealthy"
-		errMsg := "LLM provider not enabled"
-		if llmErr != nil {
-			errMsg = llmErr.Error()
-		}
-		response["llm_provider"] = map[string]interface{}{
-			"ok":    false,
-			"error": errMsg,
-		}
-	} else {
-		response["llm_provider"] = map[string]interface{}{
-			"ok": true,
-		}
-	}
+// connectMCPClients connects to the MCP servers concurrently, each within
+// mcpConnectTimeout, and starts their supervisors. Servers that cannot be reached
+// now are reconnected in the background; their tools appear once they are up.
+func connectMCPClients(ctx context.Context, clients map[string]*mcp.Client) {
+	var wg sync.WaitGroup
+	for serverType, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, mcpConnectTimeout)
+			defer cancel()
+
+			if err := client.Connect(ctx); err != nil {
+				log.DefaultLogger.Warn("Failed to connect to MCP server, retrying in the background", "type", serverType, "error", err)
+			} else if tools, err := client.DiscoverTools(ctx); err != nil {
+				log.DefaultLogger.Warn("Failed to discover tools", "type", serverType, "error", err)
+			} else {
+				log.DefaultLogger.Info("Discovered tools", "type", serverType, "count", len(tools))
+			}
 
-	// Check MCP servers
-	servers := response["mcp_servers"].(map[string]map[string]interface{})
-	for serverType, client := range i.mcpClients {
-		healthCtx, cancel := context.WithTimeout(ctx, healthTimeout)
-		err := client.Health(healthCtx)
-		cancel()
+			client.Supervise(mcp.DefaultHealthInterval)
+		}()
+	}
+	wg.Wait()
+}
 
-		if err != nil {
-			overallStatus = "unhealthy"
-			servers[serverType] = map[string]interface{}{
-				"ok":    false,
-				"error": err.Error(),
-			}
-			continue
+// closeMCPClients closes MCP clients, logging failures
+func closeMCPClients(clients map[string]*mcp.Client) {
+	for serverType, client := range clients {
+		if err := client.Close(); err != nil {
+			log.DefaultLogger.Warn("Failed to close MCP client", "type", serverType, "error", err)
 		}
+	}
+}
 
-		servers[serverType] = map[string]interface{}{
-			"ok": true,
-		}
+// sameSessionStore reports whether two settings keep sessions in the same place
+func sameSessionStore(a, b *PluginSettings) bool {
+	if a.SessionStore != SessionStoreFile || b.SessionStore != SessionStoreFile {
+		return a.SessionStore != SessionStoreFile && b.SessionStore != SessionStoreFile
 	}
+	return a.GetSessionStorePath() == b.GetSessionStorePath()
+}
 
-	response["status"] = overallStatus
-	statusCode := 200
-	if overallStatus != "healthy" {
-		statusCode = 503
+// newSessionStore creates the session store configured in settings.
+// File stores keep each org's sessions in their own directory.
+func newSessionStore(settings *PluginSettings, orgID int64) (agent.SessionStore, error) {
+	if settings.SessionStore != SessionStoreFile {
+		return agent.NewInMemorySessionStore(), nil
 	}
 
-	return i.sendJSON(sender, statusCode, response)
+	dir := filepath.Join(settings.GetSessionStorePath(), fmt.Sprintf("org-%d", orgID))
+	log.DefaultLogger.Info("Using file session store", "dir", dir)
+	return agent.NewFileSessionStore(dir)
 }
 
 // sendJSON sends a JSON response
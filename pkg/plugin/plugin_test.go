@@ -0,0 +1,180 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestGetInstanceRebuildsOnSettingsChange(t *testing.T) {
+	server := newToolsMCPServer(t, "grafana")
+
+	pluginCtx := func(apiKey string) backend.PluginContext {
+		jsonData, _ := json.Marshal(map[string]interface{}{
+			"grafana_url":     "http://grafana:3000",
+			"grafana_api_key": "from-secrets",
+			"mcp_servers":     []map[string]string{{"name": "grafana", "url": server.URL}},
+		})
+		return backend.PluginContext{OrgID: 1, AppInstanceSettings: &backend.AppInstanceSettings{
+			JSONData:                jsonData,
+			DecryptedSecureJSONData: map[string]string{"grafana_api_key": apiKey},
+		}}
+	}
+
+	p := NewPlugin()
+	defer p.Dispose()
+	ctx := context.Background()
+
+	first, err := p.getInstance(ctx, pluginCtx("key-1"))
+	if err != nil {
+		t.Fatalf("getInstance() error = %v", err)
+	}
+	same, err := p.getInstance(ctx, pluginCtx("key-1"))
+	if err != nil || same != first {
+		t.Fatalf("getInstance() with unchanged settings = %p, %v; want the cached instance", same, err)
+	}
+	same.release()
+
+	// A new API key rebuilds the instance; the old one keeps serving its request
+	second, err := p.getInstance(ctx, pluginCtx("key-2"))
+	if err != nil {
+		t.Fatalf("getInstance() error = %v", err)
+	}
+	defer second.release()
+	if second == first {
+		t.Fatal("getInstance() returned the old instance after the settings changed")
+	}
+	if second.sessionStore != first.sessionStore {
+		t.Error("rebuilt instance should keep the in-memory session store")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if n := server.ClosedSessions(); n != 0 {
+		t.Fatalf("old instance closed %d MCP sessions while a request was running", n)
+	}
+	if second.previous.Load() != first {
+		t.Error("rebuilt instance should reach the old one while it drains")
+	}
+
+	first.release()
+	deadline := time.Now().Add(2 * time.Second)
+	for server.ClosedSessions() == 0 || second.previous.Load() != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("old instance not disposed after its request finished (closed sessions = %d)", server.ClosedSessions())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGetInstanceKeepsFileSessionStore(t *testing.T) {
+	server := newToolsMCPServer(t, "grafana")
+	dir := t.TempDir()
+
+	pluginCtx := func(apiKey, path string) backend.PluginContext {
+		jsonData, _ := json.Marshal(map[string]interface{}{
+			"grafana_url":        "http://grafana:3000",
+			"grafana_api_key":    "from-secrets",
+			"mcp_servers":        []map[string]string{{"name": "grafana", "url": server.URL}},
+			"session_store":      SessionStoreFile,
+			"session_store_path": path,
+		})
+		return backend.PluginContext{OrgID: 1, AppInstanceSettings: &backend.AppInstanceSettings{
+			JSONData:                jsonData,
+			DecryptedSecureJSONData: map[string]string{"grafana_api_key": apiKey},
+		}}
+	}
+
+	p := NewPlugin()
+	defer p.Dispose()
+	ctx := context.Background()
+
+	instances := make([]*Instance, 0, 3)
+	for _, settings := range []backend.PluginContext{
+		pluginCtx("key-1", dir),
+		pluginCtx("key-2", dir),                         // Same directory: the store is handed over
+		pluginCtx("key-2", filepath.Join(dir, "moved")), // New directory: a store of its own
+	} {
+		instance, err := p.getInstance(ctx, settings)
+		if err != nil {
+			t.Fatalf("getInstance() error = %v", err)
+		}
+		instance.release()
+		instances = append(instances, instance)
+	}
+
+	if instances[1].sessionStore != instances[0].sessionStore {
+		t.Error("rebuilt instance opened a second store on the same directory")
+	}
+	if instances[2].sessionStore == instances[1].sessionStore {
+		t.Error("rebuilt instance kept the store of the old directory")
+	}
+}
+
+func TestGetInstanceDoesNotBlockOnUnreachableServers(t *testing.T) {
+	// Accepts connections but does not answer until released
+	release := make(chan struct{})
+	blackhole := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer blackhole.Close()
+
+	healthy := newToolsMCPServer(t, "grafana")
+
+	pluginCtx := func(orgID int64, url string) backend.PluginContext {
+		jsonData, _ := json.Marshal(map[string]interface{}{
+			"grafana_url":     "http://grafana:3000",
+			"grafana_api_key": "key",
+			"mcp_servers":     []map[string]string{{"name": "grafana", "url": url}},
+		})
+		return backend.PluginContext{OrgID: orgID, AppInstanceSettings: &backend.AppInstanceSettings{JSONData: jsonData}}
+	}
+
+	p := NewPlugin()
+	defer p.Dispose()
+	ctx := context.Background()
+
+	// Two requests for the org behind the unreachable server share one build
+	blocked := make(chan *Instance, 2)
+	for n := 0; n < 2; n++ {
+		go func() {
+			instance, err := p.getInstance(ctx, pluginCtx(1, blackhole.URL))
+			if err != nil {
+				t.Errorf("getInstance() error = %v", err)
+			}
+			blocked <- instance
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Another org is served while the first is still connecting
+	instance, err := p.getInstance(ctx, pluginCtx(2, healthy.URL))
+	if err != nil {
+		t.Fatalf("getInstance() error = %v", err)
+	}
+	instance.release()
+	select {
+	case <-blocked:
+		t.Fatal("org 1 instance built before its MCP server answered")
+	default:
+	}
+
+	close(release)
+	first, second := <-blocked, <-blocked
+	if first == nil || first != second {
+		t.Fatalf("concurrent getInstance() calls returned %p and %p, want one shared instance", first, second)
+	}
+	first.release()
+	second.release()
+	if first.mcpClients["grafana"].Available() {
+		t.Error("a server that failed to connect should be left to its supervisor")
+	}
+}
@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+)
+
+// promptsTimeout bounds how long listing prompts waits for each MCP server
+const promptsTimeout = 3 * time.Second
+
+// PromptInfo is a starter prompt published by an MCP server
+type PromptInfo struct {
+	Server string `json:"server"`
+	mcp.Prompt
+}
+
+// GetPromptRequest holds the argument values for rendering a prompt
+type GetPromptRequest struct {
+	Arguments map[string]string `json:"arguments"`
+}
+
+// GetPromptResponse is a rendered prompt; Text is ready to use as a chat message
+type GetPromptResponse struct {
+	Description string              `json:"description,omitempty"`
+	Messages    []mcp.PromptMessage `json:"messages"`
+	Text        string              `json:"text"`
+}
+
+// handleListPrompts lists the prompts of every MCP server that publishes them (GET prompts).
+// Servers are asked concurrently; one that is down or slow is reported in errors
+// and the others' prompts are still returned.
+func (i *Instance) handleListPrompts(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if req.Method != "GET" {
+		return i.sendError(sender, 405, "Method not allowed")
+	}
+
+	prompts := []PromptInfo{}
+	errs := make(map[string]string)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for serverType, client := range i.mcpClients {
+		if !client.SupportsPrompts() {
+			continue
+		}
+		if !client.Available() {
+			mu.Lock()
+			errs[serverType] = "not connected, reconnecting in the background"
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, promptsTimeout)
+			defer cancel()
+
+			serverPrompts, err := client.ListPrompts(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.DefaultLogger.Warn("Failed to list MCP prompts", "type", serverType, "error", err)
+				errs[serverType] = err.Error()
+				return
+			}
+			for _, p := range serverPrompts {
+				prompts = append(prompts, PromptInfo{Server: serverType, Prompt: p})
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(prompts, func(a, b int) bool {
+		if prompts[a].Server != prompts[b].Server {
+			return prompts[a].Server < prompts[b].Server
+		}
+		return prompts[a].Name < prompts[b].Name
+	})
+
+	response := map[string]interface{}{
+		"prompts": prompts,
+	}
+	if len(errs) > 0 {
+		response["errors"] = errs
+	}
+	return i.sendJSON(sender, 200, response)
+}
+
+// handleGetPrompt renders a prompt (POST prompts/{server}/{name} with {"arguments": {...}})
+func (i *Instance) handleGetPrompt(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if req.Method != "POST" {
+		return i.sendError(sender, 405, "Method not allowed")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(req.Path, "prompts/"), "/")
+	if len(parts) != 2 {
+		return i.sendError(sender, 404, "Not found")
+	}
+	name, err := url.PathUnescape(parts[1])
+	if err != nil || name == "" {
+		return i.sendError(sender, 404, "Not found")
+	}
+
+	client, ok := i.mcpClients[parts[0]]
+	if !ok || !client.SupportsPrompts() {
+		return i.sendError(sender, 404, fmt.Sprintf("MCP server %s does not publish prompts", parts[0]))
+	}
+
+	var getReq GetPromptRequest
+	if len(req.Body) > 0 {
+		if err := json.Unmarshal(req.Body, &getReq); err != nil {
+			return i.sendError(sender, 400, fmt.Sprintf("Invalid request body: %v", err))
+		}
+	}
+
+	result, err := client.GetPrompt(ctx, name, getReq.Arguments)
+	var rpcErr *mcp.RPCError
+	if errors.As(err, &rpcErr) {
+		// The server rejected the prompt name or its arguments
+		return i.sendError(sender, 400, rpcErr.Message)
+	}
+	if err != nil {
+		log.DefaultLogger.Error("Failed to get MCP prompt", "type", parts[0], "prompt", name, "error", err)
+		return i.sendError(sender, 502, err.Error())
+	}
+
+	var text []string
+	for _, msg := range result.Messages {
+		switch {
+		case msg.Content.Type == mcp.ContentText:
+			text = append(text, msg.Content.Text)
+		case msg.Content.Type == mcp.ContentResource && msg.Content.Resource != nil && msg.Content.Resource.Text != "":
+			text = append(text, msg.Content.Resource.Text)
+		}
+	}
+
+	return i.sendJSON(sender, 200, GetPromptResponse{
+		Description: result.Description,
+		Messages:    result.Messages,
+		Text:        strings.Join(text, "\n\n"),
+	})
+}
+
+// readResource runs the read_resource tool. Without a server argument the resource is
+// read from the only server it may read from, or else from the first that has it.
+func (i *Instance) readResource(ctx context.Context, args map[string]interface{}) (*mcp.ToolResult, error) {
+	uri, _ := args["uri"].(string)
+	if uri == "" {
+		return nil, fmt.Errorf("uri is required")
+	}
+
+	// Only the servers offered in the tool, which the tool policy allows it on
+	servers := i.agentManager.ResourceServers()
+
+	if server, _ := args["server"].(string); server != "" {
+		index := sort.SearchStrings(servers, server)
+		if index == len(servers) || servers[index] != server {
+			return nil, fmt.Errorf("MCP server %s does not publish resources", server)
+		}
+		contents, err := i.mcpClients[server].ReadResource(ctx, uri)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.ResourceResult(contents), nil
+	}
+
+	var lastErr error = fmt.Errorf("no MCP server publishes resources")
+	for _, server := range servers {
+		contents, err := i.mcpClients[server].ReadResource(ctx, uri)
+		if err == nil {
+			return mcp.ResourceResult(contents), nil
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
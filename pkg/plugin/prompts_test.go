@@ -0,0 +1,205 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/agent"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp/mcptest"
+)
+
+// newPromptsMCPClient connects to a fake MCP server publishing one prompt and one resource
+func newPromptsMCPClient(t *testing.T) *mcp.Client {
+	t.Helper()
+
+	server := mcptest.NewServer(t, map[string]interface{}{
+		"prompts":   map[string]interface{}{},
+		"resources": map[string]interface{}{},
+	}, map[string]mcptest.Handler{
+		"prompts/list": mcptest.Result(map[string]interface{}{"prompts": []mcp.Prompt{
+			{Name: "queue_health", Title: "Queue health", Arguments: []mcp.PromptArgument{{Name: "queue", Required: true}}},
+		}}),
+		"prompts/get": func(params map[string]interface{}) (interface{}, error) {
+			args, _ := params["arguments"].(map[string]interface{})
+			if params["name"] != "queue_health" || args["queue"] == nil {
+				return nil, &mcptest.Error{Code: -32602, Message: "missing argument queue"}
+			}
+			return mcp.PromptResult{Messages: []mcp.PromptMessage{
+				{Role: "user", Content: mcp.Content{Type: mcp.ContentText, Text: "How healthy is the " + args["queue"].(string) + " queue?"}},
+				{Role: "user", Content: mcp.Content{Type: mcp.ContentResource, Resource: &mcp.ResourceContents{URI: "runbook://queues", Text: "Check wait times first."}}},
+			}}, nil
+		},
+		"resources/read": func(params map[string]interface{}) (interface{}, error) {
+			return map[string]interface{}{"contents": []mcp.ResourceContents{
+				{URI: params["uri"].(string), Text: "Check wait times first."},
+			}}, nil
+		},
+	})
+
+	client := mcp.NewClient(server.URL, "genesys")
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	return client
+}
+
+func callPromptResource(t *testing.T, instance *Instance, method, path, body string) *backend.CallResourceResponse {
+	t.Helper()
+
+	req := &backend.CallResourceRequest{Method: method, Path: path, Body: []byte(body)}
+	sender := &recordingSender{}
+
+	var err error
+	if path == "prompts" {
+		err = instance.handleListPrompts(context.Background(), req, sender)
+	} else {
+		err = instance.handleGetPrompt(context.Background(), req, sender)
+	}
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, path, err)
+	}
+	return sender.responses[0]
+}
+
+func TestPromptResources(t *testing.T) {
+	instance := &Instance{mcpClients: map[string]*mcp.Client{"genesys": newPromptsMCPClient(t)}}
+
+	resp := callPromptResource(t, instance, "GET", "prompts", "")
+	var list struct {
+		Prompts []PromptInfo `json:"prompts"`
+	}
+	json.Unmarshal(resp.Body, &list)
+	if resp.Status != 200 || len(list.Prompts) != 1 || list.Prompts[0].Server != "genesys" || list.Prompts[0].Name != "queue_health" || list.Prompts[0].Title != "Queue health" {
+		t.Errorf("GET prompts = %d %s", resp.Status, resp.Body)
+	}
+
+	resp = callPromptResource(t, instance, "POST", "prompts/genesys/queue_health", `{"arguments":{"queue":"Support"}}`)
+	var prompt GetPromptResponse
+	json.Unmarshal(resp.Body, &prompt)
+	if resp.Status != 200 || prompt.Text != "How healthy is the Support queue?\n\nCheck wait times first." {
+		t.Errorf("POST prompts/genesys/queue_health = %d %s", resp.Status, resp.Body)
+	}
+
+	tests := []struct {
+		method, path, body string
+		wantStatus         int
+	}{
+		{"POST", "prompts/genesys/queue_health", `{}`, 400},
+		{"POST", "prompts/grafana/queue_health", `{}`, 404},
+		{"POST", "prompts/genesys", `{}`, 404},
+		{"POST", "prompts/genesys/queue_health", `not json`, 400},
+		{"GET", "prompts/genesys/queue_health", ``, 405},
+		{"POST", "prompts", ``, 405},
+	}
+	for _, tt := range tests {
+		if resp := callPromptResource(t, instance, tt.method, tt.path, tt.body); resp.Status != tt.wantStatus {
+			t.Errorf("%s %s = %d, want %d (%s)", tt.method, tt.path, resp.Status, tt.wantStatus, resp.Body)
+		}
+	}
+}
+
+func TestListPromptsSkipsUnavailableAndSlowServers(t *testing.T) {
+	capabilities := map[string]interface{}{"prompts": map[string]interface{}{}}
+
+	// A server that stopped answering prompts/list
+	release := make(chan struct{})
+	slow := mcptest.NewServer(t, capabilities, map[string]mcptest.Handler{
+		"prompts/list": func(map[string]interface{}) (interface{}, error) {
+			<-release
+			return map[string]interface{}{"prompts": []mcp.Prompt{}}, nil
+		},
+	})
+	t.Cleanup(func() { close(release) })
+	slowClient := mcp.NewClient(slow.URL, "alertmanager")
+	if err := slowClient.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	// A server that went down after connecting; asking it would only wait for its reconnect
+	var down atomic.Bool
+	var listed atomic.Int32
+	downServer := mcptest.NewServer(t, capabilities, map[string]mcptest.Handler{
+		"initialize": func(params map[string]interface{}) (interface{}, error) {
+			if down.Load() {
+				return nil, errors.New("restarting")
+			}
+			return map[string]interface{}{"protocolVersion": params["protocolVersion"], "capabilities": capabilities}, nil
+		},
+		"prompts/list": func(map[string]interface{}) (interface{}, error) {
+			listed.Add(1)
+			return map[string]interface{}{"prompts": []mcp.Prompt{}}, nil
+		},
+	})
+	downClient := mcp.NewClient(downServer.URL, "grafana")
+	if err := downClient.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	down.Store(true)
+	if err := downClient.Connect(context.Background()); err == nil {
+		t.Fatal("Connect() should fail while the server is down")
+	}
+
+	instance := &Instance{mcpClients: map[string]*mcp.Client{
+		"genesys":      newPromptsMCPClient(t),
+		"alertmanager": slowClient,
+		"grafana":      downClient,
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	sender := &recordingSender{}
+	start := time.Now()
+	if err := instance.handleListPrompts(ctx, &backend.CallResourceRequest{Method: "GET", Path: "prompts"}, sender); err != nil {
+		t.Fatalf("GET prompts error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("GET prompts took %v, want the slow server cut off", elapsed)
+	}
+
+	resp := sender.responses[0]
+	var list struct {
+		Prompts []PromptInfo      `json:"prompts"`
+		Errors  map[string]string `json:"errors"`
+	}
+	json.Unmarshal(resp.Body, &list)
+	if resp.Status != 200 || len(list.Prompts) != 1 || list.Prompts[0].Server != "genesys" {
+		t.Errorf("GET prompts = %d %s, want the genesys prompt", resp.Status, resp.Body)
+	}
+	if len(list.Errors) != 2 || list.Errors["alertmanager"] == "" || list.Errors["grafana"] == "" {
+		t.Errorf("GET prompts errors = %v, want alertmanager and grafana", list.Errors)
+	}
+	if listed.Load() != 0 {
+		t.Errorf("unavailable server asked for prompts %d times, want 0", listed.Load())
+	}
+}
+
+func TestReadResourceTool(t *testing.T) {
+	mcpClients := map[string]*mcp.Client{"genesys": newPromptsMCPClient(t)}
+	manager, err := agent.NewManager(nil, mcpClients, nil)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	instance := &Instance{agentManager: manager, mcpClients: mcpClients}
+	viewer := agent.User{Login: "alice", Role: agent.RoleViewer}
+
+	result, err := instance.executeTool(context.Background(), viewer, agent.ReadResourceTool, map[string]interface{}{"uri": "runbook://queues"})
+	if err != nil {
+		t.Fatalf("read_resource error = %v", err)
+	}
+	if got := mcp.FormatToolResult(result); got != "Resource runbook://queues:\nCheck wait times first." {
+		t.Errorf("read_resource = %q", got)
+	}
+
+	if _, err := instance.executeTool(context.Background(), viewer, agent.ReadResourceTool, map[string]interface{}{"uri": "runbook://queues", "server": "grafana"}); err == nil {
+		t.Error("read_resource should fail for a server without resources")
+	}
+	if _, err := instance.executeTool(context.Background(), viewer, agent.ReadResourceTool, map[string]interface{}{}); err == nil {
+		t.Error("read_resource should require a uri")
+	}
+}
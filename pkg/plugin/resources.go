@@ -3,11 +3,14 @@ package plugin
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/agent"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
 )
 
 // handleChat handles non-streaming chat requests
@@ -22,19 +25,30 @@ func (i *Instance) handleChat(ctx context.Context, req *backend.CallResourceRequ
 	if chatReq.Message == "" {
 		return i.sendError(sender, 400, "Message is required")
 	}
+	if chatReq.Model != "" && !validModel.MatchString(chatReq.Model) {
+		return i.sendError(sender, 400, fmt.Sprintf("Invalid model %q", chatReq.Model))
+	}
 
-	// Generate session ID if not provided
-	if chatReq.SessionID == "" {
-		chatReq.SessionID = fmt.Sprintf("session-%d", req.PluginContext.OrgID)
+	// Identify the user and assign a session ID if not provided
+	user, err := sessionUser(req.PluginContext)
+	if err != nil {
+		return i.sendError(sender, 401, err.Error())
+	}
+	if err := assignSessionID(&chatReq); err != nil {
+		return i.sendError(sender, 500, err.Error())
 	}
+	ctx = llm.WithModel(ctx, i.requestModel(chatReq))
 
-	log.DefaultLogger.Info("Chat request", "session", chatReq.SessionID, "message_length", len(chatReq.Message))
+	log.DefaultLogger.Info("Chat request", "session", chatReq.SessionID, "user", user.Login, "message_length", len(chatReq.Message), "model", i.requestModel(chatReq))
 
 	// Build contextual message
 	message := buildContextualMessage(chatReq.Message, chatReq.DashboardContext)
 
-	// Execute chat
-	response, err := i.agentManager.RunChat(ctx, message, chatReq.SessionID)
+	// Execute chat; the agent loop runs tools through executeTool
+	result, err := i.agentManager.RunChat(ctx, message, chatReq.SessionID, user, i.toolExecutor(user))
+	if errors.Is(err, agent.ErrSessionForbidden) {
+		return i.sendError(sender, 403, err.Error())
+	}
 	if err != nil {
 		log.DefaultLogger.Error("Chat failed", "error", err)
 		return i.sendError(sender, 500, fmt.Sprintf("Chat failed: %v", err))
@@ -42,11 +56,60 @@ func (i *Instance) handleChat(ctx context.Context, req *backend.CallResourceRequ
 
 	// Send response
 	return i.sendJSON(sender, 200, ChatResponse{
-		Response:  response,
+		Response:  result.Response,
 		SessionID: chatReq.SessionID,
+		ToolCalls: result.ToolCalls,
+		Model:     result.Model,
 	})
 }
 
+// requestModel returns the model a chat request asked for, or the org's default
+func (i *Instance) requestModel(chatReq ChatRequest) string {
+	if chatReq.Model != "" {
+		return chatReq.Model
+	}
+	if i.settings != nil {
+		return i.settings.Model
+	}
+	return ""
+}
+
+// sessionUser returns the session identity of the Grafana user making the request
+func sessionUser(pluginCtx backend.PluginContext) (agent.User, error) {
+	if pluginCtx.User == nil {
+		return agent.User{}, errors.New("user identity is required")
+	}
+
+	login := pluginCtx.User.Login
+	if login == "" {
+		login = pluginCtx.User.Email
+	}
+	if login == "" {
+		return agent.User{}, errors.New("user identity is required")
+	}
+
+	return agent.User{
+		Login:   login,
+		Role:    pluginCtx.User.Role,
+		IsAdmin: pluginCtx.User.Role == agent.RoleAdmin,
+	}, nil
+}
+
+// assignSessionID gives a request without a session a new server-generated ID
+func assignSessionID(chatReq *ChatRequest) error {
+	if chatReq.SessionID != "" {
+		return nil
+	}
+
+	id, err := agent.NewSessionID()
+	if err != nil {
+		return err
+	}
+
+	chatReq.SessionID = id
+	return nil
+}
+
 // buildContextualMessage injects dashboard context into the user message
 func buildContextualMessage(userMessage string, ctx *DashboardContext) string {
 	if ctx == nil {
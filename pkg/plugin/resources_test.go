@@ -1,7 +1,16 @@
 package plugin
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/agent"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
 )
 
 func TestBuildContextualMessage(t *testing.T) {
@@ -157,6 +166,76 @@ func TestBuildContextualMessageWithNilTags(t *testing.T) {
 	}
 }
 
+func TestSessionUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      *backend.User
+		wantLogin string
+		wantAdmin bool
+		wantErr   bool
+	}{
+		{
+			name:    "no user",
+			user:    nil,
+			wantErr: true,
+		},
+		{
+			name:      "viewer with login",
+			user:      &backend.User{Login: "alice", Email: "alice@example.com", Role: "Viewer"},
+			wantLogin: "alice",
+		},
+		{
+			name:      "falls back to email",
+			user:      &backend.User{Email: "bob@example.com", Role: "Editor"},
+			wantLogin: "bob@example.com",
+		},
+		{
+			name:      "org admin",
+			user:      &backend.User{Login: "admin", Role: "Admin"},
+			wantLogin: "admin",
+			wantAdmin: true,
+		},
+		{
+			name:    "no login or email",
+			user:    &backend.User{Name: "Anonymous"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sessionUser(backend.PluginContext{User: tt.user})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sessionUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Login != tt.wantLogin || got.IsAdmin != tt.wantAdmin {
+				t.Errorf("sessionUser() = %+v, want login %q admin %v", got, tt.wantLogin, tt.wantAdmin)
+			}
+			if tt.user != nil && got.Role != tt.user.Role && !tt.wantErr {
+				t.Errorf("sessionUser() role = %q, want %q", got.Role, tt.user.Role)
+			}
+		})
+	}
+}
+
+func TestAssignSessionID(t *testing.T) {
+	req := ChatRequest{SessionID: "existing"}
+	if err := assignSessionID(&req); err != nil {
+		t.Fatalf("assignSessionID() error = %v", err)
+	}
+	if req.SessionID != "existing" {
+		t.Errorf("assignSessionID() replaced client session ID with %q", req.SessionID)
+	}
+
+	req = ChatRequest{}
+	if err := assignSessionID(&req); err != nil {
+		t.Fatalf("assignSessionID() error = %v", err)
+	}
+	if !strings.HasPrefix(req.SessionID, "session-") || len(req.SessionID) <= len("session-") {
+		t.Errorf("assignSessionID() generated %q", req.SessionID)
+	}
+}
+
 // Helper functions
 
 func contains(s, substr string) bool {
@@ -172,6 +251,72 @@ func indexOf(s, substr string) int {
 	return -1
 }
 
+func TestHandleChatModel(t *testing.T) {
+	// The LLM answers with the model it was asked for
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"role": "assistant", "content": req.Model}}},
+		})
+	}))
+	defer server.Close()
+
+	llmClient, err := llm.NewLLMClient(server.URL, "test-key")
+	if err != nil {
+		t.Fatalf("NewLLMClient() error = %v", err)
+	}
+	manager, err := agent.NewManager(llmClient, nil, nil)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	instance := &Instance{agentManager: manager, llmClient: llmClient, settings: &PluginSettings{Model: llm.ModelBase}}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantModel  string
+	}{
+		{"org default", `{"message":"hi"}`, 200, llm.ModelBase},
+		{"requested tier", `{"message":"hi","model":"large"}`, 200, llm.ModelLarge},
+		{"requested name", `{"message":"hi","model":"gpt-4o-mini"}`, 200, "gpt-4o-mini"},
+		{"invalid model", `{"message":"hi","model":"no spaces"}`, 400, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &recordingSender{}
+			err := instance.handleChat(context.Background(), &backend.CallResourceRequest{
+				Method:        "POST",
+				Path:          "chat",
+				Body:          []byte(tt.body),
+				PluginContext: backend.PluginContext{User: &backend.User{Login: "alice", Role: "Viewer"}},
+			}, sender)
+			if err != nil {
+				t.Fatalf("handleChat() error = %v", err)
+			}
+			if got := sender.responses[0].Status; got != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", got, tt.wantStatus, sender.responses[0].Body)
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+
+			var resp ChatResponse
+			if err := json.Unmarshal(sender.responses[0].Body, &resp); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if resp.Model != tt.wantModel || resp.Response != tt.wantModel {
+				t.Errorf("model = %q, answered by %q; want %q", resp.Model, resp.Response, tt.wantModel)
+			}
+		})
+	}
+}
+
 // Benchmark tests
 
 func BenchmarkBuildContextualMessage(b *testing.B) {
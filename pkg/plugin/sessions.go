@@ -0,0 +1,207 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/agent"
+)
+
+// RenameSessionRequest represents a request to rename a session
+type RenameSessionRequest struct {
+	Title string `json:"title"`
+}
+
+// handleListSessions lists the caller's sessions (GET sessions[?all=true] for admins)
+func (i *Instance) handleListSessions(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if req.Method != "GET" {
+		return i.sendError(sender, 405, "Method not allowed")
+	}
+
+	user, err := sessionUser(req.PluginContext)
+	if err != nil {
+		return i.sendError(sender, 401, err.Error())
+	}
+
+	all := queryParam(req, "all") == "true"
+
+	sessions, err := i.agentManager.ListSessions(user, all)
+	if err != nil {
+		log.DefaultLogger.Error("Failed to list sessions", "error", err)
+		return i.sendError(sender, 500, err.Error())
+	}
+
+	return i.sendJSON(sender, 200, map[string]interface{}{
+		"sessions": sessions,
+	})
+}
+
+// handleSession routes sessions/{id} and its sub-resources:
+//
+//	GET    sessions/{id}         full history
+//	PATCH  sessions/{id}         rename ({"title": "..."})
+//	DELETE sessions/{id}         delete
+//	POST   sessions/{id}/clear   clear history
+//	GET    sessions/{id}/export  export (?format=markdown|json)
+func (i *Instance) handleSession(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	user, err := sessionUser(req.PluginContext)
+	if err != nil {
+		return i.sendError(sender, 401, err.Error())
+	}
+
+	parts := strings.Split(strings.TrimPrefix(req.Path, "sessions/"), "/")
+	sessionID, err := url.PathUnescape(parts[0])
+	if err != nil || sessionID == "" || len(parts) > 2 {
+		return i.sendError(sender, 404, "Not found")
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && req.Method == "GET":
+		detail, err := i.agentManager.GetSession(sessionID, user)
+		if err != nil {
+			return i.sendSessionError(sender, err)
+		}
+		return i.sendJSON(sender, 200, detail)
+
+	case action == "" && req.Method == "PATCH":
+		var renameReq RenameSessionRequest
+		if err := json.Unmarshal(req.Body, &renameReq); err != nil {
+			return i.sendError(sender, 400, fmt.Sprintf("Invalid request body: %v", err))
+		}
+		info, err := i.agentManager.RenameSession(sessionID, user, renameReq.Title)
+		if err != nil {
+			return i.sendSessionError(sender, err)
+		}
+		return i.sendJSON(sender, 200, info)
+
+	case action == "" && req.Method == "DELETE":
+		if err := i.agentManager.DeleteSession(sessionID, user); err != nil {
+			return i.sendSessionError(sender, err)
+		}
+		return i.sendJSON(sender, 200, map[string]string{"status": "deleted"})
+
+	case action == "clear" && req.Method == "POST":
+		if err := i.agentManager.ClearSession(sessionID, user); err != nil {
+			return i.sendSessionError(sender, err)
+		}
+		return i.sendJSON(sender, 200, map[string]string{"status": "cleared"})
+
+	case action == "export" && req.Method == "GET":
+		return i.handleExportSession(sender, req, sessionID, user)
+
+	case action == "" || action == "clear" || action == "export":
+		return i.sendError(sender, 405, "Method not allowed")
+
+	default:
+		return i.sendError(sender, 404, "Not found")
+	}
+}
+
+// handleExportSession returns a session as Markdown (default) or JSON
+func (i *Instance) handleExportSession(sender backend.CallResourceResponseSender, req *backend.CallResourceRequest, sessionID string, user agent.User) error {
+	detail, err := i.agentManager.GetSession(sessionID, user)
+	if err != nil {
+		return i.sendSessionError(sender, err)
+	}
+
+	format := queryParam(req, "format")
+	if format == "" {
+		format = "markdown"
+	}
+
+	var body []byte
+	var contentType, extension string
+	switch format {
+	case "markdown", "md":
+		body = []byte(renderSessionMarkdown(detail))
+		contentType, extension = "text/markdown; charset=utf-8", "md"
+	case "json":
+		body, err = json.MarshalIndent(detail, "", "  ")
+		if err != nil {
+			return i.sendError(sender, 500, fmt.Sprintf("Failed to marshal JSON: %v", err))
+		}
+		contentType, extension = "application/json", "json"
+	default:
+		return i.sendError(sender, 400, fmt.Sprintf("Unsupported export format %q (expected markdown or json)", format))
+	}
+
+	return sender.Send(&backend.CallResourceResponse{
+		Status: 200,
+		Headers: map[string][]string{
+			"Content-Type":        {contentType},
+			"Content-Disposition": {fmt.Sprintf("attachment; filename=%q", sessionID+"."+extension)},
+		},
+		Body: body,
+	})
+}
+
+// sendSessionError maps session errors to HTTP status codes
+func (i *Instance) sendSessionError(sender backend.CallResourceResponseSender, err error) error {
+	switch {
+	case errors.Is(err, agent.ErrSessionNotFound):
+		return i.sendError(sender, 404, err.Error())
+	case errors.Is(err, agent.ErrSessionForbidden):
+		return i.sendError(sender, 403, err.Error())
+	default:
+		log.DefaultLogger.Error("Session request failed", "error", err)
+		return i.sendError(sender, 500, err.Error())
+	}
+}
+
+// renderSessionMarkdown renders a session as a shareable Markdown document
+func renderSessionMarkdown(detail *agent.SessionDetail) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", detail.Title)
+	fmt.Fprintf(&b, "- **Session:** `%s`\n", detail.ID)
+	if detail.Owner != "" {
+		fmt.Fprintf(&b, "- **Owner:** %s\n", detail.Owner)
+	}
+	fmt.Fprintf(&b, "- **Created:** %s\n", detail.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- **Updated:** %s\n", detail.UpdatedAt.Format(time.RFC3339))
+
+	if detail.Summary != "" {
+		fmt.Fprintf(&b, "\n## Summary of earlier conversation\n\n%s\n", detail.Summary)
+	}
+
+	for _, msg := range detail.Messages {
+		switch msg.Role {
+		case "user":
+			fmt.Fprintf(&b, "\n## User\n\n%s\n", msg.Content)
+		case "assistant":
+			if msg.Content != "" || len(msg.ToolCalls) == 0 {
+				fmt.Fprintf(&b, "\n## Assistant\n\n%s\n", msg.Content)
+			}
+			for _, call := range msg.ToolCalls {
+				fmt.Fprintf(&b, "\n### Tool call: `%s`\n\n```json\n%s\n```\n", call.Name, call.Arguments)
+			}
+		case "tool":
+			fmt.Fprintf(&b, "\n### Tool result\n\n```\n%s\n```\n", msg.Content)
+		default:
+			fmt.Fprintf(&b, "\n## %s\n\n%s\n", msg.Role, msg.Content)
+		}
+	}
+
+	return b.String()
+}
+
+// queryParam returns a query parameter from the resource request URL
+func queryParam(req *backend.CallResourceRequest, name string) string {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get(name)
+}
@@ -0,0 +1,188 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/agent"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
+)
+
+// recordingSender captures resource responses
+type recordingSender struct {
+	responses []*backend.CallResourceResponse
+}
+
+func (s *recordingSender) Send(resp *backend.CallResourceResponse) error {
+	s.responses = append(s.responses, resp)
+	return nil
+}
+
+// newSessionTestInstance creates an instance whose LLM always answers "All good."
+func newSessionTestInstance(t *testing.T) *Instance {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"All good."}}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	llmClient, err := llm.NewLLMClient(server.URL, "test-key")
+	if err != nil {
+		t.Fatalf("NewLLMClient() error = %v", err)
+	}
+
+	manager, err := agent.NewManager(llmClient, nil, nil)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	return &Instance{agentManager: manager, llmClient: llmClient}
+}
+
+func callSessionResource(t *testing.T, instance *Instance, method, path, login string, body string) *backend.CallResourceResponse {
+	req := &backend.CallResourceRequest{
+		Method: method,
+		Path:   strings.SplitN(path, "?", 2)[0],
+		URL:    path,
+		Body:   []byte(body),
+		PluginContext: backend.PluginContext{
+			User: &backend.User{Login: login, Role: "Viewer"},
+		},
+	}
+
+	sender := &recordingSender{}
+	var err error
+	if req.Path == "sessions" {
+		err = instance.handleListSessions(context.Background(), req, sender)
+	} else {
+		err = instance.handleSession(context.Background(), req, sender)
+	}
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, path, err)
+	}
+	if len(sender.responses) != 1 {
+		t.Fatalf("%s %s sent %d responses, want 1", method, path, len(sender.responses))
+	}
+	return sender.responses[0]
+}
+
+func TestSessionResources(t *testing.T) {
+	instance := newSessionTestInstance(t)
+
+	if _, err := instance.agentManager.RunChat(context.Background(), "Is the cluster healthy?", "s1", agent.User{Login: "alice"}, nil); err != nil {
+		t.Fatalf("RunChat() error = %v", err)
+	}
+
+	// List
+	resp := callSessionResource(t, instance, "GET", "sessions", "alice", "")
+	var list struct {
+		Sessions []agent.SessionInfo `json:"sessions"`
+	}
+	if err := json.Unmarshal(resp.Body, &list); err != nil {
+		t.Fatalf("GET sessions body = %s: %v", resp.Body, err)
+	}
+	if len(list.Sessions) != 1 || list.Sessions[0].Title != "Is the cluster healthy?" || list.Sessions[0].MessageCount != 2 {
+		t.Errorf("GET sessions = %+v", list.Sessions)
+	}
+
+	resp = callSessionResource(t, instance, "GET", "sessions", "bob", "")
+	if !strings.Contains(string(resp.Body), `"sessions":[]`) {
+		t.Errorf("GET sessions as bob = %s, want empty list", resp.Body)
+	}
+
+	// Fetch, with ownership enforced
+	resp = callSessionResource(t, instance, "GET", "sessions/s1", "alice", "")
+	if resp.Status != 200 || !strings.Contains(string(resp.Body), "All good.") {
+		t.Errorf("GET sessions/s1 = %d %s", resp.Status, resp.Body)
+	}
+	if resp := callSessionResource(t, instance, "GET", "sessions/s1", "bob", ""); resp.Status != 403 {
+		t.Errorf("GET sessions/s1 as bob status = %d, want 403", resp.Status)
+	}
+	if resp := callSessionResource(t, instance, "GET", "sessions/unknown", "alice", ""); resp.Status != 404 {
+		t.Errorf("GET sessions/unknown status = %d, want 404", resp.Status)
+	}
+
+	// Rename
+	resp = callSessionResource(t, instance, "PATCH", "sessions/s1", "alice", `{"title":"Health check"}`)
+	if resp.Status != 200 || !strings.Contains(string(resp.Body), `"title":"Health check"`) {
+		t.Errorf("PATCH sessions/s1 = %d %s", resp.Status, resp.Body)
+	}
+
+	// Export
+	resp = callSessionResource(t, instance, "GET", "sessions/s1/export", "alice", "")
+	if resp.Status != 200 || resp.Headers["Content-Type"][0] != "text/markdown; charset=utf-8" || !strings.HasPrefix(string(resp.Body), "# Health check") {
+		t.Errorf("GET sessions/s1/export = %d %v %s", resp.Status, resp.Headers, resp.Body)
+	}
+	resp = callSessionResource(t, instance, "GET", "sessions/s1/export?format=json", "alice", "")
+	var exported agent.SessionDetail
+	if err := json.Unmarshal(resp.Body, &exported); err != nil || len(exported.Messages) != 2 {
+		t.Errorf("GET sessions/s1/export?format=json = %s (%v)", resp.Body, err)
+	}
+	if resp := callSessionResource(t, instance, "GET", "sessions/s1/export?format=pdf", "alice", ""); resp.Status != 400 {
+		t.Errorf("export as pdf status = %d, want 400", resp.Status)
+	}
+
+	// Clear
+	if resp := callSessionResource(t, instance, "GET", "sessions/s1/clear", "alice", ""); resp.Status != 405 {
+		t.Errorf("GET sessions/s1/clear status = %d, want 405", resp.Status)
+	}
+	if resp := callSessionResource(t, instance, "POST", "sessions/s1/clear", "alice", ""); resp.Status != 200 {
+		t.Errorf("POST sessions/s1/clear status = %d, want 200", resp.Status)
+	}
+	resp = callSessionResource(t, instance, "GET", "sessions/s1", "alice", "")
+	if !strings.Contains(string(resp.Body), `"message_count":0`) {
+		t.Errorf("GET sessions/s1 after clear = %s, want no messages", resp.Body)
+	}
+
+	// Delete
+	if resp := callSessionResource(t, instance, "DELETE", "sessions/s1", "bob", ""); resp.Status != 403 {
+		t.Errorf("DELETE sessions/s1 as bob status = %d, want 403", resp.Status)
+	}
+	if resp := callSessionResource(t, instance, "DELETE", "sessions/s1", "alice", ""); resp.Status != 200 {
+		t.Errorf("DELETE sessions/s1 status = %d, want 200", resp.Status)
+	}
+	if resp := callSessionResource(t, instance, "GET", "sessions/s1", "alice", ""); resp.Status != 404 {
+		t.Errorf("GET sessions/s1 after delete status = %d, want 404", resp.Status)
+	}
+
+	if resp := callSessionResource(t, instance, "GET", "sessions/s1/bogus", "alice", ""); resp.Status != 404 {
+		t.Errorf("GET sessions/s1/bogus status = %d, want 404", resp.Status)
+	}
+}
+
+func TestRenderSessionMarkdown(t *testing.T) {
+	detail := &agent.SessionDetail{
+		SessionInfo: agent.SessionInfo{ID: "s1", Title: "CPU incident", Owner: "alice"},
+		Messages: []agent.Message{
+			{Role: "user", Content: "Why is CPU high?"},
+			{Role: "assistant", ToolCalls: []agent.ToolCall{{ID: "call_1", Name: "query_prometheus", Arguments: `{"query":"up"}`}}},
+			{Role: "tool", ToolCallID: "call_1", Content: "up=1"},
+			{Role: "assistant", Content: "A runaway process."},
+		},
+	}
+
+	got := renderSessionMarkdown(detail)
+
+	for _, want := range []string{
+		"# CPU incident",
+		"- **Owner:** alice",
+		"## User\n\nWhy is CPU high?",
+		"### Tool call: `query_prometheus`",
+		`{"query":"up"}`,
+		"### Tool result\n\n```\nup=1\n```",
+		"## Assistant\n\nA runaway process.",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("renderSessionMarkdown() missing %q\nGot:\n%s", want, got)
+		}
+	}
+
+	// The tool-calling step has no text, so only the final answer gets an Assistant heading
+	if strings.Count(got, "## Assistant") != 1 {
+		t.Errorf("renderSessionMarkdown() has %d Assistant headings, want 1", strings.Count(got, "## Assistant"))
+	}
+}
@@ -3,15 +3,147 @@ package plugin
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/agent"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+)
+
+// Session store backends
+const (
+	SessionStoreMemory = "memory"
+	SessionStoreFile   = "file"
 )
 
+// validToolPrefix matches prefixes that keep tool names valid function names for the LLM
+var validToolPrefix = regexp.MustCompile(`^[A-Za-z0-9_-]*$`)
+
+// validServerName matches MCP server names, which end up in tool prefixes and secret keys
+var validServerName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// allowedCommandsEnv lists further MCP server binaries the plugin may launch,
+// separated by commas. Grafana sets it from mcp_commands in the
+// [plugin.sabio-sm3-chat-plugin] section of its configuration.
+const allowedCommandsEnv = "GF_PLUGIN_MCP_COMMANDS"
+
+// validModel matches model tiers and provider model names
+var validModel = regexp.MustCompile(`^[A-Za-z0-9._:/-]+$`)
+
+// legacyMCPServers are the servers configurable through the URL fields predating mcp_servers
+var legacyMCPServers = []string{"grafana", "alertmanager", "genesys"}
+
 // PluginSettings holds the plugin configuration
 type PluginSettings struct {
-	GrafanaURL         string `json:"grafana_url"`
-	GrafanaAPIKey      string `json:"grafana_api_key"`
-	GrafanaMCPURL      string `json:"grafana_mcp_url"`
-	AlertManagerMCPURL string `json:"alertmanager_mcp_url"`
-	GenesysMCPURL      string `json:"genesys_mcp_url"`
+	GrafanaURL         string            `json:"grafana_url"`
+	GrafanaAPIKey      string            `json:"grafana_api_key"`
+	MCPServers         []MCPServer       `json:"mcp_servers"` // MCP servers to connect to
+	GrafanaMCPURL      string            `json:"grafana_mcp_url"`
+	AlertManagerMCPURL string            `json:"alertmanager_mcp_url"`
+	GenesysMCPURL      string            `json:"genesys_mcp_url"`
+	MCPToolsTTL        int               `json:"mcp_tools_ttl"` // Seconds tool lists are cached (0 = 300, -1 = until the server reports a change)
+	MaxToolIterations  int               `json:"max_tool_iterations"`
+	Model              string            `json:"model"`              // Default model: "base", "large" (default), "auto" or a provider model name
+	SessionStore       string            `json:"session_store"`      // "memory" (default) or "file"
+	SessionStorePath   string            `json:"session_store_path"` // Directory for the file session store
+	ContextWindow      int               `json:"context_window"`     // Model context window in tokens (0 = known window of the model)
+	ContextBudget      float64           `json:"context_budget"`     // Share of the context window a request may use (0 = 0.8)
+	SummarizeHistory   bool              `json:"summarize_history"`  // Summarize trimmed history instead of dropping it
+	ToolAccess         map[string]string `json:"tool_access"`        // Tool name -> "read_only" or "mutating"
+	ToolPolicy         agent.ToolPolicy  `json:"tool_policy"`        // Allow/deny lists per MCP server and minimum roles per tool
+}
+
+// MCPServer configures one MCP server. Secrets come from secure JSON data as
+// described on MCPServerAuth, or from the keys named in Secrets.
+type MCPServer struct {
+	Name       string            `json:"name"`        // Unique; names the server in tool prefixes, policies, health and secret keys
+	URL        string            `json:"url"`         // Server URL, unless the server is launched from Command
+	Transport  string            `json:"transport"`   // "streamable-http" (default), "sse" or "stdio" (default with a command)
+	ToolPrefix *string           `json:"tool_prefix"` // Prefix of its exposed tool names (default "<name>__", none for grafana)
+	Enabled    *bool             `json:"enabled"`     // false keeps the entry without connecting (default true)
+	Secrets    map[string]string `json:"secrets"`     // Header name -> secure JSON key holding its value, under "mcp_<name>_"
+	Arguments  mcp.ArgumentRules `json:"arguments"`   // Tool argument normalization rules
+	Prompt     string            `json:"prompt"`      // Added to the system prompt, e.g. when to use the server's tools
+	MCPCommand
+	MCPServerAuth
+}
+
+// IsEnabled reports whether the plugin should connect to the server
+func (s MCPServer) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// GetTransport returns the configured transport, or stdio for servers with a
+// command and Streamable HTTP otherwise
+func (s MCPServer) GetTransport() string {
+	if s.Transport != "" {
+		return s.Transport
+	}
+	if s.Command != "" {
+		return mcp.TransportStdio
+	}
+	return mcp.TransportStreamableHTTP
+}
+
+// MCPCommand launches an MCP server as a child process of the plugin
+type MCPCommand struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`
+}
+
+// checkCommand allows only binaries shipped in the plugin directory or listed by
+// the Grafana operator in allowedCommandsEnv. Settings are editable by any org
+// admin, who must not be able to run arbitrary programs on the Grafana host.
+func checkCommand(command MCPCommand) error {
+	if !filepath.IsAbs(command.Command) {
+		return fmt.Errorf("command %s must be an absolute path", command.Command)
+	}
+	path := resolvePath(command.Command)
+
+	allowed := false
+	if exe, err := os.Executable(); err == nil {
+		rel, err := filepath.Rel(resolvePath(filepath.Dir(exe)), path)
+		allowed = err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	}
+	for _, listed := range strings.Split(os.Getenv(allowedCommandsEnv), ",") {
+		if listed = strings.TrimSpace(listed); listed != "" && resolvePath(listed) == path {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("command %s is not allowed: only binaries in the plugin directory or listed in mcp_commands of the plugin's Grafana configuration can be launched", command.Command)
+	}
+
+	// The dynamic loader would run any library these name inside the allowed binary
+	for key := range command.Env {
+		if upper := strings.ToUpper(key); strings.HasPrefix(upper, "LD_") || strings.HasPrefix(upper, "DYLD_") {
+			return fmt.Errorf("environment variable %s is not allowed for a command", key)
+		}
+	}
+	return nil
+}
+
+// resolvePath cleans a path and follows its symlinks where it exists
+func resolvePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+// MCPServerAuth holds the headers and TLS settings for an MCP server reached over HTTP.
+// Secrets come from secure JSON data: "mcp_<server>_token" (sent as a bearer token),
+// "mcp_<server>_header_<Name>", "mcp_<server>_tls_ca_cert", "mcp_<server>_tls_client_cert"
+// and "mcp_<server>_tls_client_key".
+type MCPServerAuth struct {
+	Headers       map[string]string `json:"headers"`         // Non-secret headers sent with every request
+	TLSSkipVerify bool              `json:"tls_skip_verify"` // Accept any server certificate
+	UserHeader    string            `json:"user_header"`     // Header carrying the Grafana user's login, e.g. "X-Grafana-User"
 }
 
 // LoadSettings loads plugin settings from JSON
@@ -39,28 +171,204 @@ func (s *PluginSettings) Validate() error {
 		return fmt.Errorf("Grafana API key is required (service account token for Grafana LLM App)")
 	}
 
-	if s.GrafanaMCPURL == "" && s.AlertManagerMCPURL == "" && s.GenesysMCPURL == "" {
-		return fmt.Errorf("at least one MCP server URL must be configured")
+	if len(s.GetMCPServers()) == 0 {
+		return fmt.Errorf("at least one MCP server URL or command must be configured")
+	}
+
+	names := make(map[string]bool, len(s.MCPServers))
+	for _, server := range s.MCPServers {
+		if !validServerName.MatchString(server.Name) {
+			return fmt.Errorf("MCP server name %q may only contain letters, digits, '_' and '-'", server.Name)
+		}
+		if names[server.Name] {
+			return fmt.Errorf("MCP server %s is configured more than once", server.Name)
+		}
+		names[server.Name] = true
+	}
+
+	for _, server := range s.allMCPServers() {
+		transport := server.GetTransport()
+		if !mcp.ValidTransport(transport) {
+			return fmt.Errorf("unknown transport %q for MCP server %s (expected one of %s)", transport, server.Name, strings.Join(mcp.Transports, ", "))
+		}
+		if server.URL == "" && server.Command == "" {
+			return fmt.Errorf("MCP server %s needs a URL or a command", server.Name)
+		}
+		if transport == mcp.TransportStdio && server.Command == "" {
+			return fmt.Errorf("MCP server %s uses the stdio transport but has no command", server.Name)
+		}
+		for header, key := range server.Secrets {
+			if !strings.HasPrefix(key, "mcp_"+server.Name+"_") {
+				return fmt.Errorf("secret %s for header %s of MCP server %s must start with mcp_%s_", key, header, server.Name, server.Name)
+			}
+		}
+		if server.Command != "" {
+			if err := checkCommand(server.MCPCommand); err != nil {
+				return fmt.Errorf("MCP server %s: %w", server.Name, err)
+			}
+		}
+		if server.ToolPrefix != nil && !validToolPrefix.MatchString(*server.ToolPrefix) {
+			return fmt.Errorf("tool prefix %q for MCP server %s may only contain letters, digits, '_' and '-'", *server.ToolPrefix, server.Name)
+		}
+	}
+
+	if s.Model != "" && !validModel.MatchString(s.Model) {
+		return fmt.Errorf("invalid model %q", s.Model)
+	}
+
+	if s.MCPToolsTTL < -1 {
+		return fmt.Errorf("MCP tools TTL must be -1, 0 or a number of seconds")
+	}
+
+	switch s.SessionStore {
+	case "", SessionStoreMemory, SessionStoreFile:
+	default:
+		return fmt.Errorf("unknown session store %q (expected %q or %q)", s.SessionStore, SessionStoreMemory, SessionStoreFile)
+	}
+
+	// Temporary directories are cleaned up behind the plugin's back, so history
+	// only goes to a data directory Grafana provides or one set explicitly
+	if s.SessionStore == SessionStoreFile && s.GetSessionStorePath() == "" {
+		return fmt.Errorf("file session store needs session_store_path when Grafana's data path is unknown")
+	}
+
+	if s.ContextWindow < 0 {
+		return fmt.Errorf("context window must not be negative")
+	}
+
+	if s.ContextBudget < 0 || s.ContextBudget > 1 {
+		return fmt.Errorf("context budget must be between 0 and 1")
+	}
+
+	for tool, access := range s.ToolAccess {
+		switch agent.ToolAccess(access) {
+		case agent.ToolAccessReadOnly, agent.ToolAccessMutating:
+		default:
+			return fmt.Errorf("unknown access %q for tool %s (expected %q or %q)", access, tool, agent.ToolAccessReadOnly, agent.ToolAccessMutating)
+		}
+	}
+
+	if err := s.ToolPolicy.Validate(); err != nil {
+		return fmt.Errorf("invalid tool policy: %w", err)
 	}
 
 	return nil
 }
 
-// GetMCPServers returns a map of configured MCP servers
-func (s *PluginSettings) GetMCPServers() map[string]string {
-	servers := make(map[string]string)
+// GetSessionStorePath returns the directory used by the file session store.
+// Defaults to the plugin's folder under Grafana's data path; empty when that is not known.
+func (s *PluginSettings) GetSessionStorePath() string {
+	if s.SessionStorePath != "" {
+		return s.SessionStorePath
+	}
+
+	if dataPath := os.Getenv("GF_PATHS_DATA"); dataPath != "" {
+		return filepath.Join(dataPath, "plugins-data", "sabio-sm3-chat-plugin", "sessions")
+	}
+	return ""
+}
+
+// GetToolAccess returns the configured per-tool access overrides
+func (s *PluginSettings) GetToolAccess() map[string]agent.ToolAccess {
+	access := make(map[string]agent.ToolAccess, len(s.ToolAccess))
+	for tool, a := range s.ToolAccess {
+		access[tool] = agent.ToolAccess(a)
+	}
+	return access
+}
 
-	if s.GrafanaMCPURL != "" {
-		servers["grafana"] = s.GrafanaMCPURL
+// GetMCPServers returns the enabled MCP servers: the mcp_servers entries in order,
+// then the servers configured through the legacy fields
+func (s *PluginSettings) GetMCPServers() []MCPServer {
+	var servers []MCPServer
+	for _, server := range s.allMCPServers() {
+		if server.IsEnabled() {
+			servers = append(servers, server)
+		}
 	}
+	return servers
+}
+
+// allMCPServers returns every configured MCP server, enabled or not. A server
+// set through a legacy URL field (grafana_mcp_url, ...) is added with default
+// settings unless mcp_servers has an entry of the same name.
+func (s *PluginSettings) allMCPServers() []MCPServer {
+	servers := append([]MCPServer(nil), s.MCPServers...)
 
-	if s.AlertManagerMCPURL != "" {
-		servers["alertmanager"] = s.AlertManagerMCPURL
+	declared := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		declared[server.Name] = true
 	}
 
-	if s.GenesysMCPURL != "" {
-		servers["genesys"] = s.GenesysMCPURL
+	urls := map[string]string{
+		"grafana":      s.GrafanaMCPURL,
+		"alertmanager": s.AlertManagerMCPURL,
+		"genesys":      s.GenesysMCPURL,
+	}
+	for _, name := range legacyMCPServers {
+		if declared[name] || urls[name] == "" {
+			continue
+		}
+		servers = append(servers, MCPServer{Name: name, URL: urls[name]})
 	}
 
 	return servers
 }
+
+// GetMCPClientConfig returns the client settings for an MCP server, taking its
+// secrets from the decrypted secure JSON data
+func (s *PluginSettings) GetMCPClientConfig(server MCPServer, secrets map[string]string) mcp.ClientConfig {
+	config := mcp.ClientConfig{
+		Transport:  server.GetTransport(),
+		Arguments:  server.Arguments,
+		ToolPrefix: server.ToolPrefix,
+		UserHeader: server.UserHeader,
+	}
+
+	config.Headers = make(map[string]string, len(server.Headers))
+	for name, value := range server.Headers {
+		config.Headers[name] = value
+	}
+
+	secretPrefix := "mcp_" + server.Name + "_"
+	for key, value := range secrets {
+		if name, ok := strings.CutPrefix(key, secretPrefix+"header_"); ok && name != "" && value != "" {
+			config.Headers[name] = value
+		}
+	}
+	if token := secrets[secretPrefix+"token"]; token != "" {
+		config.Headers["Authorization"] = "Bearer " + token
+	}
+	for name, key := range server.Secrets {
+		if !strings.HasPrefix(key, secretPrefix) {
+			continue // Rejected by Validate; other servers' and the plugin's secrets stay private
+		}
+		if value := secrets[key]; value != "" {
+			config.Headers[name] = value
+		}
+	}
+
+	config.TLS = mcp.TLSConfig{
+		CACert:             secrets[secretPrefix+"tls_ca_cert"],
+		ClientCert:         secrets[secretPrefix+"tls_client_cert"],
+		ClientKey:          secrets[secretPrefix+"tls_client_key"],
+		InsecureSkipVerify: server.TLSSkipVerify,
+	}
+
+	if s.MCPToolsTTL < 0 {
+		config.ToolsTTL = -1
+	} else {
+		config.ToolsTTL = time.Duration(s.MCPToolsTTL) * time.Second
+	}
+
+	if server.Command != "" {
+		config.Command = server.Command
+		config.Args = server.Args
+		for key, value := range server.Env {
+			config.Env = append(config.Env, key+"="+value)
+		}
+		sort.Strings(config.Env)
+	}
+
+	return config
+}
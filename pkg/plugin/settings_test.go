@@ -0,0 +1,182 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+)
+
+// mcpServer returns the enabled MCP server of the given name
+func mcpServer(t *testing.T, settings *PluginSettings, name string) MCPServer {
+	t.Helper()
+
+	for _, server := range settings.GetMCPServers() {
+		if server.Name == name {
+			return server
+		}
+	}
+	t.Fatalf("MCP server %s not configured", name)
+	return MCPServer{}
+}
+
+func TestGetMCPClientConfigAuth(t *testing.T) {
+	settings := &PluginSettings{
+		MCPServers: []MCPServer{{
+			Name: "alertmanager",
+			URL:  "http://alertmanager-mcp:9300",
+			MCPServerAuth: MCPServerAuth{
+				Headers:       map[string]string{"X-Scope-OrgID": "tenant-1"},
+				TLSSkipVerify: true,
+				UserHeader:    "X-Grafana-User",
+			},
+		}},
+		GrafanaMCPURL: "http://grafana-mcp:8888",
+	}
+	secrets := map[string]string{
+		"grafana_api_key":                   "ignored",
+		"mcp_alertmanager_token":            "secret",
+		"mcp_alertmanager_header_X-Api-Key": "key",
+		"mcp_alertmanager_tls_ca_cert":      "ca",
+		"mcp_grafana_token":                 "other server",
+	}
+
+	config := settings.GetMCPClientConfig(mcpServer(t, settings, "alertmanager"), secrets)
+
+	want := map[string]string{"X-Scope-OrgID": "tenant-1", "X-Api-Key": "key", "Authorization": "Bearer secret"}
+	if len(config.Headers) != len(want) {
+		t.Errorf("Headers = %v, want %v", config.Headers, want)
+	}
+	for name, value := range want {
+		if config.Headers[name] != value {
+			t.Errorf("Headers[%s] = %q, want %q", name, config.Headers[name], value)
+		}
+	}
+	if config.TLS.CACert != "ca" || !config.TLS.InsecureSkipVerify || config.UserHeader != "X-Grafana-User" {
+		t.Errorf("TLS = %+v, UserHeader = %q", config.TLS, config.UserHeader)
+	}
+
+	if grafana := settings.GetMCPClientConfig(mcpServer(t, settings, "grafana"), secrets); grafana.Headers["Authorization"] != "Bearer other server" || grafana.UserHeader != "" {
+		t.Errorf("grafana config = %+v, want only its own token", grafana)
+	}
+}
+
+func TestGetMCPServersList(t *testing.T) {
+	t.Setenv(allowedCommandsEnv, "/usr/bin/other-mcp, /usr/bin/local-mcp")
+	disabled, badPrefix := false, "x.y"
+	settings := &PluginSettings{
+		MCPServers: []MCPServer{
+			{Name: "loki", URL: "http://loki-mcp:8080", Prompt: "Use loki tools for logs.", Secrets: map[string]string{"X-Api-Key": "mcp_loki_api_key"}},
+			{Name: "alertmanager", URL: "http://am-new:9300", Transport: mcp.TransportSSE},
+			{Name: "tempo", URL: "http://tempo-mcp:8080", Enabled: &disabled},
+			{Name: "local", MCPCommand: MCPCommand{Command: "/usr/bin/local-mcp"}},
+		},
+		GrafanaMCPURL:      "http://grafana-mcp:8888",
+		AlertManagerMCPURL: "http://alertmanager-mcp:9300",
+	}
+	if err := settings.Validate(); err == nil || !strings.Contains(err.Error(), "Grafana URL") {
+		t.Fatalf("Validate() error = %v, want only the missing Grafana URL", err)
+	}
+	settings.GrafanaURL, settings.GrafanaAPIKey = "http://grafana:3000", "key"
+	if err := settings.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	var names []string
+	for _, server := range settings.GetMCPServers() {
+		names = append(names, server.Name)
+	}
+	if got, want := strings.Join(names, ","), "loki,alertmanager,local,grafana"; got != want {
+		t.Errorf("GetMCPServers() = %s, want %s", got, want)
+	}
+
+	// The mcp_servers entry replaces the legacy alertmanager URL
+	if am := mcpServer(t, settings, "alertmanager"); am.URL != "http://am-new:9300" || am.GetTransport() != mcp.TransportSSE {
+		t.Errorf("alertmanager = %+v", am)
+	}
+	if transport := mcpServer(t, settings, "local").GetTransport(); transport != mcp.TransportStdio {
+		t.Errorf("local transport = %s, want stdio", transport)
+	}
+
+	config := settings.GetMCPClientConfig(mcpServer(t, settings, "loki"), map[string]string{"mcp_loki_api_key": "secret"})
+	if config.Headers["X-Api-Key"] != "secret" || config.Transport != mcp.TransportStreamableHTTP {
+		t.Errorf("loki config = %+v", config)
+	}
+
+	// The service account token never reaches an MCP server
+	leaky := MCPServer{Name: "leaky", URL: "http://x", Secrets: map[string]string{"X-Token": "grafana_api_key"}}
+	if config := settings.GetMCPClientConfig(leaky, map[string]string{"grafana_api_key": "sa-token"}); config.Headers["X-Token"] != "" {
+		t.Errorf("leaky config headers = %v, want no foreign secret", config.Headers)
+	}
+
+	for name, server := range map[string]MCPServer{
+		"invalid name":   {Name: "my server", URL: "http://x"},
+		"no URL":         {Name: "empty"},
+		"bad transport":  {Name: "x", URL: "http://x", Transport: "ws"},
+		"stdio":          {Name: "x", URL: "http://x", Transport: mcp.TransportStdio},
+		"bad prefix":     {Name: "x", URL: "http://x", ToolPrefix: &badPrefix},
+		"duplicate":      {Name: "loki", URL: "http://x"},
+		"foreign secret": {Name: "x", URL: "http://x", Secrets: map[string]string{"X-Token": "grafana_api_key"}},
+		"other command":  {Name: "x", MCPCommand: MCPCommand{Command: "/bin/sh", Args: []string{"-c", "id"}}},
+		"relative path":  {Name: "x", MCPCommand: MCPCommand{Command: "local-mcp"}},
+		"loader env":     {Name: "x", MCPCommand: MCPCommand{Command: "/usr/bin/local-mcp", Env: map[string]string{"LD_PRELOAD": "/tmp/x.so"}}},
+	} {
+		invalid := *settings
+		invalid.MCPServers = append(append([]MCPServer(nil), settings.MCPServers...), server)
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Validate() accepted %s", name)
+		}
+	}
+}
+
+func TestGetSessionStorePath(t *testing.T) {
+	settings := &PluginSettings{
+		GrafanaURL:    "http://grafana:3000",
+		GrafanaAPIKey: "key",
+		GrafanaMCPURL: "http://grafana-mcp:8888",
+		SessionStore:  SessionStoreFile,
+	}
+
+	t.Setenv("GF_PATHS_DATA", "/var/lib/grafana")
+	if got, want := settings.GetSessionStorePath(), filepath.Join("/var/lib/grafana", "plugins-data", "sabio-sm3-chat-plugin", "sessions"); got != want {
+		t.Errorf("GetSessionStorePath() = %s, want %s", got, want)
+	}
+
+	// Without a data directory the file store must be pointed somewhere explicitly
+	t.Setenv("GF_PATHS_DATA", "")
+	if err := settings.Validate(); err == nil || !strings.Contains(err.Error(), "session_store_path") {
+		t.Errorf("Validate() error = %v, want the missing session_store_path", err)
+	}
+	settings.SessionStorePath = "/data/sessions"
+	if err := settings.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Executable() error = %v", err)
+	}
+	pluginDir := filepath.Dir(exe)
+	t.Setenv(allowedCommandsEnv, "")
+
+	for command, allowed := range map[string]bool{
+		filepath.Join(pluginDir, "alertmanager-mcp"):          true,
+		filepath.Join(pluginDir, "bin", "genesys-mcp"):        true,
+		filepath.Join(pluginDir, "..", "other-plugin", "mcp"): false,
+		filepath.Join(pluginDir+"-evil", "alertmanager-mcp"):  false,
+		"/bin/sh": false,
+	} {
+		if err := checkCommand(MCPCommand{Command: command}); (err == nil) != allowed {
+			t.Errorf("checkCommand(%s) error = %v, want allowed = %v", command, err, allowed)
+		}
+	}
+
+	t.Setenv(allowedCommandsEnv, "/usr/local/bin/loki-mcp")
+	if err := checkCommand(MCPCommand{Command: "/usr/local/bin/loki-mcp"}); err != nil {
+		t.Errorf("checkCommand() of a listed binary error = %v", err)
+	}
+}
@@ -3,10 +3,12 @@ package plugin
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/agent"
 	"github.com/sabio/grafana-sm3-chat-plugin/pkg/llm"
 	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
 )
@@ -23,19 +25,30 @@ func (i *Instance) handleChatStream(ctx context.Context, req *backend.CallResour
 	if chatReq.Message == "" {
 		return i.sendError(sender, 400, "Message is required")
 	}
+	if chatReq.Model != "" && !validModel.MatchString(chatReq.Model) {
+		return i.sendError(sender, 400, fmt.Sprintf("Invalid model %q", chatReq.Model))
+	}
 
-	// Generate session ID if not provided
-	if chatReq.SessionID == "" {
-		chatReq.SessionID = fmt.Sprintf("session-%d", req.PluginContext.OrgID)
+	// Identify the user and assign a session ID if not provided
+	user, err := sessionUser(req.PluginContext)
+	if err != nil {
+		return i.sendError(sender, 401, err.Error())
+	}
+	if err := assignSessionID(&chatReq); err != nil {
+		return i.sendError(sender, 500, err.Error())
 	}
+	ctx = llm.WithModel(ctx, i.requestModel(chatReq))
 
-	log.DefaultLogger.Info("Chat stream request", "session", chatReq.SessionID, "message_length", len(chatReq.Message))
+	log.DefaultLogger.Info("Chat stream request", "session", chatReq.SessionID, "user", user.Login, "message_length", len(chatReq.Message), "model", i.requestModel(chatReq))
 
 	// Build contextual message
 	message := buildContextualMessage(chatReq.Message, chatReq.DashboardContext)
 
-	// Start streaming
-	chunks, err := i.agentManager.RunChatStream(ctx, message, chatReq.SessionID)
+	// Start streaming; the agent loop runs tools through executeTool
+	chunks, err := i.agentManager.RunChatStream(ctx, message, chatReq.SessionID, user, i.toolExecutor(user))
+	if errors.Is(err, agent.ErrSessionForbidden) {
+		return i.sendError(sender, 403, err.Error())
+	}
 	if err != nil {
 		log.DefaultLogger.Error("Stream failed to start", "error", err)
 		return i.sendError(sender, 500, fmt.Sprintf("Failed to start stream: %v", err))
@@ -50,25 +63,10 @@ func (i *Instance) handleChatStream(ctx context.Context, req *backend.CallResour
 	}
 
 	// Stream chunks
-	var fullResponse string
 	for chunk := range chunks {
-		// Handle tool execution
-		if chunk.Type == "tool" {
-			log.DefaultLogger.Info("Tool call", "tool", chunk.Tool)
-
-			// Execute tool via MCP
-			result, err := i.executeTool(ctx, chunk.Tool, chunk.Arguments)
-			if err != nil {
-				log.DefaultLogger.Error("Tool execution failed", "tool", chunk.Tool, "error", err)
-				chunk.Result = fmt.Sprintf("Error: %v", err)
-			} else {
-				chunk.Result = result
-			}
-		}
-
-		// Accumulate response content
-		if chunk.Type == "token" {
-			fullResponse += chunk.Message
+		// Tell the client which session it is in (it may have been generated here)
+		if chunk.Type == "start" {
+			chunk.SessionID = chatReq.SessionID
 		}
 
 		// Send chunk as SSE
@@ -78,46 +76,56 @@ func (i *Instance) handleChatStream(ctx context.Context, req *backend.CallResour
 		}
 	}
 
-	// Add final response to memory
-	i.agentManager.AddAssistantResponse(chatReq.SessionID, fullResponse)
-
 	return nil
 }
 
-// executeTool executes a tool call via MCP client
-func (i *Instance) executeTool(ctx context.Context, toolName string, args map[string]interface{}) (interface{}, error) {
-	// Determine which MCP client to use based on tool prefix
-	var client *mcp.Client
-	var found bool
-
-	// Check for prefixed tools (e.g., alertmanager__list_alerts)
-	for serverType, mcpClient := range i.mcpClients {
-		if serverType != "grafana" {
-			prefix := serverType + "__"
-			if len(toolName) > len(prefix) && toolName[:len(prefix)] == prefix {
-				client = mcpClient
-				found = true
-				break
-			}
-		}
+// toolExecutor returns the agent.ToolExecutor that runs tools on behalf of user
+func (i *Instance) toolExecutor(user agent.User) agent.ToolExecutor {
+	return func(ctx context.Context, toolName string, args map[string]interface{}) (*mcp.ToolResult, error) {
+		return i.executeTool(ctx, user, toolName, args)
 	}
+}
 
-	// If no prefix found, use Grafana client (default)
-	if !found {
-		client = i.mcpClients["grafana"]
-		if client == nil {
-			return nil, fmt.Errorf("Grafana MCP client not available")
-		}
+// executeTool executes a tool call via MCP client, refusing tools the user's role may not run
+func (i *Instance) executeTool(ctx context.Context, user agent.User, toolName string, args map[string]interface{}) (*mcp.ToolResult, error) {
+	log.DefaultLogger.Info("Tool call", "tool", toolName, "user", user.Login)
+
+	if err := i.agentManager.CanUseTool(toolName, user); err != nil {
+		log.DefaultLogger.Warn("Tool call refused by policy", "tool", toolName, "user", user.Login, "role", user.Role)
+		return nil, err
+	}
+
+	// Servers configured with a user header learn who is asking
+	ctx = mcp.WithUser(ctx, user.Login)
+
+	if toolName == agent.ReadResourceTool {
+		return i.readResource(ctx, args)
+	}
+
+	// Find the server offering the tool and its name there
+	route, err := i.agentManager.ResolveTool(toolName)
+	if err != nil {
+		log.DefaultLogger.Warn("Unknown tool requested", "tool", toolName)
+		return nil, err
+	}
+
+	client, ok := i.mcpClients[route.Server]
+	if !ok {
+		return nil, fmt.Errorf("MCP server %s for tool %s is not connected", route.Server, toolName)
 	}
 
 	// Execute tool
-	result, err := client.InvokeTool(ctx, toolName, args)
+	result, err := client.CallTool(ctx, route.Tool, args)
 	if err != nil {
+		log.DefaultLogger.Error("Tool execution failed", "tool", toolName, "server", route.Server, "error", err)
 		return nil, err
 	}
 
-	// Format result for LLM
-	return mcp.FormatToolResult(result), nil
+	if result.IsError {
+		log.DefaultLogger.Warn("Tool reported an error", "tool", toolName)
+	}
+
+	return result, nil
 }
 
 // sendSSE sends a chunk as a Server-Sent Event
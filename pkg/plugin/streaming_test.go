@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/agent"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp/mcptest"
+)
+
+// newToolsMCPServer starts a fake MCP server offering list_alerts; calls report
+// the tool name the server received
+func newToolsMCPServer(t *testing.T, serverType string) *mcptest.Server {
+	t.Helper()
+
+	return mcptest.NewServer(t, map[string]interface{}{"tools": map[string]interface{}{}}, map[string]mcptest.Handler{
+		"tools/list": mcptest.Result(map[string]interface{}{"tools": []mcp.Tool{{Name: "list_alerts"}}}),
+		"tools/call": func(params map[string]interface{}) (interface{}, error) {
+			name, _ := params["name"].(string)
+			return mcp.ToolResult{Content: []mcp.Content{{Type: mcp.ContentText, Text: serverType + ":" + name}}}, nil
+		},
+	})
+}
+
+// newToolsMCPClient connects to a fake MCP server started by newToolsMCPServer
+func newToolsMCPClient(t *testing.T, serverType string, config mcp.ClientConfig) *mcp.Client {
+	t.Helper()
+
+	client, err := mcp.NewClientWithConfig(newToolsMCPServer(t, serverType).URL, serverType, config)
+	if err != nil {
+		t.Fatalf("NewClientWithConfig() error = %v", err)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	return client
+}
+
+func TestExecuteToolRouting(t *testing.T) {
+	prefix := "am_"
+	mcpClients := map[string]*mcp.Client{
+		"grafana":      newToolsMCPClient(t, "grafana", mcp.ClientConfig{}),
+		"alertmanager": newToolsMCPClient(t, "alertmanager", mcp.ClientConfig{ToolPrefix: &prefix}),
+	}
+	manager, err := agent.NewManager(nil, mcpClients, []string{"grafana", "alertmanager"})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	instance := &Instance{agentManager: manager, mcpClients: mcpClients}
+	viewer := agent.User{Login: "alice", Role: agent.RoleViewer}
+
+	for tool, want := range map[string]string{
+		"list_alerts":    "grafana:list_alerts",
+		"am_list_alerts": "alertmanager:list_alerts",
+	} {
+		result, err := instance.executeTool(context.Background(), viewer, tool, nil)
+		if err != nil {
+			t.Errorf("executeTool(%s) error = %v", tool, err)
+			continue
+		}
+		if got := mcp.FormatToolResult(result); got != want {
+			t.Errorf("executeTool(%s) = %q, want %q", tool, got, want)
+		}
+	}
+
+	// With a custom prefix the default alertmanager__ name is unknown
+	if _, err := instance.executeTool(context.Background(), viewer, "alertmanager__list_alerts", nil); !errors.Is(err, agent.ErrUnknownTool) {
+		t.Errorf("executeTool(alertmanager__list_alerts) error = %v, want ErrUnknownTool", err)
+	}
+}
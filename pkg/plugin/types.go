@@ -1,10 +1,18 @@
 package plugin
 
+import (
+	"time"
+
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/agent"
+	"github.com/sabio/grafana-sm3-chat-plugin/pkg/mcp"
+)
+
 // ChatRequest represents an incoming chat request
 type ChatRequest struct {
 	Message          string            `json:"message"`
 	SessionID        string            `json:"session_id"`
 	DashboardContext *DashboardContext `json:"dashboard_context,omitempty"`
+	Model            string            `json:"model,omitempty"` // "base", "large", "auto" or a provider model name (default: the org's model)
 }
 
 // DashboardContext contains dashboard metadata
@@ -16,8 +24,65 @@ type DashboardContext struct {
 	TimeRange map[string]string `json:"time_range"`
 }
 
+// ApproveRequest is the user's decision on a tool call that is waiting for approval
+type ApproveRequest struct {
+	ApprovalID string `json:"approval_id"`
+	Approved   bool   `json:"approved"`
+}
+
 // ChatResponse represents a chat response
 type ChatResponse struct {
-	Response  string `json:"response"`
-	SessionID string `json:"session_id"`
+	Response  string                 `json:"response"`
+	SessionID string                 `json:"session_id"`
+	ToolCalls []agent.ToolInvocation `json:"tool_calls,omitempty"`
+	Model     string                 `json:"model"` // Model that produced the response
+}
+
+// Overall health states
+const (
+	HealthHealthy   = "healthy"   // LLM provider and every MCP server are up
+	HealthDegraded  = "degraded"  // Some MCP servers are down; chat works with the others' tools
+	HealthUnhealthy = "unhealthy" // The LLM provider or every MCP server is down
+)
+
+// HealthResponse reports the state of the LLM provider and each MCP server
+type HealthResponse struct {
+	Status         string                     `json:"status"`
+	CheckedAt      time.Time                  `json:"checked_at"`
+	LLMProvider    ComponentHealth            `json:"llm_provider"`
+	MCPServers     map[string]MCPServerHealth `json:"mcp_servers"`
+	ToolCollisions []agent.ToolCollision      `json:"tool_collisions"`
+}
+
+// ComponentHealth is the result of checking one component
+type ComponentHealth struct {
+	OK          bool       `json:"ok"`
+	Error       string     `json:"error,omitempty"`
+	LatencyMS   int64      `json:"latency_ms"`
+	LastSuccess *time.Time `json:"last_success,omitempty"` // Last time the component passed a check
+}
+
+// MCPServerHealth is the result of checking one MCP server
+type MCPServerHealth struct {
+	ComponentHealth
+	Circuit         string                  `json:"circuit"`
+	Tools           *int                    `json:"tools,omitempty"` // Tools the server offers, if they could be listed
+	ProtocolVersion string                  `json:"protocol_version,omitempty"`
+	ServerInfo      *mcp.Implementation     `json:"server_info,omitempty"`
+	Capabilities    *mcp.ServerCapabilities `json:"capabilities,omitempty"`
+}
+
+// HealthProbe is one entry of the health history
+type HealthProbe struct {
+	Time        time.Time                  `json:"time"`
+	Status      string                     `json:"status"`
+	LLMProvider ComponentHealth            `json:"llm_provider"`
+	MCPServers  map[string]ComponentHealth `json:"mcp_servers"`
+}
+
+// HealthHistoryResponse lists recent health checks, oldest first
+type HealthHistoryResponse struct {
+	IntervalSeconds int            `json:"interval_seconds"` // Pause between background probes
+	Probes          []HealthProbe  `json:"probes"`
+	MCPTransitions  map[string]int `json:"mcp_transitions"` // Up/down changes per MCP server over the history
 }
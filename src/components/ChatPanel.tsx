@@ -5,7 +5,8 @@ import { Send, Loader2, Wrench } from 'lucide-react';
 import { chatApi } from '../utils/api';
 import { MarkdownContent } from './MarkdownContent';
 import { Artifact, parseArtifacts } from './Artifact';
-import type { PanelOptions, Message, ToolCall, DashboardContext } from '../types';
+import { ToolResultView } from './ToolResultView';
+import type { PanelOptions, Message, ToolCall, DashboardContext, PromptInfo } from '../types';
 
 interface ChatPanelProps extends PanelProps<PanelOptions> {}
 
@@ -14,8 +15,11 @@ export function ChatPanel(props: ChatPanelProps) {
   const [messages, setMessages] = useState<Message[]>([]);
   const [input, setInput] = useState('');
   const [isLoading, setIsLoading] = useState(false);
-  const [sessionId] = useState(() => `session-${Date.now()}`);
+  // Assigned by the backend on the first message
+  const [sessionId, setSessionId] = useState<string | undefined>(undefined);
   const [dashboardContext, setDashboardContext] = useState<DashboardContext | null>(null);
+  // Starter prompts published by the MCP servers
+  const [serverPrompts, setServerPrompts] = useState<PromptInfo[]>([]);
   const messagesEndRef = useRef<HTMLDivElement>(null);
 
   // Add CSS animations to the document
@@ -46,6 +50,14 @@ export function ChatPanel(props: ChatPanelProps) {
     scrollToBottom();
   }, [messages]);
 
+  // Load the starter prompts published by the MCP servers
+  useEffect(() => {
+    chatApi
+      .listPrompts()
+      .then(setServerPrompts)
+      .catch((error) => console.warn('Failed to load prompts:', error));
+  }, []);
+
   // Extract dashboard context from Grafana
   useEffect(() => {
     const extractDashboardContext = async () => {
@@ -130,7 +142,9 @@ export function ChatPanel(props: ChatPanelProps) {
         })) {
           console.log('[DEBUG] Received chunk:', chunk.type, chunk);
 
-          if (chunk.type === 'token' && chunk.message) {
+          if (chunk.type === 'start' && chunk.session_id) {
+            setSessionId(chunk.session_id);
+          } else if (chunk.type === 'token' && chunk.message) {
             console.log(
               '[DEBUG] Token chunk length:',
               chunk.message.length,
@@ -144,13 +158,26 @@ export function ChatPanel(props: ChatPanelProps) {
                 msg.id === assistantMessageId ? { ...msg, content: accumulatedContent } : msg
               )
             );
-          } else if (chunk.type === 'tool') {
+          } else if (
+            chunk.type === 'approval_required' ||
+            chunk.type === 'tool_start' ||
+            chunk.type === 'tool_result'
+          ) {
             const toolCall: ToolCall = {
+              id: chunk.tool_call_id,
               tool: chunk.tool || 'unknown',
               arguments: chunk.arguments || {},
               output: chunk.result || '',
+              result: chunk.output,
+              approvalId: chunk.type === 'approval_required' ? chunk.approval_id : undefined,
             };
-            toolCalls.push(toolCall);
+            // Later events replace the entry created by approval_required or tool_start
+            const existing = toolCall.id ? toolCalls.findIndex((tc) => tc.id === toolCall.id) : -1;
+            if (existing >= 0) {
+              toolCalls[existing] = toolCall;
+            } else {
+              toolCalls.push(toolCall);
+            }
             setMessages((prev) =>
               prev.map((msg) =>
                 msg.id === assistantMessageId ? { ...msg, toolCalls: [...toolCalls] } : msg
@@ -204,6 +231,26 @@ export function ChatPanel(props: ChatPanelProps) {
     [isLoading, sessionId, dashboardContext]
   );
 
+  // Send the user's decision on a mutating tool call; the stream continues once it is received
+  const handleApproval = useCallback(async (messageId: string, approvalId: string, approved: boolean) => {
+    setMessages((prev) =>
+      prev.map((msg) =>
+        msg.id === messageId
+          ? {
+              ...msg,
+              toolCalls: msg.toolCalls?.map((tc) => (tc.approvalId === approvalId ? { ...tc, approvalId: undefined } : tc)),
+            }
+          : msg
+      )
+    );
+
+    try {
+      await chatApi.approve({ approval_id: approvalId, approved });
+    } catch (error) {
+      console.error('Error sending approval:', error);
+    }
+  }, []);
+
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
     if (!input.trim() || isLoading) {
@@ -216,6 +263,26 @@ export function ChatPanel(props: ChatPanelProps) {
     setInput(suggestion);
   };
 
+  // Render a server prompt into the input, asking for its arguments first
+  const handleServerPromptClick = async (prompt: PromptInfo) => {
+    const args: Record<string, string> = {};
+    for (const arg of prompt.arguments || []) {
+      const value = window.prompt(arg.description ? `${arg.name}: ${arg.description}` : arg.name);
+      if (value === null) {
+        return;
+      }
+      if (value !== '' || arg.required) {
+        args[arg.name] = value;
+      }
+    }
+
+    try {
+      setInput(await chatApi.getPrompt(prompt.server, prompt.name, args));
+    } catch (error) {
+      console.error('Failed to get prompt:', error);
+    }
+  };
+
   // Calculate container height for scrollable area
   const containerHeight = height - 80; // Subtract height for input area
 
@@ -254,6 +321,25 @@ export function ChatPanel(props: ChatPanelProps) {
                     {suggestion}
                   </button>
                 ))}
+                {serverPrompts.map((prompt) => (
+                  <button
+                    key={`${prompt.server}/${prompt.name}`}
+                    onClick={() => handleServerPromptClick(prompt)}
+                    title={prompt.description}
+                    style={{
+                      padding: '8px 16px',
+                      backgroundColor: '#1f2937',
+                      border: '1px solid #2563eb',
+                      borderRadius: '8px',
+                      fontSize: '14px',
+                      color: '#f3f4f6',
+                      cursor: 'pointer',
+                      textAlign: 'left',
+                    }}
+                  >
+                    {prompt.title || prompt.name}
+                  </button>
+                ))}
               </div>
             </div>
           </div>
@@ -299,9 +385,11 @@ export function ChatPanel(props: ChatPanelProps) {
                   </>
                 )}
 
-                {/* Tool calls */}
-                {options.showToolCalls && message.toolCalls && message.toolCalls.length > 0 && (
-                  <details style={{ marginTop: '12px', backgroundColor: 'rgba(17, 24, 39, 0.4)', border: '1px solid #374151', borderRadius: '4px' }}>
+                {/* Tool calls (always shown while one waits for approval) */}
+                {message.toolCalls && message.toolCalls.length > 0 && (options.showToolCalls || message.toolCalls.some((tc) => tc.approvalId)) && (
+                  <details
+                    open={message.toolCalls.some((tc) => tc.approvalId) || undefined}
+                    style={{ marginTop: '12px', backgroundColor: 'rgba(17, 24, 39, 0.4)', border: '1px solid #374151', borderRadius: '4px' }}>
                     <summary style={{ cursor: 'pointer', padding: '8px 12px', fontSize: '12px', color: '#d1d5db', display: 'flex', alignItems: 'center', gap: '8px' }}>
                       <Wrench style={{ width: '12px', height: '12px', color: '#60a5fa' }} />
                       <span style={{ textTransform: 'uppercase', letterSpacing: '0.05em' }}>
@@ -325,15 +413,41 @@ export function ChatPanel(props: ChatPanelProps) {
                             <Wrench style={{ width: '12px', height: '12px' }} />
                             <span style={{ fontFamily: 'monospace' }}>{toolCall.tool}</span>
                           </div>
-                          {toolCall.output && (
-                            <div style={{ fontSize: '12px', color: '#9ca3af', marginTop: '4px', maxHeight: '128px', overflowY: 'auto' }}>
-                              <pre style={{ whiteSpace: 'pre-wrap', wordBreak: 'break-word' }}>
-                                {typeof toolCall.output === 'string'
-                                  ? toolCall.output
-                                  : JSON.stringify(toolCall.output, null, 2)}
+                          {toolCall.approvalId && (
+                            <div style={{ fontSize: '12px', color: '#d1d5db', marginTop: '4px' }}>
+                              <div style={{ marginBottom: '4px' }}>This tool changes state. Run it with these arguments?</div>
+                              <pre style={{ whiteSpace: 'pre-wrap', wordBreak: 'break-word', color: '#9ca3af' }}>
+                                {JSON.stringify(toolCall.arguments, null, 2)}
                               </pre>
+                              <div style={{ display: 'flex', gap: '8px', marginTop: '8px' }}>
+                                <button
+                                  onClick={() => handleApproval(message.id, toolCall.approvalId!, true)}
+                                  style={{ padding: '4px 12px', fontSize: '12px', backgroundColor: '#2563eb', color: 'white', border: 'none', borderRadius: '4px', cursor: 'pointer' }}
+                                >
+                                  Approve
+                                </button>
+                                <button
+                                  onClick={() => handleApproval(message.id, toolCall.approvalId!, false)}
+                                  style={{ padding: '4px 12px', fontSize: '12px', backgroundColor: 'transparent', color: '#d1d5db', border: '1px solid #4b5563', borderRadius: '4px', cursor: 'pointer' }}
+                                >
+                                  Reject
+                                </button>
+                              </div>
                             </div>
                           )}
+                          {toolCall.result ? (
+                            <ToolResultView result={toolCall.result} />
+                          ) : (
+                            toolCall.output && (
+                              <div style={{ fontSize: '12px', color: '#9ca3af', marginTop: '4px', maxHeight: '128px', overflowY: 'auto' }}>
+                                <pre style={{ whiteSpace: 'pre-wrap', wordBreak: 'break-word' }}>
+                                  {typeof toolCall.output === 'string'
+                                    ? toolCall.output
+                                    : JSON.stringify(toolCall.output, null, 2)}
+                                </pre>
+                              </div>
+                            )
+                          )}
                         </div>
                       ))}
                     </div>
@@ -0,0 +1,78 @@
+import React from 'react';
+import type { ToolContent, ToolResult } from '../types';
+
+const blockStyle: React.CSSProperties = {
+  fontSize: '12px',
+  color: '#9ca3af',
+  marginTop: '4px',
+};
+
+const preStyle: React.CSSProperties = {
+  whiteSpace: 'pre-wrap',
+  wordBreak: 'break-word',
+  maxHeight: '128px',
+  overflowY: 'auto',
+  margin: 0,
+};
+
+// Renders every content block of an MCP tool result
+export function ToolResultView({ result }: { result: ToolResult }) {
+  const hasText = result.content?.some((block) => block.type === 'text');
+
+  return (
+    <div style={{ ...blockStyle, borderLeft: result.isError ? '2px solid #ef4444' : undefined, paddingLeft: result.isError ? '6px' : undefined }}>
+      {result.isError && <div style={{ color: '#f87171', marginBottom: '2px' }}>Tool reported an error</div>}
+      {result.content?.map((block, idx) => (
+        <ContentBlock key={idx} block={block} />
+      ))}
+      {result.structuredContent !== undefined && !hasText && (
+        <pre style={preStyle}>{JSON.stringify(result.structuredContent, null, 2)}</pre>
+      )}
+    </div>
+  );
+}
+
+function ContentBlock({ block }: { block: ToolContent }) {
+  switch (block.type) {
+    case 'text':
+      return <pre style={preStyle}>{block.text}</pre>;
+    case 'image':
+      return (
+        <img
+          src={`data:${block.mimeType};base64,${block.data}`}
+          alt="Tool result"
+          style={{ maxWidth: '100%', maxHeight: '320px', marginTop: '4px', borderRadius: '4px' }}
+        />
+      );
+    case 'audio':
+      return <audio controls src={`data:${block.mimeType};base64,${block.data}`} style={{ marginTop: '4px' }} />;
+    case 'resource_link':
+      return (
+        <div style={{ marginTop: '4px' }}>
+          Resource: <span style={{ fontFamily: 'monospace' }}>{block.name || block.uri}</span>
+          {block.name && <span> ({block.uri})</span>}
+        </div>
+      );
+    case 'resource':
+      if (!block.resource) {
+        return null;
+      }
+      if (block.resource.mimeType?.startsWith('image/') && block.resource.blob) {
+        return (
+          <img
+            src={`data:${block.resource.mimeType};base64,${block.resource.blob}`}
+            alt={block.resource.uri}
+            style={{ maxWidth: '100%', maxHeight: '320px', marginTop: '4px', borderRadius: '4px' }}
+          />
+        );
+      }
+      return (
+        <div style={{ marginTop: '4px' }}>
+          <div style={{ fontFamily: 'monospace' }}>{block.resource.uri}</div>
+          {block.resource.text && <pre style={preStyle}>{block.resource.text}</pre>}
+        </div>
+      );
+    default:
+      return null;
+  }
+}
@@ -1,4 +1,4 @@
-import { ChatRequest, StreamChunk } from '../types';
+import { ChatRequest, ChatResponse, HealthHistoryResponse, HealthResponse, StreamChunk } from '../types';
 
 const PLUGIN_ID = 'sabio-sm3-chat-plugin';
 
@@ -71,7 +71,7 @@ export const chatApi = {
   /**
    * Send a non-streaming chat message (fallback)
    */
-  chat: async (request: ChatRequest): Promise<{ response: string; session_id: string }> => {
+  chat: async (request: ChatRequest): Promise<ChatResponse> => {
     const url = `/api/plugins/${PLUGIN_ID}/resources/chat`;
 
     const response = await fetch(url, {
@@ -92,7 +92,7 @@ export const chatApi = {
   /**
    * Check backend health
    */
-  health: async (): Promise<{ status: string; mcp_servers: Record<string, boolean> }> => {
+  health: async (): Promise<HealthResponse> => {
     const url = `/api/plugins/${PLUGIN_ID}/resources/health`;
 
     const response = await fetch(url, {
@@ -108,4 +108,24 @@ export const chatApi = {
 
     return response.json();
   },
+
+  /**
+   * Recent background health checks
+   */
+  healthHistory: async (): Promise<HealthHistoryResponse> => {
+    const url = `/api/plugins/${PLUGIN_ID}/resources/health/history`;
+
+    const response = await fetch(url, {
+      method: 'GET',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+    });
+
+    if (!response.ok) {
+      throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+    }
+
+    return response.json();
+  },
 };
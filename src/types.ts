@@ -6,6 +6,8 @@ export interface ChatRequest {
   message: string;
   session_id?: string;
   dashboard_context?: DashboardContext;
+  // 'base' | 'large' | 'auto' or a provider model name; defaults to the org's model
+  model?: string;
 }
 
 export interface DashboardContext {
@@ -17,11 +19,36 @@ export interface DashboardContext {
 }
 
 export interface StreamChunk {
-  type: 'start' | 'token' | 'tool' | 'error' | 'complete' | 'done';
+  type: 'start' | 'token' | 'tool_start' | 'tool_result' | 'approval_required' | 'error' | 'complete' | 'done';
+  session_id?: string;
+  approval_id?: string;
   message?: string;
   tool?: string;
+  tool_call_id?: string;
   arguments?: Record<string, any>;
   result?: any;
+  // Full MCP result of a tool_result event
+  output?: ToolResult;
+  // start and complete: the model answering
+  model?: string;
+}
+
+export interface ToolResult {
+  content: ToolContent[];
+  structuredContent?: any;
+  isError?: boolean;
+}
+
+export interface ToolContent {
+  type: 'text' | 'image' | 'audio' | 'resource_link' | 'resource';
+  text?: string;
+  // Base64 data of image and audio blocks
+  data?: string;
+  mimeType?: string;
+  uri?: string;
+  name?: string;
+  description?: string;
+  resource?: { uri: string; mimeType?: string; text?: string; blob?: string };
 }
 
 export interface Message {
@@ -35,12 +62,89 @@ export interface Message {
 }
 
 export interface ToolCall {
+  id?: string;
   tool: string;
   arguments: Record<string, any>;
   output: string;
+  // Full MCP result, when the tool ran
+  result?: ToolResult;
+  // Set while a mutating tool call waits for the user to approve it
+  approvalId?: string;
+}
+
+export interface ToolInvocation {
+  id: string;
+  tool: string;
+  arguments: Record<string, any>;
+  result: string;
+  output?: ToolResult;
+}
+
+// A starter prompt published by an MCP server
+export interface PromptInfo {
+  server: string;
+  name: string;
+  title?: string;
+  description?: string;
+  arguments?: Array<{ name: string; description?: string; required?: boolean }>;
+}
+
+export interface ApproveRequest {
+  approval_id: string;
+  approved: boolean;
 }
 
 export interface ChatResponse {
   response: string;
   session_id: string;
+  tool_calls?: ToolInvocation[];
+  // Model that produced the response
+  model: string;
+}
+
+// Result of checking one component; latency_ms is how long the check took
+export interface ComponentHealth {
+  ok: boolean;
+  error?: string;
+  latency_ms: number;
+  // Last time the component passed a check
+  last_success?: string;
+}
+
+export interface MCPServerHealth extends ComponentHealth {
+  circuit: 'closed' | 'open' | 'half-open';
+  // Tools the server offers, if they could be listed
+  tools?: number;
+  protocol_version?: string;
+  server_info?: { name: string; version: string };
+  capabilities?: Record<string, any>;
+}
+
+export interface ToolCollision {
+  tool: string;
+  servers: string[];
+}
+
+export interface HealthResponse {
+  status: 'healthy' | 'degraded' | 'unhealthy';
+  checked_at: string;
+  llm_provider: ComponentHealth;
+  mcp_servers: Record<string, MCPServerHealth>;
+  // Tool names offered by several servers; only the first server's tool is used
+  tool_collisions: ToolCollision[];
+}
+
+export interface HealthProbe {
+  time: string;
+  status: HealthResponse['status'];
+  llm_provider: ComponentHealth;
+  mcp_servers: Record<string, ComponentHealth>;
+}
+
+// Recent health checks, oldest first
+export interface HealthHistoryResponse {
+  interval_seconds: number;
+  probes: HealthProbe[];
+  // Up/down changes per MCP server over the history
+  mcp_transitions: Record<string, number>;
 }
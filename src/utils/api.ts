@@ -1,5 +1,5 @@
 import { getBackendSrv } from '@grafana/runtime';
-import type { ChatRequest, StreamChunk } from '../types';
+import type { ApproveRequest, ChatRequest, PromptInfo, StreamChunk } from '../types';
 
 const API_PATH = '/api/plugins/sabio-sm3-chat-plugin/resources';
 
@@ -51,4 +51,49 @@ export const chatApi = {
       }
     }
   },
+
+  // Approve or reject a tool call that is waiting in a running stream
+  approve: async (request: ApproveRequest): Promise<void> => {
+    const response = await fetch(`${API_PATH}/chat/approve`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify(request),
+    });
+
+    if (!response.ok) {
+      throw new Error(`HTTP error! status: ${response.status}`);
+    }
+  },
+
+  // List the starter prompts published by the MCP servers
+  listPrompts: async (): Promise<PromptInfo[]> => {
+    const response = await fetch(`${API_PATH}/prompts`);
+
+    if (!response.ok) {
+      throw new Error(`HTTP error! status: ${response.status}`);
+    }
+
+    const body = await response.json();
+    return body.prompts || [];
+  },
+
+  // Render a starter prompt with its arguments, returning the message text
+  getPrompt: async (server: string, name: string, args: Record<string, string>): Promise<string> => {
+    const response = await fetch(`${API_PATH}/prompts/${encodeURIComponent(server)}/${encodeURIComponent(name)}`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ arguments: args }),
+    });
+
+    if (!response.ok) {
+      throw new Error(`HTTP error! status: ${response.status}`);
+    }
+
+    const body = await response.json();
+    return body.text || '';
+  },
 };